@@ -0,0 +1,183 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/ccadb2OneCRL/onecrl"
+	"github.com/mozilla/OneCRL-Tools/ccadb2OneCRL/utils"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintohistory"
+)
+
+// An Event is a single change to a single OneCRL entry, with the entry decoded into a human readable form.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	User   string    `json:"user"`
+	Record string    `json:"record"`
+	// Only one of Issuer/Serial or Subject/KeyHash is set, depending on the kind of entry.
+	Issuer  string `json:"issuer,omitempty"`
+	Serial  string `json:"serial,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	KeyHash string `json:"keyHash,omitempty"`
+	Enabled bool   `json:"enabled"`
+	Bug     string `json:"bug,omitempty"`
+	Why     string `json:"why,omitempty"`
+	// For updates, the fields that differ from the previous version of the entry (if it is within the log).
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Audit turns the given history entries into events, oldest first. Entries
+// for anything other than records (E.G. the collection's metadata) are skipped.
+func Audit(entries []*kintohistory.Entry) ([]*Event, error) {
+	sorted := make([]*kintohistory.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.ResourceName == kintohistory.Record {
+			sorted = append(sorted, entry)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].LastModified < sorted[j].LastModified
+	})
+	previous := make(map[string]*Event)
+	events := make([]*Event, 0, len(sorted))
+	for _, entry := range sorted {
+		event := &Event{
+			Time:   entry.Time(),
+			Action: entry.Action,
+			User:   entry.UserID,
+			Record: entry.RecordID,
+		}
+		if entry.Action == kintohistory.Delete {
+			// Tombstones carry nothing but the ID, so describe the entry as it last was (if known).
+			if last, ok := previous[entry.RecordID]; ok {
+				event.describe(last)
+			}
+			delete(previous, entry.RecordID)
+			events = append(events, event)
+			continue
+		}
+		record := new(onecrl.Record)
+		if err := entry.Unmarshal(record); err != nil {
+			return nil, fmt.Errorf("failed to decode the history entry %s for %s: %v", entry.ID, entry.URI, err)
+		}
+		event.decode(record)
+		if last, ok := previous[entry.RecordID]; ok && entry.Action == kintohistory.Update {
+			event.Changed = changes(last, event)
+		}
+		previous[entry.RecordID] = event
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (e *Event) decode(record *onecrl.Record) {
+	if record.IssuerName != "" {
+		e.Issuer = name(record.IssuerName)
+	}
+	if record.SerialNumber != "" {
+		e.Serial = hexadecimal(record.SerialNumber)
+	}
+	if record.Subject != "" {
+		e.Subject = name(record.Subject)
+	}
+	if record.PubKeyHash != "" {
+		e.KeyHash = hexadecimal(record.PubKeyHash)
+	}
+	e.Enabled = record.Enabled
+	e.Bug = record.Details.Bug
+	e.Why = record.Details.Why
+}
+
+func (e *Event) describe(last *Event) {
+	e.Issuer, e.Serial = last.Issuer, last.Serial
+	e.Subject, e.KeyHash = last.Subject, last.KeyHash
+	e.Enabled, e.Bug, e.Why = last.Enabled, last.Bug, last.Why
+}
+
+func changes(before, after *Event) []string {
+	fields := []struct {
+		name          string
+		before, after interface{}
+	}{
+		{"issuer", before.Issuer, after.Issuer},
+		{"serial", before.Serial, after.Serial},
+		{"subject", before.Subject, after.Subject},
+		{"keyHash", before.KeyHash, after.KeyHash},
+		{"enabled", before.Enabled, after.Enabled},
+		{"bug", before.Bug, after.Bug},
+		{"why", before.Why, after.Why},
+	}
+	changed := make([]string, 0)
+	for _, field := range fields {
+		if field.before != field.after {
+			changed = append(changed, fmt.Sprintf("%s: %v -> %v", field.name, field.before, field.after))
+		}
+	}
+	return changed
+}
+
+// name decodes a base64 DER encoded distinguished name (E.G. a OneCRL "issuerName") into
+// its RFC 2253 string form. Anything that fails to decode is returned as-is, so that no
+// information is lost from the log.
+func name(b64 string) string {
+	der, err := utils.B64Decode(b64)
+	if err != nil {
+		return b64
+	}
+	var rdns pkix.RDNSequence
+	rest, err := asn1.Unmarshal(der, &rdns)
+	if err != nil || len(rest) != 0 {
+		return b64
+	}
+	var n pkix.Name
+	n.FillFromRDNSequence(&rdns)
+	return n.String()
+}
+
+// hexadecimal decodes a base64 value (E.G. a OneCRL "serialNumber") into colon
+// separated, uppercase hexadecimal. Anything that fails to decode is returned as-is.
+func hexadecimal(b64 string) string {
+	raw, err := utils.B64Decode(b64)
+	if err != nil {
+		return b64
+	}
+	octets := make([]string, len(raw))
+	for i, b := range raw {
+		octets[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(octets, ":")
+}
+
+// Print writes the given events as a plain text log, one paragraph per event.
+func Print(w io.Writer, events []*Event) error {
+	for _, event := range events {
+		lines := []string{fmt.Sprintf("%s  %-6s  %s  %s",
+			event.Time.Format(time.RFC3339), event.Action, event.User, event.Record)}
+		if event.Issuer != "" || event.Serial != "" {
+			lines = append(lines, "    issuer:   "+event.Issuer, "    serial:   "+event.Serial)
+		}
+		if event.Subject != "" || event.KeyHash != "" {
+			lines = append(lines, "    subject:  "+event.Subject, "    key hash: "+event.KeyHash)
+		}
+		if event.Bug != "" {
+			lines = append(lines, "    bug:      "+event.Bug)
+		}
+		for _, change := range event.Changed {
+			lines = append(lines, "    changed   "+change)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(lines, "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
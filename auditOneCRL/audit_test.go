@@ -0,0 +1,84 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintohistory"
+)
+
+func issuer(t *testing.T, cn string) string {
+	der, err := asn1.Marshal(pkix.Name{CommonName: cn, Organization: []string{"Test"}}.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func entry(id uint64, action, record, data string) *kintohistory.Entry {
+	return &kintohistory.Entry{
+		ID:           fmt.Sprint(id),
+		LastModified: id,
+		Action:       action,
+		ResourceName: kintohistory.Record,
+		UserID:       "account:alice",
+		RecordID:     record,
+		Target:       kintohistory.Target{Data: []byte(data)},
+	}
+}
+
+func TestAudit(t *testing.T) {
+	ca := issuer(t, "Test CA")
+	created := fmt.Sprintf(`{"id": "a", "issuerName": %q, "serialNumber": "Ae5fInnr9AhpWVIjkw==", "enabled": false, "details": {"bug": "1234"}}`, ca)
+	enabled := fmt.Sprintf(`{"id": "a", "issuerName": %q, "serialNumber": "Ae5fInnr9AhpWVIjkw==", "enabled": true, "details": {"bug": "1234"}}`, ca)
+	// Kinto lists history newest first.
+	entries := []*kintohistory.Entry{
+		entry(4, kintohistory.Delete, "a", `{"id": "a", "deleted": true}`),
+		entry(3, kintohistory.Update, "a", enabled),
+		{ID: "2", LastModified: 2, Action: kintohistory.Update, ResourceName: kintohistory.Collection, Target: kintohistory.Target{Data: []byte(`{"id": "onecrl"}`)}},
+		entry(1, kintohistory.Create, "a", created),
+	}
+	events, err := Audit(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected the collection's entry to be skipped, got %d events", len(events))
+	}
+	create, update, del := events[0], events[1], events[2]
+	if create.Action != kintohistory.Create || create.Issuer != "CN=Test CA,O=Test" || create.Serial != "01:EE:5F:22:79:EB:F4:08:69:59:52:23:93" {
+		t.Errorf("unexpected creation %v", create)
+	}
+	if !reflect.DeepEqual(update.Changed, []string{"enabled: false -> true"}) {
+		t.Errorf("unexpected changes %v", update.Changed)
+	}
+	if del.Action != kintohistory.Delete || del.Issuer != create.Issuer || del.Bug != "1234" {
+		t.Errorf("expected the deletion to describe the deleted entry, got %v", del)
+	}
+	out := new(bytes.Buffer)
+	if err := Print(out, events); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "issuer:   CN=Test CA,O=Test") || !strings.Contains(out.String(), "changed   enabled: false -> true") {
+		t.Errorf("unexpected log\n%s", out)
+	}
+}
+
+func TestUndecodable(t *testing.T) {
+	if got := name("not base64!"); got != "not base64!" {
+		t.Errorf("expected an undecodable name to be returned as-is, got %s", got)
+	}
+	if got := name(base64.StdEncoding.EncodeToString([]byte("not DER"))); got != "bm90IERFUg==" {
+		t.Errorf("expected a name that is not DER to be returned as-is, got %s", got)
+	}
+}
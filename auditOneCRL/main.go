@@ -0,0 +1,114 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// auditOneCRL answers "who added, changed, or removed this OneCRL entry, and when?" by
+// turning the Kinto History plugin's audit trail of a collection into a readable log.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/auth"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintohistory"
+)
+
+// Credentials are taken from the environment, rather than flags, so that they never end up in a shell history.
+const (
+	KintoUser     = "KINTO_USER"
+	KintoPassword = "KINTO_PASSWORD"
+	KintoToken    = "KINTO_TOKEN"
+)
+
+func main() {
+	server := flag.String("url", "https://remote-settings.mozilla.org/v1", "the base URL of the Kinto server")
+	bucket := flag.String("bucket", "security-state-staging", "the bucket whose history is kept (history is kept on the workspace bucket)")
+	collection := flag.String("collection", "onecrl", "the collection to audit")
+	record := flag.String("record", "", "only list changes to the record of this ID")
+	user := flag.String("by", "", "only list changes made by this comma separated list of principals (E.G. account:alice)")
+	action := flag.String("action", "", "only list changes of this comma separated list of actions (create, update, delete)")
+	since := flag.String("since", "", "only list changes made after this date (E.G. 2021-02-26) or this long ago (E.G. 720h)")
+	before := flag.String("before", "", "only list changes made before this date (E.G. 2021-02-26) or this long ago (E.G. 720h)")
+	asJSON := flag.Bool("json", false, "print the log as a JSON array rather than as text")
+	flag.Parse()
+
+	filter := kintohistory.New(buckets.NewBucket(*bucket)).
+		Collection(*collection).
+		ResourceName(kintohistory.Record)
+	if *record != "" {
+		filter.Record(*record)
+	}
+	if *user != "" {
+		filter.User(list(*user)...)
+	}
+	if *action != "" {
+		filter.Action(list(*action)...)
+	}
+	if *since != "" {
+		t, err := parseTime(*since)
+		check(err)
+		filter.Since(t)
+	}
+	if *before != "" {
+		t, err := parseTime(*before)
+		check(err)
+		filter.Before(t)
+	}
+
+	client, err := kinto.NewClientFromStr(*server)
+	check(err)
+	switch {
+	case os.Getenv(KintoToken) != "":
+		client.WithAuthenticator(&auth.Token{Token: os.Getenv(KintoToken)})
+	case os.Getenv(KintoUser) != "":
+		client.WithAuthenticator(&auth.User{Username: os.Getenv(KintoUser), Password: os.Getenv(KintoPassword)})
+	}
+	entries, err := client.History(filter)
+	if kinto.IsNotFound(err) {
+		check(fmt.Errorf("%s/buckets/%s has no history, is the Kinto History plugin enabled? %v", *server, *bucket, err))
+	}
+	check(err)
+	events, err := Audit(entries)
+	check(err)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		check(encoder.Encode(events))
+		return
+	}
+	check(Print(os.Stdout, events))
+}
+
+// parseTime accepts either a date (E.G. 2021-02-26), an RFC 3339 timestamp,
+// or a duration (E.G. 720h) which is taken to mean that long ago.
+func parseTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func list(value string) []string {
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items
+}
+
+func check(err error) {
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
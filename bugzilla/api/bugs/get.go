@@ -6,8 +6,6 @@ package bugs
 
 import (
 	"fmt"
-	"strconv"
-	"strings"
 
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api"
 )
@@ -23,47 +21,6 @@ func (g *Get) Resource() string {
 	return fmt.Sprintf("/bug/%d", g.Id)
 }
 
-type Search struct {
-	Ids []int
-	api.Get
-	api.Ok
-}
-
-func (s *Search) AddBug(bug int) *Search {
-	if s.Ids == nil {
-		s.Ids = []int{bug}
-	} else {
-		s.Ids = append(s.Ids, bug)
-	}
-	return s
-}
-
-func (s *Search) AddBugs(bugs ...int) *Search {
-	if s.Ids == nil {
-		s.Ids = bugs
-	} else {
-		s.Ids = append(s.Ids, bugs...)
-	}
-	return s
-}
-
-func (s *Search) Resource() string {
-	// Encodes the search query as described by the following doc found at...
-	// https://bugzilla.readthedocs.io/en/latest/api/core/v1/bug.html#get-bug
-	//
-	// You can also use Search Bugs to return more than one bug at a time by specifying bug IDs as the search terms.
-	//
-	// GET /rest/bug?id=12434,43421
-	if s.Ids == nil {
-		s.Ids = []int{}
-	}
-	ids := make([]string, len(s.Ids))
-	for i, id := range s.Ids {
-		ids[i] = strconv.Itoa(id)
-	}
-	return fmt.Sprintf("/bug?id=%s", strings.Join(ids, ","))
-}
-
 type GetResponse struct {
 	Faults []string `json:"faults"`
 	Bugs   []Bug    `json:"bugs"`
@@ -0,0 +1,240 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package bugs
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api"
+)
+
+// The statuses of a bug that is yet to be resolved.
+var OpenStatuses = []string{"UNCONFIRMED", "NEW", "ASSIGNED", "REOPENED"}
+
+// The statuses of a bug that has been resolved.
+var ClosedStatuses = []string{"RESOLVED", "VERIFIED", "CLOSED"}
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/bug.html#search-bugs
+//
+// A bug must match every criterion that is set. Where a criterion is a list (E.G. Statuses)
+// a bug need only match one of its values, save for Keywords, all of which a bug must have.
+// For example, the first ten open bugs whose summary contains "CCADB entries generated"...
+//
+//	search := new(bugs.Search).
+//		AddStatuses(bugs.OpenStatuses...).
+//		WithSummary("CCADB entries generated").
+//		Page(10, 0)
+type Search struct {
+	Ids         []int
+	Products    []string
+	Components  []string
+	Statuses    []string
+	Resolutions []string
+	Creators    []string
+	// Summary and Whiteboard match any bug that contains them (case insensitively).
+	Summary    string
+	Whiteboard string
+	Keywords   []string
+	// The time ranges within which a bug was created and last changed. The
+	// lower bounds are inclusive, the upper bounds are not, and zero means unbounded.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	ChangedAfter  time.Time
+	ChangedBefore time.Time
+	// https://bugzilla.mozilla.org/page.cgi?id=quicksearch.html
+	Quicksearch string
+	// A Limit of zero means no limit (or rather, the limit of the server).
+	Limit  int
+	Offset int
+	// https://bugzilla.readthedocs.io/en/latest/api/core/v1/general.html#useful-parameters
+	IncludeFields []string
+	ExcludeFields []string
+	api.Get
+	api.Ok
+}
+
+func (s *Search) AddBug(bug int) *Search {
+	if s.Ids == nil {
+		s.Ids = []int{bug}
+	} else {
+		s.Ids = append(s.Ids, bug)
+	}
+	return s
+}
+
+func (s *Search) AddBugs(bugs ...int) *Search {
+	if s.Ids == nil {
+		s.Ids = bugs
+	} else {
+		s.Ids = append(s.Ids, bugs...)
+	}
+	return s
+}
+
+func (s *Search) AddProducts(products ...string) *Search {
+	s.Products = append(s.Products, products...)
+	return s
+}
+
+func (s *Search) AddComponents(components ...string) *Search {
+	s.Components = append(s.Components, components...)
+	return s
+}
+
+func (s *Search) AddStatuses(statuses ...string) *Search {
+	s.Statuses = append(s.Statuses, statuses...)
+	return s
+}
+
+func (s *Search) AddResolutions(resolutions ...string) *Search {
+	s.Resolutions = append(s.Resolutions, resolutions...)
+	return s
+}
+
+func (s *Search) AddCreators(creators ...string) *Search {
+	s.Creators = append(s.Creators, creators...)
+	return s
+}
+
+func (s *Search) AddKeywords(keywords ...string) *Search {
+	s.Keywords = append(s.Keywords, keywords...)
+	return s
+}
+
+func (s *Search) WithSummary(summary string) *Search {
+	s.Summary = summary
+	return s
+}
+
+func (s *Search) WithWhiteboard(whiteboard string) *Search {
+	s.Whiteboard = whiteboard
+	return s
+}
+
+func (s *Search) WithQuicksearch(quicksearch string) *Search {
+	s.Quicksearch = quicksearch
+	return s
+}
+
+// CreatedBetween matches bugs created at or after the first time, and before the second.
+// Either may be zero for an open ended range.
+func (s *Search) CreatedBetween(after, before time.Time) *Search {
+	s.CreatedAfter, s.CreatedBefore = after, before
+	return s
+}
+
+// ChangedBetween matches bugs last changed at or after the first time, and before the second.
+// Either may be zero for an open ended range.
+func (s *Search) ChangedBetween(after, before time.Time) *Search {
+	s.ChangedAfter, s.ChangedBefore = after, before
+	return s
+}
+
+func (s *Search) Page(limit, offset int) *Search {
+	s.Limit, s.Offset = limit, offset
+	return s
+}
+
+func (s *Search) Include(fields ...string) *Search {
+	s.IncludeFields = append(s.IncludeFields, fields...)
+	return s
+}
+
+func (s *Search) Exclude(fields ...string) *Search {
+	s.ExcludeFields = append(s.ExcludeFields, fields...)
+	return s
+}
+
+func (s *Search) Resource() string {
+	// Encodes the search query as described by the following doc found at...
+	// https://bugzilla.readthedocs.io/en/latest/api/core/v1/bug.html#search-bugs
+	//
+	// Time ranges are bounded from below by creation_time and last_change_time, which match bugs
+	// at or after the given time. Neither has an upper bound counterpart, so those are encoded
+	// as a custom search (the f1, o1, v1 family of parameters) of the form that the advanced
+	// search page of Bugzilla generates.
+	//
+	// GET /rest/bug?product=Core&status=NEW&status=ASSIGNED&summary=CCADB&limit=10
+	query := url.Values{}
+	if len(s.Ids) > 0 {
+		ids := make([]string, len(s.Ids))
+		for i, id := range s.Ids {
+			ids[i] = strconv.Itoa(id)
+		}
+		query.Set("id", strings.Join(ids, ","))
+	}
+	for param, values := range map[string][]string{
+		"product":    s.Products,
+		"component":  s.Components,
+		"status":     s.Statuses,
+		"resolution": s.Resolutions,
+		"creator":    s.Creators,
+	} {
+		for _, value := range values {
+			query.Add(param, value)
+		}
+	}
+	for param, value := range map[string]string{
+		"summary":     s.Summary,
+		"whiteboard":  s.Whiteboard,
+		"quicksearch": s.Quicksearch,
+	} {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+	if len(s.Keywords) > 0 {
+		query.Set("keywords", strings.Join(s.Keywords, ","))
+		query.Set("keywords_type", "allwords")
+	}
+	if !s.CreatedAfter.IsZero() {
+		query.Set("creation_time", formatTime(s.CreatedAfter))
+	}
+	if !s.ChangedAfter.IsZero() {
+		query.Set("last_change_time", formatTime(s.ChangedAfter))
+	}
+	custom := 0
+	for _, bound := range []struct {
+		field  string
+		before time.Time
+	}{{"creation_ts", s.CreatedBefore}, {"delta_ts", s.ChangedBefore}} {
+		if bound.before.IsZero() {
+			continue
+		}
+		custom++
+		n := strconv.Itoa(custom)
+		query.Set("f"+n, bound.field)
+		query.Set("o"+n, "lessthan")
+		query.Set("v"+n, formatTime(bound.before))
+	}
+	if s.Limit > 0 {
+		query.Set("limit", strconv.Itoa(s.Limit))
+	}
+	if s.Offset > 0 {
+		query.Set("offset", strconv.Itoa(s.Offset))
+	}
+	if len(s.IncludeFields) > 0 {
+		query.Set("include_fields", strings.Join(s.IncludeFields, ","))
+	}
+	if len(s.ExcludeFields) > 0 {
+		query.Set("exclude_fields", strings.Join(s.ExcludeFields, ","))
+	}
+	if len(query) == 0 {
+		return "/bug"
+	}
+	return "/bug?" + query.Encode()
+}
+
+// formatTime formats the given time as Bugzilla does (E.G. "2021-02-26T00:05:00Z").
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+type SearchResponse struct {
+	Bugs []Bug `json:"bugs"`
+}
@@ -0,0 +1,30 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package comments
+
+import (
+	"fmt"
+
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api"
+)
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/comment.html#create-comments
+type Create struct {
+	BugId      int      `json:"-"`
+	Comment    string   `json:"comment"`
+	IsPrivate  bool     `json:"is_private,omitempty"`
+	IsMarkdown bool     `json:"is_markdown,omitempty"`
+	Tags       []string `json:"comment_tags,omitempty"`
+	api.Post
+	api.Created
+}
+
+func (c *Create) Resource() string {
+	return fmt.Sprintf("/bug/%d/comment", c.BugId)
+}
+
+type CreateResponse struct {
+	Id int `json:"id"`
+}
@@ -0,0 +1,84 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package comments
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api"
+)
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/comment.html#get-comments
+//
+// Since is optional. If set, then only comments made at or after it are returned.
+type Get struct {
+	BugID int
+	Since time.Time
+	api.Get
+	api.Ok
+}
+
+func (g *Get) Resource() string {
+	if g.Since.IsZero() {
+		return fmt.Sprintf("/bug/%d/comment", g.BugID)
+	}
+	return fmt.Sprintf("/bug/%d/comment?new_since=%s", g.BugID, url.QueryEscape(g.Since.UTC().Format(time.RFC3339)))
+}
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/comment.html#get-comments
+type SpecificComment struct {
+	CommentID int
+	api.Get
+	api.Ok
+}
+
+func (s *SpecificComment) Resource() string {
+	return fmt.Sprintf("/bug/comment/%d", s.CommentID)
+}
+
+// GetResponse is the response to both Get and SpecificComment. The comments of a bug
+// are keyed by the bug's ID, and specific comments are keyed by their own IDs.
+type GetResponse struct {
+	Bugs     map[string]BugComments `json:"bugs"`
+	Comments map[string]Comment     `json:"comments"`
+}
+
+type BugComments struct {
+	Comments []Comment `json:"comments"`
+}
+
+type Comment struct {
+	Id int `json:"id"`
+	// Count is the position of the comment within its bug. The description of a bug is comment 0.
+	Count        int    `json:"count"`
+	BugId        int    `json:"bug_id"`
+	AttachmentId *int   `json:"attachment_id"`
+	Text         string `json:"text"`
+	// Creator is the login of the comment's author.
+	Creator      string   `json:"creator"`
+	CreationTime string   `json:"creation_time"`
+	Time         string   `json:"time"`
+	IsPrivate    bool     `json:"is_private"`
+	IsMarkdown   bool     `json:"is_markdown"`
+	Tags         []string `json:"tags"`
+}
+
+// Created returns the time at which the comment was made.
+func (c *Comment) Created() (time.Time, error) {
+	return time.Parse(time.RFC3339, c.CreationTime)
+}
+
+// HasTag returns whether the comment is tagged with the given tag. As with Bugzilla, tags are case insensitive.
+func (c *Comment) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package comments
+
+import (
+	"fmt"
+
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api"
+)
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/comment.html#update-comment-tags
+//
+// The response is the tags of the comment once updated.
+type UpdateTags struct {
+	CommentId int      `json:"comment_id"`
+	Add       []string `json:"add,omitempty"`
+	Remove    []string `json:"remove,omitempty"`
+	api.Put
+	api.Ok
+}
+
+func (u *UpdateTags) Resource() string {
+	return fmt.Sprintf("/bug/comment/%d/tags", u.CommentId)
+}
+
+func AddTags(comment int, tags ...string) *UpdateTags {
+	return &UpdateTags{CommentId: comment, Add: tags}
+}
+
+func RemoveTags(comment int, tags ...string) *UpdateTags {
+	return &UpdateTags{CommentId: comment, Remove: tags}
+}
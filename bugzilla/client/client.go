@@ -6,6 +6,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,22 +15,34 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api/general"
 
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api/attachments"
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/comments"
 
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api"
 
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api/auth"
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api/bugs"
+	"github.com/mozilla/OneCRL-Tools/middleware"
 )
 
+// DefaultTimeout is the timeout given to the inner HTTP client of every newly
+// constructed Client. It bounds any single HTTP exchange (including reading the body),
+// regardless of whether the context provided to a call carries a deadline of its own.
+//
+// See Client.WithTimeout to change this value.
+const DefaultTimeout = time.Minute * 2
+
 type Client struct {
 	host          string
 	base          string
 	authenticator auth.Authenticator
 	inner         *http.Client
+	transport     http.RoundTripper
+	middleware    []middleware.Middleware
 	tool          string
 }
 
@@ -45,7 +58,7 @@ func NewClient(host string) *Client {
 		host:          host,
 		base:          host + "/rest",
 		authenticator: new(auth.Unauthenticated),
-		inner:         new(http.Client),
+		inner:         &http.Client{Timeout: DefaultTimeout},
 		tool:          "https://github.com/mozilla/OneCRL-Tools/bugzilla",
 	}
 }
@@ -66,29 +79,164 @@ func (c *Client) WithToolHeader(tool string) *Client {
 	return c
 }
 
+// WithTimeout sets the timeout for any single HTTP exchange with Bugzilla. A timeout of zero
+// means no timeout, in which case cancellation is only ever done via the contexts given
+// to the *Context family of methods.
+//
+// By default, this is set to DefaultTimeout.
+func (c *Client) WithTimeout(timeout time.Duration) *Client {
+	c.inner.Timeout = timeout
+	return c
+}
+
+// WithHTTPClient sets the HTTP client used for every exchange with Bugzilla (E.G. in order to share a
+// connection pool between clients). The given client is copied rather than modified, and its timeout
+// replaces that set by WithTimeout. Any middleware (see WithMiddleware) wraps the client's transport.
+func (c *Client) WithHTTPClient(client *http.Client) *Client {
+	inner := *client
+	c.inner = &inner
+	c.transport = client.Transport
+	c.inner.Transport = middleware.Chain(c.transport, c.middleware...)
+	return c
+}
+
+// WithTransport sets the transport used for every exchange with Bugzilla (E.G. one that goes through
+// a proxy, trusts a private root, or presents a client certificate; see middleware.Transport).
+// Any middleware (see WithMiddleware) wraps the given transport.
+//
+// By default, this is http.DefaultTransport.
+func (c *Client) WithTransport(transport http.RoundTripper) *Client {
+	c.transport = transport
+	c.inner.Transport = middleware.Chain(c.transport, c.middleware...)
+	return c
+}
+
+// WithMiddleware appends the given middleware (E.G. middleware.Logging) to that which wraps every
+// exchange with Bugzilla. The first middleware ever given is outermost.
+func (c *Client) WithMiddleware(m ...middleware.Middleware) *Client {
+	c.middleware = append(c.middleware, m...)
+	c.inner.Transport = middleware.Chain(c.transport, c.middleware...)
+	return c
+}
+
 func (c *Client) Version() (*general.VersionResponse, error) {
+	return c.VersionContext(context.Background())
+}
+
+// VersionContext is the same as Version, however the request is bound to the given context.
+func (c *Client) VersionContext(ctx context.Context) (*general.VersionResponse, error) {
 	resp := new(general.VersionResponse)
-	return resp, c.do(new(general.Version), resp)
+	return resp, c.do(ctx, new(general.Version), resp)
 }
 
 func (c *Client) CreateBug(bug *bugs.Create) (*bugs.CreateResponse, error) {
+	return c.CreateBugContext(context.Background(), bug)
+}
+
+// CreateBugContext is the same as CreateBug, however the request is bound to the given context.
+func (c *Client) CreateBugContext(ctx context.Context, bug *bugs.Create) (*bugs.CreateResponse, error) {
 	resp := new(bugs.CreateResponse)
-	return resp, c.do(bug, resp)
+	return resp, c.do(ctx, bug, resp)
 }
 
 func (c *Client) GetBug(bug int) (*bugs.GetResponse, error) {
+	return c.GetBugContext(context.Background(), bug)
+}
+
+// GetBugContext is the same as GetBug, however the request is bound to the given context.
+func (c *Client) GetBugContext(ctx context.Context, bug int) (*bugs.GetResponse, error) {
 	resp := new(bugs.GetResponse)
-	return resp, c.do(&bugs.Get{Id: bug}, resp)
+	return resp, c.do(ctx, &bugs.Get{Id: bug}, resp)
+}
+
+// SearchBugs returns every bug that matches the given search (see bugs.Search).
+func (c *Client) SearchBugs(search *bugs.Search) (*bugs.SearchResponse, error) {
+	return c.SearchBugsContext(context.Background(), search)
+}
+
+// SearchBugsContext is the same as SearchBugs, however the request is bound to the given context.
+func (c *Client) SearchBugsContext(ctx context.Context, search *bugs.Search) (*bugs.SearchResponse, error) {
+	resp := new(bugs.SearchResponse)
+	return resp, c.do(ctx, search, resp)
 }
 
 func (c *Client) CreateAttachment(attachment *attachments.Create) (*attachments.CreateResponse, error) {
+	return c.CreateAttachmentContext(context.Background(), attachment)
+}
+
+// CreateAttachmentContext is the same as CreateAttachment, however the request is bound to the given context.
+func (c *Client) CreateAttachmentContext(ctx context.Context, attachment *attachments.Create) (*attachments.CreateResponse, error) {
 	resp := new(attachments.CreateResponse)
-	return resp, c.do(attachment, resp)
+	return resp, c.do(ctx, attachment, resp)
 }
 
 func (c *Client) UpdateBug(bug *bugs.Update) (*bugs.UpdateResponse, error) {
+	return c.UpdateBugContext(context.Background(), bug)
+}
+
+// UpdateBugContext is the same as UpdateBug, however the request is bound to the given context.
+func (c *Client) UpdateBugContext(ctx context.Context, bug *bugs.Update) (*bugs.UpdateResponse, error) {
 	resp := new(bugs.UpdateResponse)
-	return resp, c.do(bug, resp)
+	return resp, c.do(ctx, bug, resp)
+}
+
+// GetComments returns the comments of the given bug, oldest first. If since is not zero,
+// then only the comments made at or after it are returned.
+func (c *Client) GetComments(bug int, since time.Time) ([]comments.Comment, error) {
+	return c.GetCommentsContext(context.Background(), bug, since)
+}
+
+// GetCommentsContext is the same as GetComments, however the request is bound to the given context.
+func (c *Client) GetCommentsContext(ctx context.Context, bug int, since time.Time) ([]comments.Comment, error) {
+	resp := new(comments.GetResponse)
+	if err := c.do(ctx, &comments.Get{BugID: bug, Since: since}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Bugs[strconv.Itoa(bug)].Comments, nil
+}
+
+// GetComment returns the comment with the given ID, regardless of which bug it was made on.
+func (c *Client) GetComment(comment int) (*comments.Comment, error) {
+	return c.GetCommentContext(context.Background(), comment)
+}
+
+// GetCommentContext is the same as GetComment, however the request is bound to the given context.
+func (c *Client) GetCommentContext(ctx context.Context, comment int) (*comments.Comment, error) {
+	resp := new(comments.GetResponse)
+	if err := c.do(ctx, &comments.SpecificComment{CommentID: comment}, resp); err != nil {
+		return nil, err
+	}
+	found, ok := resp.Comments[strconv.Itoa(comment)]
+	if !ok {
+		return nil, fmt.Errorf("comment %d is missing from the response", comment)
+	}
+	return &found, nil
+}
+
+// AddComment adds the given comment (with any tags that it carries) to its bug.
+func (c *Client) AddComment(comment *comments.Create) (*comments.CreateResponse, error) {
+	return c.AddCommentContext(context.Background(), comment)
+}
+
+// AddCommentContext is the same as AddComment, however the request is bound to the given context.
+func (c *Client) AddCommentContext(ctx context.Context, comment *comments.Create) (*comments.CreateResponse, error) {
+	resp := new(comments.CreateResponse)
+	return resp, c.do(ctx, comment, resp)
+}
+
+// UpdateCommentTags adds and removes tags of a comment (see comments.AddTags and
+// comments.RemoveTags), returning every tag of the comment once updated.
+func (c *Client) UpdateCommentTags(tags *comments.UpdateTags) ([]string, error) {
+	return c.UpdateCommentTagsContext(context.Background(), tags)
+}
+
+// UpdateCommentTagsContext is the same as UpdateCommentTags, however the request is bound to the given context.
+func (c *Client) UpdateCommentTagsContext(ctx context.Context, tags *comments.UpdateTags) ([]string, error) {
+	resp := make([]string, 0)
+	if err := c.do(ctx, tags, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 // ShowBug returns a URL formatted for the configured Bugzilla instance
@@ -111,8 +259,8 @@ func (c *Client) IDFromShowBug(url string) (int, error) {
 	return strconv.Atoi(matches[1])
 }
 
-func (c *Client) do(in api.Endpoint, out interface{}) error {
-	req, err := c.newRequest(in)
+func (c *Client) do(ctx context.Context, in api.Endpoint, out interface{}) error {
+	req, err := c.newRequest(ctx, in)
 	if err != nil {
 		return err
 	}
@@ -131,8 +279,8 @@ func (c *Client) do(in api.Endpoint, out interface{}) error {
 	return json.Unmarshal(b, out)
 }
 
-func (c *Client) newRequest(endpoint api.Endpoint) (*http.Request, error) {
-	req, err := http.NewRequest(endpoint.Method(), c.base+endpoint.Resource(), nil)
+func (c *Client) newRequest(ctx context.Context, endpoint api.Endpoint) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, endpoint.Method(), c.base+endpoint.Resource(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -5,96 +5,329 @@
 package client
 
 import (
-	"os"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api/attachments"
 
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api/bugs"
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/comments"
 
 	"github.com/mozilla/OneCRL-Tools/bugzilla/api/auth"
+	"github.com/mozilla/OneCRL-Tools/bugzilla/fake"
+	"github.com/mozilla/OneCRL-Tools/middleware"
 )
 
-func bugzillaDev() *Client {
-	// A good goto is https://bugzilla-dev.allizom.org
-	return NewClient(os.Getenv("BUGZILLA_DEV_HOST")).
-		// Create an account in your target Bugzilla, head
-		// to preferences, and generate an API key for yourself.
-		WithAuth(&auth.ApiKey{os.Getenv("BUGZILLA_DEV_API_KEY")})
+// bugzillaDev returns a client of a fresh fake Bugzilla, authenticated as fake.Login, along with the fake itself.
+func bugzillaDev(t *testing.T) (*Client, *fake.Bugzilla) {
+	b := fake.New()
+	server := httptest.NewServer(b)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL).WithAuth(&auth.ApiKey{ApiKey: fake.APIKey}), b
+}
+
+// newBug files a bug with the given client, returning its ID.
+func newBug(t *testing.T, c *Client) int {
+	resp, err := c.CreateBug(&bugs.Create{
+		Product:     "Core",
+		Component:   "Security: PSM",
+		Summary:     "Tests Should Work",
+		Version:     "69 Branch",
+		Severity:    "normal",
+		Type:        "task",
+		Description: "This is the greatest bug in the world.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Id
 }
 
 func TestVersion(t *testing.T) {
-	_, err := bugzillaDev().Version()
+	c, _ := bugzillaDev(t)
+	version, err := c.Version()
 	if err != nil {
 		t.Fatal(err)
 	}
+	if version.Version != fake.Version {
+		t.Errorf("expected version %s, got %s", fake.Version, version.Version)
+	}
 }
 
 func TestBugCreate(t *testing.T) {
-	bug := &bugs.Create{
-		Product:   "Core",
-		Component: "Security: PSM",
-		Summary:   "Tests Should Work",
-		Version:   "69 Branch",
-		Severity:  "normal",
-		Type:      "task",
+	c, b := bugzillaDev(t)
+	id := newBug(t, c)
+	bug, ok := b.Bug(id)
+	if !ok {
+		t.Fatalf("bug %d was never filed", id)
+	}
+	if bug.Creator != fake.Login || bug.Status != "NEW" || bug.Summary != "Tests Should Work" {
+		t.Errorf("unexpected bug %+v", bug)
+	}
+}
+
+func TestBugCreateRequiredFields(t *testing.T) {
+	c, b := bugzillaDev(t)
+	for _, tc := range []struct {
+		name string
+		bug  bugs.Create
+		want string
+	}{
+		{"product", bugs.Create{Component: "Security: PSM", Summary: "s", Version: "Trunk"}, "You must select/enter a product."},
+		{"component", bugs.Create{Product: "Core", Summary: "s", Version: "Trunk"}, "You must select/enter a component."},
+		{"version", bugs.Create{Product: "Core", Component: "Security: PSM", Summary: "s"}, "You must select/enter a version."},
+		{"summary", bugs.Create{Product: "Core", Component: "Security: PSM", Version: "Trunk"}, "You must enter a summary for this bug."},
+		{"unknown component", bugs.Create{Product: "Core", Component: "DOM", Summary: "s", Version: "Trunk"}, "There is no component named 'DOM' in the 'Core' product."},
+		{"unknown cc", bugs.Create{Product: "Core", Component: "Security: PSM", Summary: "s", Version: "Trunk", Cc: []string{"who@example.com"}}, "There is no user named 'who@example.com'."},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := c.CreateBug(&tc.bug)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
 	}
-	_, err := bugzillaDev().CreateBug(bug)
+	if b.Bugs() != 0 {
+		t.Errorf("expected no bugs to be filed, got %d", b.Bugs())
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	c, _ := bugzillaDev(t)
+	id := newBug(t, c)
+	for _, tc := range []struct {
+		name          string
+		authenticator auth.Authenticator
+		want          string
+	}{
+		{"anonymous", new(auth.Unauthenticated), `"code":410`},
+		{"invalid key", &auth.ApiKey{ApiKey: "not a key"}, `"code":306`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c.WithAuth(tc.authenticator)
+			_, err := c.UpdateBug(bugs.AddComment(id, "Who goes there?"))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+	// Anyone may read a (public) bug.
+	c.WithAuth(new(auth.Unauthenticated))
+	if _, err := c.GetBug(id); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetBug(t *testing.T) {
+	c, _ := bugzillaDev(t)
+	id := newBug(t, c)
+	resp, err := c.GetBug(id)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(resp.Bugs) != 1 || resp.Bugs[0].ID != id || resp.Bugs[0].Component != "Security: PSM" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	_, err = c.GetBug(id + 1)
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected a missing bug error, got %v", err)
+	}
 }
 
-func TestGetBug(t *testing.T) {
-	_, err := bugzillaDev().GetBug(1548159)
+func TestSearchBugs(t *testing.T) {
+	c, _ := bugzillaDev(t)
+	for i := 0; i < 3; i++ {
+		newBug(t, c)
+	}
+	_, err := c.UpdateBug(&bugs.Update{Id: 2, Whiteboard: "[ccadb]", Keywords: &bugs.AddRemoveSetString{Add: []string{"sec-want", "regression"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.UpdateBug(bugs.Invalidate(3, "Not so much."))
 	if err != nil {
 		t.Fatal(err)
 	}
+	hour := time.Now().Add(time.Hour)
+	for _, tc := range []struct {
+		name   string
+		search *bugs.Search
+		want   []int
+	}{
+		{"ids", new(bugs.Search).AddBugs(1, 3), []int{1, 3}},
+		{"everything", new(bugs.Search).AddProducts("Core").AddComponents("Security: PSM").AddCreators(fake.Login), []int{1, 2, 3}},
+		{"open", new(bugs.Search).AddStatuses(bugs.OpenStatuses...), []int{1, 2}},
+		{"resolution", new(bugs.Search).AddResolutions("INVALID", "WONTFIX"), []int{3}},
+		{"summary", new(bugs.Search).WithSummary("should work"), []int{1, 2, 3}},
+		{"whiteboard", new(bugs.Search).WithWhiteboard("ccadb"), []int{2}},
+		{"keywords", new(bugs.Search).AddKeywords("regression", "sec-want"), []int{2}},
+		{"missing keyword", new(bugs.Search).AddKeywords("regression", "crash"), []int{}},
+		{"created", new(bugs.Search).CreatedBetween(hour.Add(-time.Hour*2), hour), []int{1, 2, 3}},
+		{"created later", new(bugs.Search).CreatedBetween(hour, time.Time{}), []int{}},
+		{"changed earlier", new(bugs.Search).ChangedBetween(time.Time{}, hour.Add(-time.Hour*2)), []int{}},
+		{"quicksearch", new(bugs.Search).WithQuicksearch("ALL kw:regression tests"), []int{2}},
+		{"quicksearch open", new(bugs.Search).WithQuicksearch("comp:PSM"), []int{1, 2}},
+		{"page", new(bugs.Search).AddProducts("Core").Page(1, 1), []int{2}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := c.SearchBugs(tc.search)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int, 0)
+			for _, bug := range resp.Bugs {
+				got = append(got, bug.ID)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected bugs %v, got %v", tc.want, got)
+			}
+		})
+	}
+	resp, err := c.SearchBugs(new(bugs.Search).AddBug(2).Include("id", "summary", "whiteboard"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Bugs) != 1 || resp.Bugs[0].Whiteboard != "[ccadb]" || resp.Bugs[0].Product != "" {
+		t.Errorf("expected only the included fields, got %+v", resp.Bugs)
+	}
 }
 
 func TestInvalidate(t *testing.T) {
-	_, err := bugzillaDev().UpdateBug(bugs.Invalidate(1628766, "This isn't the greatest song in the world."))
+	c, b := bugzillaDev(t)
+	id := newBug(t, c)
+	resp, err := c.UpdateBug(bugs.Invalidate(id, "This isn't the greatest song in the world."))
 	if err != nil {
 		t.Fatal(err)
 	}
+	want := bugs.Change{Removed: "", Added: "INVALID"}
+	if len(resp.Bugs) != 1 || resp.Bugs[0].Changes["resolution"] != want {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	bug, _ := b.Bug(id)
+	if bug.Status != "RESOLVED" || bug.Resolution != "INVALID" || bug.IsOpen {
+		t.Errorf("unexpected bug %+v", bug)
+	}
+	// A closed bug must have a resolution.
+	_, err = c.UpdateBug(&bugs.Update{Id: id, Status: "VERIFIED", Resolution: "NOTABUG"})
+	if err == nil || !strings.Contains(err.Error(), "There is no Resolution called 'NOTABUG'.") {
+		t.Errorf("expected an invalid resolution error, got %v", err)
+	}
 }
 
 func TestAddComment(t *testing.T) {
-	_, err := bugzillaDev().UpdateBug(bugs.AddComment(1628766, "No, this is just a tribute."))
+	c, b := bugzillaDev(t)
+	id := newBug(t, c)
+	_, err := c.UpdateBug(bugs.AddComment(id, "No, this is just a tribute."))
 	if err != nil {
 		t.Fatal(err)
 	}
+	comments := b.Comments(id)
+	if len(comments) != 2 || comments[1].Text != "No, this is just a tribute." {
+		t.Errorf("unexpected comments %+v", comments)
+	}
+}
+
+func TestComments(t *testing.T) {
+	c, _ := bugzillaDev(t)
+	id := newBug(t, c)
+	created, err := c.AddComment(&comments.Create{BugId: id, Comment: "Between you and me", IsPrivate: true, Tags: []string{"secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetComments(id, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Text != "This is the greatest bug in the world." || got[1].Id != created.Id ||
+		!got[1].IsPrivate || !got[1].HasTag("SECRET") || got[1].Creator != fake.Login {
+		t.Errorf("unexpected comments %+v", got)
+	}
+	if got, err := c.GetComments(id, time.Now().Add(time.Hour)); err != nil || len(got) != 0 {
+		t.Errorf("expected no comments since an hour from now, got %+v %v", got, err)
+	}
+	tags, err := c.UpdateCommentTags(comments.AddTags(created.Id, "tribute", "Secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"secret", "tribute"}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	if _, err := c.UpdateCommentTags(comments.RemoveTags(created.Id, "SECRET")); err != nil {
+		t.Fatal(err)
+	}
+	comment, err := c.GetComment(created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(comment.Tags, []string{"tribute"}) {
+		t.Errorf("unexpected comment %+v", comment)
+	}
+	// Private comments are hidden from those who are not logged in.
+	c.WithAuth(new(auth.Unauthenticated))
+	if got, err := c.GetComments(id, time.Time{}); err != nil || len(got) != 1 {
+		t.Errorf("expected only the description, got %+v %v", got, err)
+	}
+	if _, err := c.GetComment(created.Id); err == nil {
+		t.Error("expected a private comment to be refused")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	c, b := bugzillaDev(t)
+	id := newBug(t, c)
+	_, err := c.UpdateBug(&bugs.Update{Id: id, Flags: []bugs.UpdateFlag{{Name: "needinfo", Status: "?", Requestee: fake.Login}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bug, _ := b.Bug(id)
+	if len(bug.Flags) != 1 || bug.Flags[0].Status != "?" || bug.Flags[0].Requestee != fake.Login {
+		t.Fatalf("unexpected flags %+v", bug.Flags)
+	}
+	resp, err := c.UpdateBug(&bugs.Update{Id: id, Flags: []bugs.UpdateFlag{{Id: bug.Flags[0].Id, Status: "X"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bugs.Change{Removed: "needinfo?(" + fake.Login + ")"}
+	if resp.Bugs[0].Changes["flagtypes.name"] != want {
+		t.Errorf("unexpected changes %+v", resp.Bugs[0].Changes)
+	}
+	if bug, _ = b.Bug(id); len(bug.Flags) != 0 {
+		t.Errorf("expected the flag to be cleared, got %+v", bug.Flags)
+	}
 }
 
-// It is worth noting that this "fails" on https://bugzilla-dev.allizom.org. You will receive the following...
-//
-// 		Failed to fetch attachment ID 9139509 from S3: The requested key was not found
-//
-// However, if you browse to the target bug you will absolutely see the attachment present.
-//
-// If I had to guess, the code is something like...
-//
-//	id := db.InsertAttachment()
-//	return db.GetAttachment(id).id
-//
-// ...and that database is failing to find an attachment it just inserted moments ago.
 func TestAttachment(t *testing.T) {
+	c, b := bugzillaDev(t)
+	id := newBug(t, c)
 	attach := &attachments.Create{
-		BugId:       1628767,
+		BugId:       id,
 		Data:        []byte("Couldn't remember the greatest song in the world."),
 		FileName:    "tenacious.txt",
 		Summary:     "This is just a tribute!",
 		ContentType: "text/plain",
 	}
-	_, err := bugzillaDev().CreateAttachment(attach.AddBug(1628767))
+	resp, err := c.CreateAttachment(attach.AddBug(id))
 	if err != nil {
-		// @TODO change to Fatal when we figure out the above issue with Bugzilla.
-		t.Log(err)
+		t.Fatal(err)
+	}
+	got := b.Attachments(id)
+	if len(resp.Ids) != 1 || len(got) != 1 || got[0].Id != resp.Ids[0] || got[0].FileName != "tenacious.txt" {
+		t.Errorf("unexpected attachments %+v for response %+v", got, resp)
+	}
+	attach.Summary = ""
+	_, err = c.CreateAttachment(attach)
+	if err == nil || !strings.Contains(err.Error(), "You must enter a description for the attachment.") {
+		t.Errorf("expected a missing summary error, got %v", err)
 	}
 }
 
 func TestClient_IDFromShowBug(t *testing.T) {
-	c := bugzillaDev()
+	c := NewClient("https://bugzilla-dev.allizom.org")
 	got, err := c.IDFromShowBug("https://bugzilla-dev.allizom.org/show_bug.cgi?id=1629069")
 	if err != nil {
 		t.Fatal(err)
@@ -106,9 +339,51 @@ func TestClient_IDFromShowBug(t *testing.T) {
 }
 
 func TestClient_IDFromShowBugErr(t *testing.T) {
-	c := bugzillaDev()
+	c := NewClient("https://bugzilla-dev.allizom.org")
 	got, err := c.IDFromShowBug("https://bugzilla-dev.allizom.org/show_bug.cgi?ids=1629069")
 	if err == nil {
 		t.Fatalf("expected an empty match error, got the id %d", got)
 	}
 }
+
+func TestContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err := NewClient(server.URL).GetBugContext(ctx, 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+}
+
+func TestTransportAndMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Via") != "proxy" || r.Header.Get("X-Source") != "cron" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		_, _ = w.Write([]byte(`{"version": "20210226.1"}`))
+	}))
+	defer server.Close()
+	// Stands in for, say, a transport that goes through a proxy.
+	transport := middleware.Header("X-Via", "proxy")(http.DefaultTransport)
+	observed := 0
+	c := NewClient(server.URL).
+		WithMiddleware(middleware.Header("X-Source", "cron")).
+		WithTransport(transport).
+		WithMiddleware(middleware.Observe(func(_ *http.Request, _ *http.Response, _ error, _ time.Duration) { observed++ }))
+	version, err := c.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Version != "20210226.1" || observed != 1 {
+		t.Errorf("unexpected version %v after %d exchanges", version, observed)
+	}
+}
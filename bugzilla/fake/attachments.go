@@ -0,0 +1,149 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package fake
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/attachments"
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/bugs"
+)
+
+// createAttachment attaches the given file to the bug of the path, as well as to every bug within its "ids".
+//
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/attachment.html#create-attachment
+func (b *Bugzilla) createAttachment(r *request, idOrAlias string) (int, interface{}, *bugzillaError) {
+	if r.user == "" {
+		return 0, nil, loginRequired()
+	}
+	bug, err := b.lookup(idOrAlias)
+	if err != nil {
+		return 0, nil, err
+	}
+	in := new(attachments.Create)
+	if err := decode(r, in); err != nil {
+		return 0, nil, err
+	}
+	targets := []*bugs.Bug{bug}
+	for _, id := range in.Ids {
+		other, err := b.lookup(strconv.Itoa(id))
+		if err != nil {
+			return 0, nil, err
+		}
+		if other != bug {
+			targets = append(targets, other)
+		}
+	}
+	switch {
+	case len(in.Data) == 0:
+		return 0, nil, newError(http.StatusBadRequest, codeParamRequired, "The file you are trying to attach is empty.")
+	case strings.TrimSpace(in.FileName) == "":
+		return 0, nil, newError(http.StatusBadRequest, codeParamRequired, "You must enter a file name for the attachment.")
+	case strings.TrimSpace(in.Summary) == "":
+		return 0, nil, newError(http.StatusBadRequest, codeParamRequired, "You must enter a description for the attachment.")
+	case in.IsPatch:
+		in.ContentType = "text/plain"
+	case !strings.Contains(in.ContentType, "/"):
+		return 0, nil, invalid("Valid types must be of the form foo/bar where foo is one of "+
+			"application, audio, image, message, model, multipart, text, video. '%s' is not.", in.ContentType)
+	}
+	flags := make([]attachments.Flag, 0, len(in.Flags))
+	for _, f := range in.Flags {
+		if !contains([]string{"?", "+", "-"}, f.Status) {
+			return 0, nil, invalid("The flag status '%s' is invalid.", f.Status)
+		}
+		name, typeID, err := b.flagType(f.Name, f.TypeId)
+		if err != nil {
+			return 0, nil, err
+		}
+		b.flags++
+		flags = append(flags, attachments.Flag{
+			Id:                b.flags,
+			Name:              name,
+			TypeId:            typeID,
+			CreationDate:      now(),
+			Modification_date: now(),
+			Status:            f.Status,
+			Setter:            r.user,
+			Requestee:         f.Requestee,
+		})
+	}
+	ids := make([]int, 0, len(targets))
+	for _, target := range targets {
+		created := now()
+		a := &attachments.GetResponse{
+			Data:           base64.StdEncoding.EncodeToString(in.Data),
+			Size:           len(in.Data),
+			CreationTime:   created,
+			LastChangeTime: created,
+			Id:             len(b.attachments) + 1,
+			BugId:          target.ID,
+			FileName:       in.FileName,
+			Summary:        in.Summary,
+			ContentType:    in.ContentType,
+			IsPrivate:      in.IsPrivate,
+			IsPatch:        in.IsPatch,
+			Creator:        r.user,
+			Flags:          flags,
+		}
+		b.attachments = append(b.attachments, a)
+		ids = append(ids, a.Id)
+		text := fmt.Sprintf("Created attachment %d\n%s", a.Id, a.Summary)
+		if in.Comment != "" {
+			text += "\n\n" + in.Comment
+		}
+		b.newComment(target, r.user, text, in.IsPrivate, in.IsMarkdown, nil, &a.Id)
+	}
+	return http.StatusCreated, &attachments.CreateResponse{Ids: ids}, nil
+}
+
+// listAttachments serves the attachments of a bug. Private attachments are hidden from anonymous requests.
+//
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/attachment.html#get-attachment
+func (b *Bugzilla) listAttachments(r *request, idOrAlias string) (int, interface{}, *bugzillaError) {
+	bug, err := b.lookup(idOrAlias)
+	if err != nil {
+		return 0, nil, err
+	}
+	found := make([]interface{}, 0)
+	for _, a := range b.attachments {
+		if a.BugId != bug.ID || (a.IsPrivate && r.user == "") {
+			continue
+		}
+		projected, err := project(r, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		found = append(found, projected)
+	}
+	return http.StatusOK, map[string]interface{}{
+		"bugs":        map[string]interface{}{strconv.Itoa(bug.ID): found},
+		"attachments": map[string]interface{}{},
+	}, nil
+}
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/attachment.html#get-attachment
+func (b *Bugzilla) attachment(r *request, idParam string) (int, interface{}, *bugzillaError) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil || id < 1 || id > len(b.attachments) {
+		return 0, nil, newError(http.StatusNotFound, codeObjectNotFound, "Attachment #%s does not exist.", idParam)
+	}
+	a := b.attachments[id-1]
+	if a.IsPrivate && r.user == "" {
+		return 0, nil, newError(http.StatusUnauthorized, codeLoginRequired, "Sorry, you are not authorized to access attachment #%d.", id)
+	}
+	projected, perr := project(r, a)
+	if perr != nil {
+		return 0, nil, perr
+	}
+	return http.StatusOK, map[string]interface{}{
+		"bugs":        map[string]interface{}{},
+		"attachments": map[string]interface{}{idParam: projected},
+	}, nil
+}
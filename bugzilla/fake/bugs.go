@@ -0,0 +1,868 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/bugs"
+)
+
+var resolutions = []string{"FIXED", "INVALID", "WONTFIX", "DUPLICATE", "WORKSFORME", "INCOMPLETE", "INACTIVE", "MOVED"}
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/bug.html#create-bug
+func (b *Bugzilla) create(r *request) (int, interface{}, *bugzillaError) {
+	if r.user == "" {
+		return 0, nil, loginRequired()
+	}
+	in := new(bugs.Create)
+	if err := decode(r, in); err != nil {
+		return 0, nil, err
+	}
+	if err := b.validProduct(in.Product, in.Component, in.Version); err != nil {
+		return 0, nil, err
+	}
+	if strings.TrimSpace(in.Summary) == "" {
+		return 0, nil, newError(http.StatusBadRequest, codeParamRequired, "You must enter a summary for this bug.")
+	}
+	status, resolution := "NEW", in.Resolution
+	if in.Status != "" {
+		status = in.Status
+	}
+	if err := validStatus(status, resolution); err != nil {
+		return 0, nil, err
+	}
+	assignee := Nobody
+	if in.AssignedTo != "" {
+		assignee = in.AssignedTo
+	}
+	for _, login := range append([]string{assignee}, in.Cc...) {
+		if err := b.validUser(login); err != nil {
+			return 0, nil, err
+		}
+	}
+	if in.QaContact != "" {
+		if err := b.validUser(in.QaContact); err != nil {
+			return 0, nil, err
+		}
+	}
+	if err := b.validAliases(0, in.Alias); err != nil {
+		return 0, nil, err
+	}
+	if err := validTags(in.CommentTags); err != nil {
+		return 0, nil, err
+	}
+	created := now()
+	bug := &bugs.Bug{
+		ID:                  len(b.bugs) + 1,
+		Alias:               append([]string{}, in.Alias...),
+		AssignedTo:          assignee,
+		AssignedToDetail:    bugs.User{Name: assignee, RealName: assignee},
+		Blocks:              []int{},
+		CC:                  append([]string{}, in.Cc...),
+		Classification:      "Components",
+		Component:           in.Component,
+		CreationTime:        created,
+		Creator:             r.user,
+		CreatorDetail:       bugs.User{Name: r.user, RealName: r.user},
+		DependsOn:           []int{},
+		Flags:               []bugs.GetFlag{},
+		Groups:              append([]string{}, in.Groups...),
+		IsCcAccessible:      true,
+		IsConfirmed:         status != "UNCONFIRMED",
+		IsOpen:              contains(bugs.OpenStatuses, status),
+		IsCreatorAccessible: true,
+		Keywords:            append([]string{}, in.Keywords...),
+		LastChangeTime:      created,
+		OpSys:               or(in.OpSys, "Unspecified"),
+		Platform:            or(in.Platform, "Unspecified"),
+		Priority:            or(in.Priority, "--"),
+		Product:             in.Product,
+		QaContact:           in.QaContact,
+		Resolution:          resolution,
+		SeeAlso:             []string{},
+		Severity:            or(in.Severity, "--"),
+		Status:              status,
+		Summary:             in.Summary,
+		TargetMilestone:     or(in.TargetMilestone, "---"),
+		Version:             in.Version,
+	}
+	for _, f := range in.Flags {
+		if _, err := b.setFlag(r, bug, bugs.UpdateFlag{Name: f.Name, TypeId: f.TypeId, Status: f.Status, Requestee: f.Requestee, New: true}); err != nil {
+			return 0, nil, err
+		}
+	}
+	b.bugs = append(b.bugs, bug)
+	b.newComment(bug, r.user, in.Description, in.CommentIsPrivate, in.IsMarkdown, in.CommentTags, nil)
+	return http.StatusOK, &bugs.CreateResponse{Id: bug.ID}, nil
+}
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/bug.html#get-bug
+func (b *Bugzilla) get(r *request, idOrAlias string) (int, interface{}, *bugzillaError) {
+	bug, err := b.lookup(idOrAlias)
+	if err != nil {
+		return 0, nil, err
+	}
+	projected, err := project(r, bug)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, map[string]interface{}{"bugs": []interface{}{projected}, "faults": []interface{}{}}, nil
+}
+
+// The search parameters that match a field of a bug exactly (albeit case insensitively).
+var exactly = map[string]func(bug *bugs.Bug) string{
+	"product":          func(bug *bugs.Bug) string { return bug.Product },
+	"component":        func(bug *bugs.Bug) string { return bug.Component },
+	"version":          func(bug *bugs.Bug) string { return bug.Version },
+	"status":           func(bug *bugs.Bug) string { return bug.Status },
+	"resolution":       func(bug *bugs.Bug) string { return bug.Resolution },
+	"creator":          func(bug *bugs.Bug) string { return bug.Creator },
+	"assigned_to":      func(bug *bugs.Bug) string { return bug.AssignedTo },
+	"qa_contact":       func(bug *bugs.Bug) string { return bug.QaContact },
+	"priority":         func(bug *bugs.Bug) string { return bug.Priority },
+	"severity":         func(bug *bugs.Bug) string { return bug.Severity },
+	"op_sys":           func(bug *bugs.Bug) string { return bug.OpSys },
+	"platform":         func(bug *bugs.Bug) string { return bug.Platform },
+	"target_milestone": func(bug *bugs.Bug) string { return bug.TargetMilestone },
+}
+
+// The search parameters that match any bug whose field contains them (case insensitively).
+var partially = map[string]func(bug *bugs.Bug) string{
+	"summary":    func(bug *bugs.Bug) string { return bug.Summary },
+	"whiteboard": func(bug *bugs.Bug) string { return bug.Whiteboard },
+}
+
+// search serves the bugs that match every given search parameter. Where a parameter is given more
+// than once (or, for IDs, is comma separated), then a bug need only match one of its values.
+//
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/bug.html#search-bugs
+func (b *Bugzilla) search(r *request) (int, interface{}, *bugzillaError) {
+	filters := make([]func(bug *bugs.Bug) bool, 0)
+	for param, field := range exactly {
+		// Unlike IDs, these are not comma separated, as a comma may well be part of a value (E.G. of a component).
+		wanted := r.URL.Query()[param]
+		if len(wanted) == 0 {
+			continue
+		}
+		field := field
+		filters = append(filters, func(bug *bugs.Bug) bool {
+			for _, w := range wanted {
+				if strings.EqualFold(field(bug), w) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	for param, field := range partially {
+		wanted := r.URL.Query()[param]
+		if len(wanted) == 0 {
+			continue
+		}
+		field := field
+		filters = append(filters, func(bug *bugs.Bug) bool {
+			for _, w := range wanted {
+				if strings.Contains(strings.ToLower(field(bug)), strings.ToLower(w)) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if ids := values(r, "id"); len(ids) > 0 {
+		filters = append(filters, func(bug *bugs.Bug) bool {
+			return contains(ids, strconv.Itoa(bug.ID))
+		})
+	}
+	if aliases := values(r, "alias"); len(aliases) > 0 {
+		filters = append(filters, func(bug *bugs.Bug) bool {
+			for _, alias := range bug.Alias {
+				if contains(aliases, alias) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	for _, param := range []string{"creation_time", "last_change_time"} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		since, ok := parseTime(value)
+		if !ok {
+			return 0, nil, newError(http.StatusBadRequest, codeParamInvalid, "'%s' is not a legal date.", value)
+		}
+		param := param
+		filters = append(filters, func(bug *bugs.Bug) bool {
+			t := bug.CreationTime
+			if param == "last_change_time" {
+				t = bug.LastChangeTime
+			}
+			at, _ := parseTime(t)
+			return !at.Before(since)
+		})
+	}
+	if keywords := values(r, "keywords"); len(keywords) > 0 {
+		match, err := keywordsMatcher(keywords, r.URL.Query().Get("keywords_type"))
+		if err != nil {
+			return 0, nil, err
+		}
+		filters = append(filters, match)
+	}
+	custom, err := customSearch(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	filters = append(filters, custom...)
+	if q := r.URL.Query().Get("quicksearch"); q != "" {
+		filters = append(filters, quicksearch(q))
+	}
+	limit, offset, err := paging(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	found := make([]interface{}, 0)
+	for _, bug := range b.bugs {
+		if !all(filters, bug) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit > 0 && len(found) == limit {
+			break
+		}
+		projected, err := project(r, bug)
+		if err != nil {
+			return 0, nil, err
+		}
+		found = append(found, projected)
+	}
+	return http.StatusOK, map[string]interface{}{"bugs": found}, nil
+}
+
+// keywordsMatcher matches bugs by their keywords, as per the given keywords_type (allwords by default).
+func keywordsMatcher(keywords []string, kind string) (func(bug *bugs.Bug) bool, *bugzillaError) {
+	count := func(bug *bugs.Bug) int {
+		n := 0
+		for _, k := range keywords {
+			for _, has := range bug.Keywords {
+				if strings.EqualFold(k, has) {
+					n++
+					break
+				}
+			}
+		}
+		return n
+	}
+	switch kind {
+	case "", "allwords":
+		return func(bug *bugs.Bug) bool { return count(bug) == len(keywords) }, nil
+	case "anywords":
+		return func(bug *bugs.Bug) bool { return count(bug) > 0 }, nil
+	case "nowords":
+		return func(bug *bugs.Bug) bool { return count(bug) == 0 }, nil
+	}
+	return nil, invalid("'%s' is not a valid keywords_type.", kind)
+}
+
+// The fields of a custom search (the f1, o1, v1 family of parameters) that a fake Bugzilla understands, all of which are times.
+var customFields = map[string]func(bug *bugs.Bug) string{
+	"creation_ts": func(bug *bugs.Bug) string { return bug.CreationTime },
+	"delta_ts":    func(bug *bugs.Bug) string { return bug.LastChangeTime },
+}
+
+// customSearch returns a filter for each criterion of the custom search of the given request.
+//
+// For details, please see:
+// https://bugzilla.readthedocs.io/en/latest/using/finding.html#custom-search
+func customSearch(r *request) ([]func(bug *bugs.Bug) bool, *bugzillaError) {
+	filters := make([]func(bug *bugs.Bug) bool, 0)
+	query := r.URL.Query()
+	for n := 1; query.Get("f"+strconv.Itoa(n)) != ""; n++ {
+		i := strconv.Itoa(n)
+		field, operator, value := query.Get("f"+i), query.Get("o"+i), query.Get("v"+i)
+		get, ok := customFields[field]
+		if !ok {
+			return nil, newError(http.StatusBadRequest, codeObjectNotFound, "Can't use %s as a field name.", field)
+		}
+		at, ok := parseTime(value)
+		if !ok {
+			return nil, newError(http.StatusBadRequest, codeParamInvalid, "'%s' is not a legal date.", value)
+		}
+		var compare func(t time.Time) bool
+		switch operator {
+		case "lessthan":
+			compare = func(t time.Time) bool { return t.Before(at) }
+		case "lessthaneq":
+			compare = func(t time.Time) bool { return !t.After(at) }
+		case "greaterthan":
+			compare = func(t time.Time) bool { return t.After(at) }
+		case "greaterthaneq":
+			compare = func(t time.Time) bool { return !t.Before(at) }
+		case "equals":
+			compare = func(t time.Time) bool { return t.Equal(at) }
+		default:
+			return nil, invalid("Can't use %s as an operator for %s.", operator, field)
+		}
+		filters = append(filters, func(bug *bugs.Bug) bool {
+			t, _ := parseTime(get(bug))
+			return compare(t)
+		})
+	}
+	return filters, nil
+}
+
+// The fields that a term of a quicksearch may name (E.G. "comp:PSM"), by each of their names.
+var quickFields = map[string]func(bug *bugs.Bug) []string{
+	"product":           func(bug *bugs.Bug) []string { return []string{bug.Product} },
+	"prod":              func(bug *bugs.Bug) []string { return []string{bug.Product} },
+	"component":         func(bug *bugs.Bug) []string { return []string{bug.Component} },
+	"comp":              func(bug *bugs.Bug) []string { return []string{bug.Component} },
+	"summary":           func(bug *bugs.Bug) []string { return []string{bug.Summary} },
+	"whiteboard":        func(bug *bugs.Bug) []string { return []string{bug.Whiteboard} },
+	"status_whiteboard": func(bug *bugs.Bug) []string { return []string{bug.Whiteboard} },
+	"sw":                func(bug *bugs.Bug) []string { return []string{bug.Whiteboard} },
+	"keywords":          func(bug *bugs.Bug) []string { return bug.Keywords },
+	"kw":                func(bug *bugs.Bug) []string { return bug.Keywords },
+	"reporter":          func(bug *bugs.Bug) []string { return []string{bug.Creator} },
+	"assignee":          func(bug *bugs.Bug) []string { return []string{bug.AssignedTo} },
+	"resolution":        func(bug *bugs.Bug) []string { return []string{bug.Resolution} },
+}
+
+// quicksearch matches bugs against the given quicksearch, of which a fake Bugzilla understands a subset:
+//
+//   - An optional leading status: ALL, OPEN, or a comma separated list of statuses. By default, only open bugs match.
+//   - Terms naming a field (E.G. "comp:PSM" or "kw:regression,crash"), which match bugs whose field contains any of the values.
+//   - Bug numbers, which match that bug.
+//   - Any other word, which matches bugs whose summary, whiteboard, product, component, or keywords contain it.
+//
+// Every term must match, and all matching is case insensitive.
+//
+// For details, please see:
+// https://bugzilla.mozilla.org/page.cgi?id=quicksearch.html
+func quicksearch(q string) func(bug *bugs.Bug) bool {
+	terms := strings.Fields(q)
+	statuses := bugs.OpenStatuses
+	if len(terms) > 0 {
+		switch first := strings.ToUpper(terms[0]); {
+		case first == "ALL":
+			statuses, terms = nil, terms[1:]
+		case first == "OPEN":
+			terms = terms[1:]
+		case allStatuses(strings.Split(first, ",")):
+			statuses, terms = strings.Split(first, ","), terms[1:]
+		}
+	}
+	return func(bug *bugs.Bug) bool {
+		if statuses != nil && !contains(statuses, bug.Status) {
+			return false
+		}
+		for _, term := range terms {
+			if id, err := strconv.Atoi(strings.TrimPrefix(term, "#")); err == nil {
+				if bug.ID != id {
+					return false
+				}
+				continue
+			}
+			fields := []string{bug.Summary, bug.Whiteboard, bug.Product, bug.Component}
+			fields = append(fields, bug.Keywords...)
+			wanted := []string{term}
+			if parts := strings.SplitN(term, ":", 2); len(parts) == 2 {
+				if field, ok := quickFields[strings.ToLower(parts[0])]; ok {
+					fields, wanted = field(bug), strings.Split(parts[1], ",")
+				}
+			}
+			if !containsAny(fields, wanted) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func allStatuses(statuses []string) bool {
+	for _, status := range statuses {
+		if !contains(bugs.OpenStatuses, status) && !contains(bugs.ClosedStatuses, status) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAny returns whether any of the given fields contains any of the given values (case insensitively).
+func containsAny(fields, values []string) bool {
+	for _, field := range fields {
+		for _, value := range values {
+			if value != "" && strings.Contains(strings.ToLower(field), strings.ToLower(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func all(filters []func(bug *bugs.Bug) bool, bug *bugs.Bug) bool {
+	for _, f := range filters {
+		if !f(bug) {
+			return false
+		}
+	}
+	return true
+}
+
+// paging returns the limit and offset query parameters of the given request. A limit of zero means no limit.
+func paging(r *request) (int, int, *bugzillaError) {
+	parsed := make([]int, 2)
+	for i, param := range []string{"limit", "offset"} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, newError(http.StatusBadRequest, codeParamInvalid, "Invalid %s: '%s' is not a positive integer.", param, value)
+		}
+		parsed[i] = n
+	}
+	return parsed[0], parsed[1], nil
+}
+
+// update applies the given update to every bug it targets, or to none of them should any change be invalid.
+//
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/bug.html#update-bug
+func (b *Bugzilla) update(r *request, idOrAlias string) (int, interface{}, *bugzillaError) {
+	if r.user == "" {
+		return 0, nil, loginRequired()
+	}
+	in := new(bugs.Update)
+	if err := decode(r, in); err != nil {
+		return 0, nil, err
+	}
+	if err := validTags(in.CommentTags); err != nil {
+		return 0, nil, err
+	}
+	targets := []string{idOrAlias}
+	if len(in.Ids) > 0 {
+		targets = targets[:0]
+		for _, id := range in.Ids {
+			targets = append(targets, strconv.Itoa(id))
+		}
+	}
+	updated := make([]*bugs.Bug, len(targets))
+	resp := &bugs.UpdateResponse{Bugs: make([]bugs.BugUpdate, len(targets))}
+	for i, target := range targets {
+		bug, err := b.lookup(target)
+		if err != nil {
+			return 0, nil, err
+		}
+		updated[i] = clone(bug)
+		changes, err := b.apply(r, updated[i], in)
+		if err != nil {
+			return 0, nil, err
+		}
+		resp.Bugs[i] = bugs.BugUpdate{Id: bug.ID, Alias: updated[i].Alias, Changes: changes}
+	}
+	commented := in.Comment != nil && strings.TrimSpace(in.Comment.Body) != ""
+	for i, bug := range updated {
+		if len(resp.Bugs[i].Changes) > 0 || commented {
+			bug.LastChangeTime = now()
+		}
+		resp.Bugs[i].LastChangeTime = bug.LastChangeTime
+		b.bugs[bug.ID-1] = bug
+		if commented {
+			b.newComment(bug, r.user, in.Comment.Body, false, false, in.CommentTags, nil)
+		}
+	}
+	return http.StatusOK, resp, nil
+}
+
+// apply makes the changes of the given update to the given bug, returning what changed.
+func (b *Bugzilla) apply(r *request, bug *bugs.Bug, in *bugs.Update) (map[string]bugs.Change, *bugzillaError) {
+	changes := make(map[string]bugs.Change)
+	set := func(field string, value *string, to string) {
+		if to != "" && to != *value {
+			changes[field] = bugs.Change{Removed: *value, Added: to}
+			*value = to
+		}
+	}
+	product, component, version := or(in.Product, bug.Product), or(in.Component, bug.Component), or(in.Version, bug.Version)
+	if err := b.validProduct(product, component, version); err != nil {
+		return nil, err
+	}
+	set("product", &bug.Product, product)
+	set("component", &bug.Component, component)
+	set("version", &bug.Version, version)
+	if in.Summary != "" && strings.TrimSpace(in.Summary) == "" {
+		return nil, newError(http.StatusBadRequest, codeParamRequired, "You must enter a summary for this bug.")
+	}
+	set("summary", &bug.Summary, in.Summary)
+	set("whiteboard", &bug.Whiteboard, in.Whiteboard)
+	set("priority", &bug.Priority, in.Priority)
+	set("severity", &bug.Severity, in.Severity)
+	set("op_sys", &bug.OpSys, in.OpSys)
+	set("platform", &bug.Platform, in.Platform)
+	set("target_milestone", &bug.TargetMilestone, in.TargetMilestone)
+	set("url", &bug.URL, in.Url)
+	set("deadline", &bug.Deadline, in.Deadline)
+	for _, login := range []string{in.AssignedTo, in.QaContact} {
+		if login == "" {
+			continue
+		}
+		if err := b.validUser(login); err != nil {
+			return nil, err
+		}
+	}
+	if in.ResetAssignedTo {
+		in.AssignedTo = Nobody
+	}
+	set("assigned_to", &bug.AssignedTo, in.AssignedTo)
+	bug.AssignedToDetail = bugs.User{Name: bug.AssignedTo, RealName: bug.AssignedTo}
+	if in.ResetQaContact && bug.QaContact != "" {
+		changes["qa_contact"] = bugs.Change{Removed: bug.QaContact}
+		bug.QaContact = ""
+	}
+	set("qa_contact", &bug.QaContact, in.QaContact)
+	if err := b.resolve(bug, in, changes); err != nil {
+		return nil, err
+	}
+	if in.Cc != nil {
+		for _, login := range in.Cc.Add {
+			if err := b.validUser(login); err != nil {
+				return nil, err
+			}
+		}
+		edit(changes, "cc", &bug.CC, &bugs.AddRemoveSetString{Add: in.Cc.Add, Remove: in.Cc.Remove})
+	}
+	edit(changes, "keywords", &bug.Keywords, in.Keywords)
+	if in.Alias != nil {
+		aliases := append([]string{}, bug.Alias...)
+		edit(make(map[string]bugs.Change), "alias", &aliases, in.Alias)
+		if err := b.validAliases(bug.ID, aliases); err != nil {
+			return nil, err
+		}
+		edit(changes, "alias", &bug.Alias, in.Alias)
+	}
+	for field, relations := range map[string]struct {
+		edits []bugs.AddRemoveSetInt
+		ids   *[]int
+	}{"blocks": {in.Blocks, &bug.Blocks}, "depends_on": {in.DependsOn, &bug.DependsOn}} {
+		for _, e := range relations.edits {
+			for _, id := range append(append([]int{}, e.Add...), e.Set...) {
+				if id == bug.ID || b.bug(id) == nil {
+					return nil, newError(http.StatusNotFound, codeBugNotFound, "Bug #%d does not exist.", id)
+				}
+			}
+			ids := itoa(*relations.ids)
+			edit(changes, field, &ids, &bugs.AddRemoveSetString{Add: itoa(e.Add), Remove: itoa(e.Remove), Set: itoa(e.Set)})
+			*relations.ids = atoi(ids)
+		}
+	}
+	for _, f := range in.Flags {
+		change, err := b.setFlag(r, bug, f)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			previous := changes["flagtypes.name"]
+			changes["flagtypes.name"] = bugs.Change{
+				Removed: strings.TrimPrefix(previous.Removed+", "+change.Removed, ", "),
+				Added:   strings.TrimPrefix(previous.Added+", "+change.Added, ", "),
+			}
+		}
+	}
+	return changes, nil
+}
+
+// resolve applies the status, resolution, and duplicate of the given update to the given bug.
+func (b *Bugzilla) resolve(bug *bugs.Bug, in *bugs.Update, changes map[string]bugs.Change) *bugzillaError {
+	status, resolution, dupe := bug.Status, bug.Resolution, bug.DupeOf
+	if in.DupeOf != 0 {
+		if in.DupeOf == bug.ID || b.bug(in.DupeOf) == nil {
+			return newError(http.StatusBadRequest, codeParamInvalid, "You cannot mark bug %d as a duplicate of bug %d.", bug.ID, in.DupeOf)
+		}
+		dupe, resolution = in.DupeOf, "DUPLICATE"
+		if !contains(bugs.ClosedStatuses, status) {
+			status = "RESOLVED"
+		}
+	}
+	if in.Status != "" {
+		status = in.Status
+		if contains(bugs.OpenStatuses, status) {
+			resolution = ""
+		}
+	}
+	if in.Resolution != "" {
+		resolution = in.Resolution
+	}
+	if err := validStatus(status, resolution); err != nil {
+		return err
+	}
+	if resolution == "DUPLICATE" && dupe == 0 {
+		return newError(http.StatusBadRequest, codeParamRequired, "You must specify a bug number of which this bug is a duplicate.")
+	}
+	if resolution != "DUPLICATE" {
+		dupe = 0
+	}
+	for field, value := range map[string][2]string{"status": {bug.Status, status}, "resolution": {bug.Resolution, resolution}} {
+		if value[0] != value[1] {
+			changes[field] = bugs.Change{Removed: value[0], Added: value[1]}
+		}
+	}
+	if dupe != bug.DupeOf {
+		changes["dupe_of"] = bugs.Change{Removed: itoa0(bug.DupeOf), Added: itoa0(dupe)}
+	}
+	bug.Status, bug.Resolution, bug.DupeOf = status, resolution, dupe
+	bug.IsOpen = contains(bugs.OpenStatuses, status)
+	bug.IsConfirmed = bug.IsConfirmed || status != "UNCONFIRMED"
+	return nil
+}
+
+// setFlag creates, changes, or (given the status "X") clears the given flag of the given bug, returning what
+// changed (if anything) in the form of Bugzilla's history (E.G. "needinfo?(tester@example.com)").
+//
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/bug.html#update-bug
+func (b *Bugzilla) setFlag(r *request, bug *bugs.Bug, f bugs.UpdateFlag) (*bugs.Change, *bugzillaError) {
+	if !contains([]string{"?", "+", "-", "X"}, f.Status) {
+		return nil, invalid("The flag status '%s' is invalid.", f.Status)
+	}
+	if f.Requestee != "" {
+		if f.Status != "?" {
+			return nil, invalid("A requestee may only be set on a request, not a flag with the status '%s'.", f.Status)
+		}
+		if err := b.validUser(f.Requestee); err != nil {
+			return nil, err
+		}
+	}
+	existing := -1
+	if f.Id != 0 {
+		for i, flag := range bug.Flags {
+			if flag.Id == f.Id {
+				existing = i
+			}
+		}
+		if existing < 0 {
+			return nil, newError(http.StatusBadRequest, codeObjectNotFound, "There is no flag with the ID '%d'.", f.Id)
+		}
+		f.Name, f.TypeId = bug.Flags[existing].Name, bug.Flags[existing].TypeId
+	} else {
+		name, typeID, err := b.flagType(f.Name, f.TypeId)
+		if err != nil {
+			return nil, err
+		}
+		f.Name, f.TypeId = name, typeID
+		for i, flag := range bug.Flags {
+			if flag.TypeId == typeID && !f.New {
+				existing = i
+			}
+		}
+	}
+	change := new(bugs.Change)
+	if existing >= 0 {
+		change.Removed = describe(bug.Flags[existing])
+		if f.Status == "X" {
+			bug.Flags = append(bug.Flags[:existing:existing], bug.Flags[existing+1:]...)
+			return change, nil
+		}
+		flag := &bug.Flags[existing]
+		flag.Status, flag.Requestee, flag.Setter, flag.ModificationDate = f.Status, f.Requestee, r.user, now()
+		change.Added = describe(*flag)
+		return change, nil
+	}
+	if f.Status == "X" {
+		return nil, nil
+	}
+	b.flags++
+	flag := bugs.GetFlag{
+		Id:               b.flags,
+		Name:             f.Name,
+		TypeId:           f.TypeId,
+		CreationDate:     now(),
+		ModificationDate: now(),
+		Status:           f.Status,
+		Setter:           r.user,
+		Requestee:        f.Requestee,
+	}
+	bug.Flags = append(bug.Flags, flag)
+	change.Added = describe(flag)
+	return change, nil
+}
+
+// flagType returns the name and ID of the given flag type, which is known by either. Flag types
+// come into being the first time that they are named.
+func (b *Bugzilla) flagType(name string, typeID int) (string, int, *bugzillaError) {
+	if name != "" {
+		if _, ok := b.flagTypes[name]; !ok {
+			b.flagTypes[name] = len(b.flagTypes) + 1
+		}
+		return name, b.flagTypes[name], nil
+	}
+	for n, id := range b.flagTypes {
+		if id == typeID {
+			return n, id, nil
+		}
+	}
+	if typeID == 0 {
+		return "", 0, required("flag name or type_id")
+	}
+	return "", 0, newError(http.StatusBadRequest, codeObjectNotFound, "There is no flag type with the ID '%d'.", typeID)
+}
+
+func describe(flag bugs.GetFlag) string {
+	if flag.Requestee != "" {
+		return fmt.Sprintf("%s%s(%s)", flag.Name, flag.Status, flag.Requestee)
+	}
+	return flag.Name + flag.Status
+}
+
+// edit applies the given additions, removals, and replacement to the given list.
+func edit(changes map[string]bugs.Change, field string, list *[]string, e *bugs.AddRemoveSetString) {
+	if e == nil {
+		return
+	}
+	before := append([]string{}, *list...)
+	after := before
+	if e.Set != nil {
+		after = append([]string{}, e.Set...)
+	}
+	kept := make([]string, 0, len(after))
+	for _, v := range after {
+		if !contains(e.Remove, v) {
+			kept = append(kept, v)
+		}
+	}
+	for _, v := range e.Add {
+		if !contains(kept, v) {
+			kept = append(kept, v)
+		}
+	}
+	added, removed := make([]string, 0), make([]string, 0)
+	for _, v := range kept {
+		if !contains(before, v) {
+			added = append(added, v)
+		}
+	}
+	for _, v := range before {
+		if !contains(kept, v) {
+			removed = append(removed, v)
+		}
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		changes[field] = bugs.Change{Added: joined(added), Removed: joined(removed)}
+	}
+	*list = kept
+}
+
+func (b *Bugzilla) validProduct(product, component, version string) *bugzillaError {
+	if product == "" {
+		return required("product")
+	}
+	p, ok := b.products[product]
+	if !ok {
+		return newError(http.StatusBadRequest, codeObjectNotFound, "Product '%s' does not exist or you don't have access to it.", product)
+	}
+	if component == "" {
+		return required("component")
+	}
+	if !contains(p.Components, component) {
+		return newError(http.StatusBadRequest, codeObjectNotFound, "There is no component named '%s' in the '%s' product.", component, product)
+	}
+	if version == "" {
+		return required("version")
+	}
+	if !contains(p.Versions, version) {
+		return newError(http.StatusBadRequest, codeObjectNotFound, "There is no version named '%s' in the '%s' product.", version, product)
+	}
+	return nil
+}
+
+func validStatus(status, resolution string) *bugzillaError {
+	switch {
+	case contains(bugs.OpenStatuses, status):
+		if resolution != "" {
+			return invalid("You cannot set a resolution for open bugs.")
+		}
+	case contains(bugs.ClosedStatuses, status):
+		if resolution == "" {
+			return invalid("A valid resolution is required to mark bugs as %s.", status)
+		}
+		if !contains(resolutions, resolution) {
+			return newError(http.StatusBadRequest, codeObjectNotFound, "There is no Resolution called '%s'.", resolution)
+		}
+	default:
+		return newError(http.StatusBadRequest, codeObjectNotFound, "There is no status named '%s'.", status)
+	}
+	return nil
+}
+
+// validAliases returns an error should any of the given aliases be a number or belong to a bug other than the given one.
+func (b *Bugzilla) validAliases(id int, aliases []string) *bugzillaError {
+	for _, alias := range aliases {
+		if _, err := strconv.Atoi(alias); err == nil {
+			return invalid("The alias you chose (%s) is a number, which is not allowed.", alias)
+		}
+		for _, bug := range b.bugs {
+			if bug.ID != id && contains(bug.Alias, alias) {
+				return newError(http.StatusBadRequest, codeAliasInUse, "%s has already been taken as an alias by bug %d.", alias, bug.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of the given bug that shares none of its lists.
+func clone(bug *bugs.Bug) *bugs.Bug {
+	c := *bug
+	c.Alias = append([]string{}, bug.Alias...)
+	c.Blocks = append([]int{}, bug.Blocks...)
+	c.CC = append([]string{}, bug.CC...)
+	c.DependsOn = append([]int{}, bug.DependsOn...)
+	c.Flags = append([]bugs.GetFlag{}, bug.Flags...)
+	c.Groups = append([]string{}, bug.Groups...)
+	c.Keywords = append([]string{}, bug.Keywords...)
+	c.SeeAlso = append([]string{}, bug.SeeAlso...)
+	return &c
+}
+
+func or(value, otherwise string) string {
+	if value == "" {
+		return otherwise
+	}
+	return value
+}
+
+func itoa(ids []int) []string {
+	if ids == nil {
+		return nil
+	}
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return s
+}
+
+func atoi(s []string) []int {
+	ids := make([]int, len(s))
+	for i, v := range s {
+		ids[i], _ = strconv.Atoi(v)
+	}
+	return ids
+}
+
+// itoa0 formats the given ID, or the empty string if there is none.
+func itoa0(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
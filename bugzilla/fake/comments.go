@@ -0,0 +1,175 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package fake
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/bugs"
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/comments"
+)
+
+// newComment appends a comment to the given bug. The first comment of every bug is its description.
+func (b *Bugzilla) newComment(bug *bugs.Bug, creator, text string, private, markdown bool, tags []string, attachment *int) *comments.Comment {
+	count := 0
+	for _, c := range b.comments {
+		if c.BugId == bug.ID {
+			count++
+		}
+	}
+	created := now()
+	c := &comments.Comment{
+		Id:           len(b.comments) + 1,
+		Count:        count,
+		BugId:        bug.ID,
+		AttachmentId: attachment,
+		Text:         text,
+		Creator:      creator,
+		CreationTime: created,
+		Time:         created,
+		IsPrivate:    private,
+		IsMarkdown:   markdown,
+		Tags:         append([]string{}, tags...),
+	}
+	b.comments = append(b.comments, c)
+	bug.LastChangeTime = created
+	return c
+}
+
+// listComments serves the comments of a bug, optionally only those made at or after the new_since parameter.
+// Private comments are hidden from anonymous requests.
+//
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/comment.html#get-comments
+func (b *Bugzilla) listComments(r *request, idOrAlias string) (int, interface{}, *bugzillaError) {
+	bug, err := b.lookup(idOrAlias)
+	if err != nil {
+		return 0, nil, err
+	}
+	var since *string
+	if value := r.URL.Query().Get("new_since"); value != "" {
+		t, ok := parseTime(value)
+		if !ok {
+			return 0, nil, newError(http.StatusBadRequest, codeParamInvalid, "'%s' is not a legal date.", value)
+		}
+		formatted := t.UTC().Format("2006-01-02T15:04:05Z")
+		since = &formatted
+	}
+	found := make([]*comments.Comment, 0)
+	for _, c := range b.comments {
+		if c.BugId != bug.ID || (c.IsPrivate && r.user == "") || (since != nil && c.CreationTime < *since) {
+			continue
+		}
+		found = append(found, c)
+	}
+	return http.StatusOK, map[string]interface{}{
+		"bugs":     map[string]interface{}{strconv.Itoa(bug.ID): map[string]interface{}{"comments": found}},
+		"comments": map[string]interface{}{},
+	}, nil
+}
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/comment.html#get-comments
+func (b *Bugzilla) comment(r *request, idParam string) (int, interface{}, *bugzillaError) {
+	c, err := b.lookupComment(r, idParam)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, map[string]interface{}{
+		"bugs":     map[string]interface{}{},
+		"comments": map[string]interface{}{idParam: c},
+	}, nil
+}
+
+func (b *Bugzilla) lookupComment(r *request, idParam string) (*comments.Comment, *bugzillaError) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil || id < 1 || id > len(b.comments) {
+		return nil, newError(http.StatusNotFound, codeObjectNotFound, "There is no comment with the ID '%s'.", idParam)
+	}
+	c := b.comments[id-1]
+	if c.IsPrivate && r.user == "" {
+		return nil, newError(http.StatusUnauthorized, codeCommentIsPrivate, "You are not authorized to access comment %d.", id)
+	}
+	return c, nil
+}
+
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/comment.html#create-comments
+func (b *Bugzilla) addComment(r *request, idOrAlias string) (int, interface{}, *bugzillaError) {
+	if r.user == "" {
+		return 0, nil, loginRequired()
+	}
+	bug, err := b.lookup(idOrAlias)
+	if err != nil {
+		return 0, nil, err
+	}
+	in := new(comments.Create)
+	if err := decode(r, in); err != nil {
+		return 0, nil, err
+	}
+	if strings.TrimSpace(in.Comment) == "" {
+		return 0, nil, newError(http.StatusBadRequest, codeParamRequired, "You have to specify a comment.")
+	}
+	if err := validTags(in.Tags); err != nil {
+		return 0, nil, err
+	}
+	c := b.newComment(bug, r.user, in.Comment, in.IsPrivate, in.IsMarkdown, in.Tags, nil)
+	return http.StatusCreated, &comments.CreateResponse{Id: c.Id}, nil
+}
+
+// updateTags adds and removes tags of a comment, and serves every tag of the comment once updated. Tags
+// are compared case insensitively.
+//
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/comment.html#update-comment-tags
+func (b *Bugzilla) updateTags(r *request, idParam string) (int, interface{}, *bugzillaError) {
+	if r.user == "" {
+		return 0, nil, loginRequired()
+	}
+	c, err := b.lookupComment(r, idParam)
+	if err != nil {
+		return 0, nil, err
+	}
+	in := new(comments.UpdateTags)
+	if err := decode(r, in); err != nil {
+		return 0, nil, err
+	}
+	if err := validTags(in.Add); err != nil {
+		return 0, nil, err
+	}
+	tags := make([]string, 0, len(c.Tags)+len(in.Add))
+	for _, tag := range append(append([]string{}, c.Tags...), in.Add...) {
+		if !containsFold(tags, tag) && !containsFold(in.Remove, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	c.Tags = tags
+	return http.StatusOK, tags, nil
+}
+
+// validTags returns an error should any of the given tags not be a valid comment tag, which is to say
+// one of 3 to 24 characters without any spaces or commas.
+func validTags(tags []string) *bugzillaError {
+	for _, tag := range tags {
+		switch {
+		case len(tag) < 3:
+			return invalid("The comment tag '%s' is too short.", tag)
+		case len(tag) > 24:
+			return invalid("The comment tag '%s' is too long.", tag)
+		case strings.ContainsAny(tag, " \t\n,"):
+			return invalid("The comment tag '%s' contains invalid characters or spaces.", tag)
+		}
+	}
+	return nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,409 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package fake is an in-memory stand in for the REST API of Bugzilla, so that
+// the consumers of the Bugzilla client may be tested without filing real bugs.
+//
+// A Bugzilla is an http.Handler and is intended to be served with the httptest
+// package. For example:
+//
+//	b := fake.New()
+//	server := httptest.NewServer(b)
+//	defer server.Close()
+//	c := client.NewClient(server.URL).WithAuth(&auth.ApiKey{ApiKey: fake.APIKey})
+//
+// It serves the version, bug (create, get, search, and update), comment (including tags),
+// and attachment resources. Writes require a registered API key, the fields that Bugzilla requires
+// are required, and failures are answered with Bugzilla's error bodies.
+//
+// For details, please see:
+// https://bugzilla.readthedocs.io/en/latest/api/index.html
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/attachments"
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/bugs"
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/comments"
+)
+
+const (
+	// The login and API key of the user that every fake Bugzilla starts with.
+	Login  = "tester@example.com"
+	APIKey = "xq7CpVj1Rk2w8TnYbL0dZ3sHfM5gE9uA4oKcQi6P"
+	// Version is the version of Bugzilla that is reported by every fake Bugzilla.
+	Version = "20210226.1"
+	// Nobody is the default assignee of new bugs.
+	Nobody = "nobody@mozilla.org"
+)
+
+// The error codes of Bugzilla that a fake Bugzilla may answer with.
+//
+// For details, please see:
+// https://github.com/bugzilla/bugzilla/blob/5.0/Bugzilla/WebService/Constants.pm
+const (
+	codeParamRequired    = 50
+	codeObjectNotFound   = 51
+	codeParamInvalid     = 53
+	codeInvalidBugID     = 100
+	codeBugNotFound      = 101
+	codeAliasInUse       = 103
+	codeCommentIsPrivate = 110
+	codeInvalidAPIKey    = 306
+	codeLoginRequired    = 410
+	codeResourceMissing  = 32614
+)
+
+const documentation = "https://bmo.readthedocs.io/en/latest/api/"
+
+// A Product is a product of a fake Bugzilla, along with the components and versions
+// that bugs filed against it may have.
+type Product struct {
+	Name       string
+	Components []string
+	Versions   []string
+}
+
+// The product that every fake Bugzilla starts with.
+var core = Product{
+	Name:       "Core",
+	Components: []string{"Security: PSM", "Security Block-lists, Allow-lists, and other State"},
+	Versions:   []string{"unspecified", "Trunk", "69 Branch"},
+}
+
+// A Bugzilla holds its users, products, bugs, comments, and attachments in memory, for as long as it lives.
+type Bugzilla struct {
+	lock        sync.Mutex
+	keys        map[string]string // API key to login
+	users       map[string]bool
+	products    map[string]*Product
+	flagTypes   map[string]int
+	bugs        []*bugs.Bug
+	comments    []*comments.Comment
+	attachments []*attachments.GetResponse
+	flags       int
+}
+
+// New returns a fake Bugzilla that knows of a single user (Login, authenticated by APIKey)
+// and the "Core" product. See AddUser and AddProduct for more.
+func New() *Bugzilla {
+	b := &Bugzilla{
+		keys:      make(map[string]string),
+		users:     map[string]bool{Nobody: true},
+		products:  make(map[string]*Product),
+		flagTypes: make(map[string]int),
+	}
+	b.AddUser(Login, APIKey)
+	b.AddProduct(core)
+	return b
+}
+
+// AddUser registers the given login, which may then be put on CC, assigned bugs, and so on. If the
+// given API key is not empty, then it authenticates the user.
+func (b *Bugzilla) AddUser(login, apiKey string) *Bugzilla {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.users[login] = true
+	if apiKey != "" {
+		b.keys[apiKey] = login
+	}
+	return b
+}
+
+// AddProduct registers the given product (replacing any of the same name).
+func (b *Bugzilla) AddProduct(product Product) *Bugzilla {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.products[product.Name] = &product
+	return b
+}
+
+// Bug returns a copy of the given bug, if it exists.
+func (b *Bugzilla) Bug(id int) (*bugs.Bug, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	bug := b.bug(id)
+	if bug == nil {
+		return nil, false
+	}
+	return clone(bug), true
+}
+
+// Bugs returns the number of bugs that have been filed.
+func (b *Bugzilla) Bugs() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.bugs)
+}
+
+// Comments returns a copy of every comment on the given bug, the first of which is its description.
+func (b *Bugzilla) Comments(bug int) []comments.Comment {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	found := make([]comments.Comment, 0)
+	for _, c := range b.comments {
+		if c.BugId == bug {
+			copied := *c
+			copied.Tags = append([]string{}, c.Tags...)
+			found = append(found, copied)
+		}
+	}
+	return found
+}
+
+// Attachments returns a copy of every attachment of the given bug.
+func (b *Bugzilla) Attachments(bug int) []attachments.GetResponse {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	found := make([]attachments.GetResponse, 0)
+	for _, a := range b.attachments {
+		if a.BugId == bug {
+			found = append(found, *a)
+		}
+	}
+	return found
+}
+
+// request is an incoming request, along with who (if anyone) it is authenticated as.
+type request struct {
+	*http.Request
+	user string
+}
+
+// bugzillaError is the body of every failed response.
+type bugzillaError struct {
+	status        int
+	Error         bool   `json:"error"`
+	Code          int    `json:"code"`
+	Message       string `json:"message"`
+	Documentation string `json:"documentation"`
+}
+
+func newError(status, code int, format string, args ...interface{}) *bugzillaError {
+	return &bugzillaError{
+		status:        status,
+		Error:         true,
+		Code:          code,
+		Message:       fmt.Sprintf(format, args...),
+		Documentation: documentation,
+	}
+}
+
+func loginRequired() *bugzillaError {
+	return newError(http.StatusUnauthorized, codeLoginRequired, "You must log in before using this part of Bugzilla.")
+}
+
+func required(field string) *bugzillaError {
+	return newError(http.StatusBadRequest, codeParamRequired, "You must select/enter a %s.", field)
+}
+
+func invalid(format string, args ...interface{}) *bugzillaError {
+	return newError(http.StatusBadRequest, codeParamInvalid, format, args...)
+}
+
+func noSuchUser(login string) *bugzillaError {
+	return newError(http.StatusBadRequest, codeObjectNotFound, "There is no user named '%s'. Either you mis-typed "+
+		"the name or that user has not yet registered for a Bugzilla account.", login)
+}
+
+func (b *Bugzilla) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	status, body, err := b.route(r)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err != nil {
+		status, body = err.status, err
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (b *Bugzilla) route(r *http.Request) (int, interface{}, *bugzillaError) {
+	req, err := b.authenticate(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	notFound := newError(http.StatusNotFound, codeResourceMissing,
+		"A REST API resource was not found for '%s %s'.", r.Method, strings.TrimPrefix(r.URL.Path, "/rest"))
+	if !strings.HasPrefix(r.URL.Path, "/rest/") {
+		return 0, nil, notFound
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/rest/"), "/"), "/")
+	switch {
+	case len(path) == 1 && path[0] == "version" && r.Method == http.MethodGet:
+		return http.StatusOK, map[string]string{"version": Version}, nil
+	case len(path) == 1 && path[0] == "bug" && r.Method == http.MethodGet:
+		return b.search(req)
+	case len(path) == 1 && path[0] == "bug" && r.Method == http.MethodPost:
+		return b.create(req)
+	case len(path) == 3 && path[0] == "bug" && path[1] == "comment" && r.Method == http.MethodGet:
+		return b.comment(req, path[2])
+	case len(path) == 4 && path[0] == "bug" && path[1] == "comment" && path[3] == "tags" && r.Method == http.MethodPut:
+		return b.updateTags(req, path[2])
+	case len(path) == 3 && path[0] == "bug" && path[1] == "attachment" && r.Method == http.MethodGet:
+		return b.attachment(req, path[2])
+	case len(path) == 2 && path[0] == "bug" && r.Method == http.MethodGet:
+		return b.get(req, path[1])
+	case len(path) == 2 && path[0] == "bug" && r.Method == http.MethodPut:
+		return b.update(req, path[1])
+	case len(path) == 3 && path[0] == "bug" && path[2] == "comment" && r.Method == http.MethodGet:
+		return b.listComments(req, path[1])
+	case len(path) == 3 && path[0] == "bug" && path[2] == "comment" && r.Method == http.MethodPost:
+		return b.addComment(req, path[1])
+	case len(path) == 3 && path[0] == "bug" && path[2] == "attachment" && r.Method == http.MethodGet:
+		return b.listAttachments(req, path[1])
+	case len(path) == 3 && path[0] == "bug" && path[2] == "attachment" && r.Method == http.MethodPost:
+		return b.createAttachment(req, path[1])
+	}
+	return 0, nil, notFound
+}
+
+// authenticate determines who the request is from via its API key, if any. Anonymous requests
+// are allowed to read, however a request with an unknown API key is refused outright.
+//
+// For details, please see:
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/general.html#authentication
+func (b *Bugzilla) authenticate(r *http.Request) (*request, *bugzillaError) {
+	key := r.Header.Get("X-BUGZILLA-API-KEY")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return &request{Request: r}, nil
+	}
+	user, ok := b.keys[key]
+	if !ok {
+		return nil, newError(http.StatusUnauthorized, codeInvalidAPIKey,
+			"The API key you specified is invalid. Please check that you typed it correctly.")
+	}
+	return &request{Request: r, user: user}, nil
+}
+
+// decode reads the JSON body of the given request into the given value.
+func decode(r *request, v interface{}) *bugzillaError {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return invalid("The request body is not valid JSON: %s", err)
+	}
+	return nil
+}
+
+// lookup returns the bug of the given ID or alias.
+func (b *Bugzilla) lookup(idOrAlias string) (*bugs.Bug, *bugzillaError) {
+	id, err := strconv.Atoi(idOrAlias)
+	if err != nil {
+		for _, bug := range b.bugs {
+			for _, alias := range bug.Alias {
+				if alias == idOrAlias {
+					return bug, nil
+				}
+			}
+		}
+		return nil, newError(http.StatusNotFound, codeInvalidBugID,
+			"'%s' is not a valid bug number nor an alias to a bug.", idOrAlias)
+	}
+	bug := b.bug(id)
+	if bug == nil {
+		return nil, newError(http.StatusNotFound, codeBugNotFound, "Bug #%d does not exist.", id)
+	}
+	return bug, nil
+}
+
+func (b *Bugzilla) bug(id int) *bugs.Bug {
+	if id < 1 || id > len(b.bugs) {
+		return nil
+	}
+	return b.bugs[id-1]
+}
+
+func (b *Bugzilla) validUser(login string) *bugzillaError {
+	if !b.users[login] {
+		return noSuchUser(login)
+	}
+	return nil
+}
+
+// now formats the current time as Bugzilla does (E.G. "2021-02-26T00:05:00Z").
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// parseTime parses the timestamps of Bugzilla, which are either RFC 3339 or ISO 8601 without separators.
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "20060102T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// values returns every value of the given query parameter, splitting any that are comma separated.
+func values(r *request, key string) []string {
+	found := make([]string, 0)
+	for _, value := range r.URL.Query()[key] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				found = append(found, v)
+			}
+		}
+	}
+	return found
+}
+
+// project reduces the given value to the fields named by the include_fields
+// and exclude_fields query parameters of the given request.
+//
+// For details, please see:
+// https://bugzilla.readthedocs.io/en/latest/api/core/v1/general.html#useful-parameters
+func project(r *request, v interface{}) (interface{}, *bugzillaError) {
+	include, exclude := values(r, "include_fields"), values(r, "exclude_fields")
+	if len(include) == 0 && len(exclude) == 0 {
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, newError(http.StatusInternalServerError, codeParamInvalid, "%s", err)
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, newError(http.StatusInternalServerError, codeParamInvalid, "%s", err)
+	}
+	projected := fields
+	if len(include) > 0 && !contains(include, "_all") && !contains(include, "_default") {
+		projected = make(map[string]interface{})
+		for _, field := range include {
+			if value, ok := fields[field]; ok {
+				projected[field] = value
+			}
+		}
+	}
+	for _, field := range exclude {
+		delete(projected, field)
+	}
+	return projected, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// joined formats a list of values as Bugzilla does in the changes of an update (E.G. "a, b").
+func joined(list []string) string {
+	sorted := append([]string{}, list...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
@@ -0,0 +1,244 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// serve returns the URL of a fresh fake Bugzilla, along with the fake itself.
+func serve(t *testing.T) (string, *Bugzilla) {
+	b := New()
+	server := httptest.NewServer(b)
+	t.Cleanup(server.Close)
+	return server.URL + "/rest", b
+}
+
+// call makes the given request (authenticated with the given API key, if any) and decodes its response.
+func call(t *testing.T, method, url, key string, body interface{}) (int, map[string]interface{}) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("X-BUGZILLA-API-KEY", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	decoded := make(map[string]interface{})
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, decoded
+}
+
+// file files a bug of the given summary and whiteboard.
+func file(t *testing.T, url, summary, whiteboard string) {
+	status, body := call(t, http.MethodPost, url+"/bug", APIKey, map[string]interface{}{
+		"product": "Core", "component": "Security: PSM", "version": "Trunk", "summary": summary,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("unexpected response %d %v", status, body)
+	}
+	if whiteboard == "" {
+		return
+	}
+	status, body = call(t, http.MethodPut, url+"/bug/"+jsonNumber(body["id"]), APIKey, map[string]interface{}{"whiteboard": whiteboard})
+	if status != http.StatusOK {
+		t.Fatalf("unexpected response %d %v", status, body)
+	}
+}
+
+func jsonNumber(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestErrors(t *testing.T) {
+	url, _ := serve(t)
+	for _, tc := range []struct {
+		name, method, path, key string
+		status, code            int
+	}{
+		{"login required", http.MethodPost, "/bug", "", http.StatusUnauthorized, codeLoginRequired},
+		{"invalid API key", http.MethodGet, "/version", "nope", http.StatusUnauthorized, codeInvalidAPIKey},
+		{"missing bug", http.MethodGet, "/bug/42", "", http.StatusNotFound, codeBugNotFound},
+		{"missing alias", http.MethodGet, "/bug/tribute", "", http.StatusNotFound, codeInvalidBugID},
+		{"unknown resource", http.MethodDelete, "/bug/1", APIKey, http.StatusNotFound, codeResourceMissing},
+		{"custom search field", http.MethodGet, "/bug?f1=votes&o1=equals&v1=1", "", http.StatusBadRequest, codeObjectNotFound},
+		{"keywords type", http.MethodGet, "/bug?keywords=crash&keywords_type=somewords", "", http.StatusBadRequest, codeParamInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := call(t, tc.method, url+tc.path, tc.key, map[string]string{})
+			if status != tc.status || body["error"] != true || body["code"] != float64(tc.code) || body["message"] == "" {
+				t.Errorf("unexpected response %d %v", status, body)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	url, _ := serve(t)
+	file(t, url, "CCADB entries generated 2021-02-26T00:05:00Z", "")
+	file(t, url, "Something else entirely", "[ccadb-reminder]")
+	file(t, url, "ccadb entries generated 2021-03-01T00:05:00Z", "[ccadb-reminder]")
+	for _, tc := range []struct {
+		query string
+		want  []float64
+	}{
+		{"", []float64{1, 2, 3}},
+		{"?id=1,3", []float64{1, 3}},
+		{"?id=1&id=2", []float64{1, 2}},
+		{"?summary=CCADB%20entries", []float64{1, 3}},
+		{"?summary=CCADB%20entries&whiteboard=reminder", []float64{3}},
+		{"?product=core&component=Security:%20PSM&status=NEW", []float64{1, 2, 3}},
+		{"?status=RESOLVED", []float64{}},
+		{"?creator=" + Login + "&limit=1&offset=1", []float64{2}},
+		{"?creation_time=2000-01-01T00:00:00Z", []float64{1, 2, 3}},
+		{"?creation_time=2999-01-01T00:00:00Z", []float64{}},
+		{"?f1=creation_ts&o1=lessthan&v1=2999-01-01T00:00:00Z&f2=delta_ts&o2=greaterthaneq&v2=2000-01-01", []float64{1, 2, 3}},
+		{"?f1=delta_ts&o1=lessthan&v1=2000-01-01T00:00:00Z", []float64{}},
+		{"?quicksearch=ccadb%20generated", []float64{1, 3}},
+		{"?quicksearch=sw:reminder%20entries", []float64{3}},
+		{"?quicksearch=RESOLVED%20ccadb", []float64{}},
+		{"?quicksearch=%232", []float64{2}},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			status, body := call(t, http.MethodGet, url+"/bug"+tc.query, "", nil)
+			if status != http.StatusOK {
+				t.Fatalf("unexpected response %d %v", status, body)
+			}
+			got := make([]float64, 0)
+			for _, bug := range body["bugs"].([]interface{}) {
+				got = append(got, bug.(map[string]interface{})["id"].(float64))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected bugs %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIncludeFields(t *testing.T) {
+	url, _ := serve(t)
+	file(t, url, "Tests Should Work", "")
+	_, body := call(t, http.MethodGet, url+"/bug/1?include_fields=id,summary", "", nil)
+	want := []interface{}{map[string]interface{}{"id": float64(1), "summary": "Tests Should Work"}}
+	if !reflect.DeepEqual(body["bugs"], want) {
+		t.Errorf("expected %v, got %v", want, body["bugs"])
+	}
+}
+
+func TestComments(t *testing.T) {
+	url, b := serve(t)
+	file(t, url, "Tests Should Work", "")
+	status, body := call(t, http.MethodPost, url+"/bug/1/comment", APIKey, map[string]interface{}{"comment": "Between you and me", "is_private": true})
+	if status != http.StatusCreated || body["id"] != float64(2) {
+		t.Fatalf("unexpected response %d %v", status, body)
+	}
+	status, body = call(t, http.MethodPost, url+"/bug/1/comment", APIKey, map[string]interface{}{"comment": " "})
+	if status != http.StatusBadRequest || body["code"] != float64(codeParamRequired) {
+		t.Errorf("unexpected response %d %v", status, body)
+	}
+	// Private comments are hidden from those who are not logged in.
+	for key, want := range map[string]int{APIKey: 2, "": 1} {
+		_, body = call(t, http.MethodGet, url+"/bug/1/comment", key, nil)
+		comments := body["bugs"].(map[string]interface{})["1"].(map[string]interface{})["comments"].([]interface{})
+		if len(comments) != want {
+			t.Errorf("expected %d comments, got %v", want, comments)
+		}
+	}
+	status, _ = call(t, http.MethodGet, url+"/bug/comment/2", "", nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("expected a private comment to be refused, got %d", status)
+	}
+	_, body = call(t, http.MethodGet, url+"/bug/comment/2", APIKey, nil)
+	if c := body["comments"].(map[string]interface{})["2"].(map[string]interface{}); c["text"] != "Between you and me" || c["count"] != float64(1) {
+		t.Errorf("unexpected comment %v", c)
+	}
+	status, body = call(t, http.MethodPut, url+"/bug/comment/1/tags", APIKey, map[string]interface{}{"add": []string{"not a tag"}})
+	if status != http.StatusBadRequest || body["code"] != float64(codeParamInvalid) {
+		t.Errorf("unexpected response %d %v", status, body)
+	}
+	if got := b.Comments(1); len(got) != 2 {
+		t.Errorf("unexpected comments %+v", got)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	url, b := serve(t)
+	file(t, url, "Tests Should Work", "")
+	file(t, url, "Tests Should Still Work", "")
+	status, body := call(t, http.MethodPost, url+"/bug/1/attachment", APIKey, map[string]interface{}{
+		"ids": []int{1, 2}, "data": []byte("tribute"), "file_name": "tenacious.txt", "summary": "a tribute", "content_type": "text/plain",
+		"flags": []map[string]string{{"name": "review", "status": "?"}},
+	})
+	if status != http.StatusCreated || !reflect.DeepEqual(body["ids"], []interface{}{float64(1), float64(2)}) {
+		t.Fatalf("unexpected response %d %v", status, body)
+	}
+	_, body = call(t, http.MethodGet, url+"/bug/2/attachment", "", nil)
+	attached := body["bugs"].(map[string]interface{})["2"].([]interface{})
+	if len(attached) != 1 || attached[0].(map[string]interface{})["data"] != "dHJpYnV0ZQ==" {
+		t.Errorf("unexpected attachments %v", attached)
+	}
+	_, body = call(t, http.MethodGet, url+"/bug/attachment/1?exclude_fields=data", "", nil)
+	a := body["attachments"].(map[string]interface{})["1"].(map[string]interface{})
+	if _, ok := a["data"]; ok || a["file_name"] != "tenacious.txt" || len(a["flags"].([]interface{})) != 1 {
+		t.Errorf("unexpected attachment %v", a)
+	}
+	if comments := b.Comments(2); len(comments) != 2 || !strings.HasPrefix(comments[1].Text, "Created attachment 2") || *comments[1].AttachmentId != 2 {
+		t.Errorf("unexpected comments %+v", comments)
+	}
+	status, body = call(t, http.MethodPost, url+"/bug/1/attachment", APIKey, map[string]interface{}{
+		"data": []byte("tribute"), "file_name": "tenacious.txt", "summary": "a tribute", "content_type": "tribute",
+	})
+	if status != http.StatusBadRequest || body["code"] != float64(codeParamInvalid) {
+		t.Errorf("unexpected response %d %v", status, body)
+	}
+}
+
+func TestUpdateIsAtomic(t *testing.T) {
+	url, b := serve(t)
+	file(t, url, "Tests Should Work", "")
+	file(t, url, "Tests Should Still Work", "")
+	status, body := call(t, http.MethodPut, url+"/bug/1", APIKey, map[string]interface{}{
+		"ids": []int{1, 2, 3}, "status": "RESOLVED", "resolution": "FIXED",
+	})
+	if status != http.StatusNotFound || body["code"] != float64(codeBugNotFound) {
+		t.Fatalf("unexpected response %d %v", status, body)
+	}
+	for id := 1; id <= 2; id++ {
+		if bug, _ := b.Bug(id); bug.Status != "NEW" {
+			t.Errorf("expected bug %d to be left alone, got %s", id, bug.Status)
+		}
+	}
+	status, body = call(t, http.MethodPut, url+"/bug/2", APIKey, map[string]interface{}{"dupe_of": 1, "alias": map[string][]string{"add": {"tribute"}}})
+	if status != http.StatusOK {
+		t.Fatalf("unexpected response %d %v", status, body)
+	}
+	if bug, _ := b.Bug(2); bug.Status != "RESOLVED" || bug.Resolution != "DUPLICATE" || bug.DupeOf != 1 {
+		t.Errorf("unexpected bug %+v", bug)
+	}
+	status, body = call(t, http.MethodPut, url+"/bug/1", APIKey, map[string]interface{}{"alias": map[string][]string{"add": {"tribute"}}})
+	if status != http.StatusBadRequest || body["code"] != float64(codeAliasInUse) {
+		t.Errorf("unexpected response %d %v", status, body)
+	}
+}
@@ -4,17 +4,23 @@
 
 package main // import "github.com/mozilla/OneCRL-Tools/ccadb2OneCRL"
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"os"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/auth"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/schema"
 
 	bugzAuth "github.com/mozilla/OneCRL-Tools/bugzilla/api/auth"
 
@@ -30,6 +36,9 @@ import (
 
 	"github.com/mozilla/OneCRL-Tools/ccadb2OneCRL/onecrl"
 	"github.com/mozilla/OneCRL-Tools/kinto"
+	"github.com/mozilla/OneCRL-Tools/kinto/mirror"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+	"github.com/mozilla/OneCRL-Tools/middleware"
 
 	"github.com/mozilla/OneCRL-Tools/ccadb2OneCRL/ccadb"
 	log "github.com/sirupsen/logrus"
@@ -73,6 +82,9 @@ const (
 	// Optional. A comma separated list of of email accounts to put on CC for new bugs. If these accounts are not
 	// registered with the configured Bugzilla, then a runtime error will occur when creating new bugs.
 	BugzillaCcAccounts = "BUGZILLA_CC_ACCOUNTS"
+	// URL of the CCADB report of revoked intermediates that are ready to be added to OneCRL.
+	// Default is likely what you want as this is mostly configurable for testing purposes. [default: the CCADB's public report]
+	CCADB = "CCADB"
 	// Target logging level for this tool.
 	//	Available: panic, fatal, error, warn, warning info, debug, trace
 	//	Default: info
@@ -80,8 +92,45 @@ const (
 	// Target directory for logs. Each run of the tool will be logged to the timestamp
 	// of when it was ran. [default: stdout/stderr]
 	LogDir = "LOG_DIR"
+	// The deadline for an entire run of this tool, expressed as a Go duration (E.G. "30m").
+	// Every call made to Kinto and Bugzilla during the run shares this one deadline. [default: "1h"]
+	RunTimeout        = "RUN_TIMEOUT"
+	runTimeoutDefault = time.Hour
+	// Optional. A directory in which to keep an on-disk mirror of the staging and production OneCRL
+	// collections. If set, then only what has changed since the previous run is downloaded from Kinto,
+	// and the mirrors are left behind as a consistent offline copy of OneCRL. [default: no mirror]
+	OneCRLMirrorDir = "ONECRL_MIRROR_DIR"
+	// Optional. A PEM file of additional root certificates to trust when connecting to Kinto and Bugzilla
+	// (E.G. that of an egress proxy). Proxies themselves are configured via HTTPS_PROXY. [default: system roots only]
+	CABundle = "CA_BUNDLE"
+	// Optional. If "true", then the bugs filed by earlier runs that are still open are listed in the log
+	// once the run is over. This is purely informational and never affects the outcome of a run. [default: "false"]
+	OpenBugReport = "OPEN_BUG_REPORT"
 )
 
+// The product and component that every bug is filed under, and the start of every bug's summary.
+const (
+	bugProduct       = "Core"
+	bugComponent     = "Security Block-lists, Allow-lists, and other State"
+	bugSummaryPrefix = "CCADB entries generated"
+)
+
+// Reminders posted by BlastEmails are tagged with reminderTag, and a bug that has received
+// one within the last reminderInterval is not reminded again.
+const (
+	reminderTag      = "onecrl-reminder"
+	reminderPrefix   = "Changes are still in review."
+	reminderInterval = time.Hour * 24
+)
+
+// rollbackTimeout bounds the rollback of a failed run. Rollbacks are not bound to the
+// run's deadline as the most likely reason for a rollback is that the deadline was exceeded.
+const rollbackTimeout = time.Minute * 10
+
+// reportTimeout bounds the open bug report (see OpenBugReport), which is made after the run
+// and so is not bound to the run's deadline either.
+const reportTimeout = time.Minute
+
 func main() {
 	config := filepath.Join(filepath.Dir(os.Args[0]), "config.env")
 	if len(os.Args) > 1 {
@@ -126,8 +175,38 @@ func _main() {
 			Fatal("failed to construct OneCRL staging client")
 	}
 	bugz := BugzillaClient()
+	transport, err := HTTPTransport()
+	if err != nil {
+		log.WithField("bundle", os.Getenv(CABundle)).
+			WithError(err).
+			Fatal("failed to load the CA bundle")
+	}
+	// Every exchange is logged at the debug level, which makes for a reasonable trace of a run.
+	trace := middleware.Logging(log.Debugf)
+	production.WithTransport(transport).WithMiddleware(trace)
+	staging.WithTransport(transport).WithMiddleware(trace)
+	bugz.WithTransport(transport).WithMiddleware(trace)
+	timeout, err := ParseRunTimeout()
+	if err != nil {
+		log.WithField("timeout", os.Getenv(RunTimeout)).
+			WithError(err).
+			Fatal("failed to parse the run timeout")
+	}
+	report, err := ParseOpenBugReport()
+	if err != nil {
+		log.WithField("report", os.Getenv(OpenBugReport)).
+			WithError(err).
+			Fatal("failed to parse the open bug report setting")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	updater := NewUpdate(staging, production, bugz)
-	err = updater.Update()
+	err = updater.UpdateContext(ctx)
+	cancel()
+	if report {
+		ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+		updater.ReportOpenBugs(ctx)
+		cancel()
+	}
 	if err != nil {
 		log.WithError(err).Error("update failed")
 		os.Exit(1)
@@ -226,6 +305,54 @@ func BugzillaClient() *bugzilla.Client {
 		WithAuth(&bugzAuth.ApiKey{ApiKey: os.Getenv(BugzillaApiKey)})
 }
 
+// CCADBReport downloads the CCADB report of revoked intermediates that are ready to be added to
+// OneCRL from the CCADB environment variable (if set), or otherwise from the CCADB itself.
+func CCADBReport() ([]*ccadb.Certificate, error) {
+	if os.Getenv(CCADB) != "" {
+		return ccadb.FromURL(os.Getenv(CCADB))
+	}
+	return ccadb.Default()
+}
+
+// HTTPTransport returns the transport shared by every client, which trusts the roots within
+// the CABundle environment variable (if set) in addition to the system roots.
+func HTTPTransport() (http.RoundTripper, error) {
+	bundle := os.Getenv(CABundle)
+	if bundle == "" {
+		return http.DefaultTransport, nil
+	}
+	roots, err := middleware.SystemRootsWith(bundle)
+	if err != nil {
+		return nil, err
+	}
+	return middleware.Transport(roots), nil
+}
+
+// ParseRunTimeout parses the RunTimeout environment variable as a Go duration.
+func ParseRunTimeout() (time.Duration, error) {
+	t := os.Getenv(RunTimeout)
+	if t == "" {
+		return runTimeoutDefault, nil
+	}
+	timeout, err := time.ParseDuration(t)
+	if err != nil {
+		return 0, err
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("the run timeout must be positive, got %s", timeout)
+	}
+	return timeout, nil
+}
+
+// ParseOpenBugReport parses the OpenBugReport environment variable as a boolean.
+func ParseOpenBugReport() (bool, error) {
+	report := os.Getenv(OpenBugReport)
+	if report == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(report)
+}
+
 func ParseLogLevel() (log.Level, error) {
 	l := os.Getenv(LogLevel)
 	if l == "" {
@@ -260,6 +387,13 @@ type Updater struct {
 	staging    *kinto.Client
 	production *kinto.Client
 	bugzilla   *bugzilla.Client
+	// The ID and last_modified of each change as it exists on staging, in the same
+	// order as changes. These are tracked separately from the changes themselves
+	// as the changes are later reused for pushing to production.
+	staged []*api.Record
+	// The signer statuses of staging and production, as of AnySignerInReview.
+	stagingStatus    *kintosigner.Status
+	productionStatus *kintosigner.Status
 }
 
 func NewUpdate(staging, production *kinto.Client, bugz *bugzilla.Client) *Updater {
@@ -272,16 +406,28 @@ func NewUpdate(staging, production *kinto.Client, bugz *bugzilla.Client) *Update
 
 // Update is the main entry point to the core business logic.
 func (u *Updater) Update() error {
+	return u.UpdateContext(context.Background())
+}
+
+// UpdateContext is the same as Update, however every call made to Kinto
+// and Bugzilla (with the exception of rollbacks) is bound to the given context.
+func (u *Updater) UpdateContext(ctx context.Context) error {
 	// Do some canary tests against Kinto to make sure that
 	// we are properly authenticated for both production and
 	// staging before we move on with anything.
-	err := u.TryAuth()
+	err := u.TryAuth(ctx)
+	if err != nil {
+		return err
+	}
+	// Likewise, make sure that both servers run the plugins that the
+	// update relies upon, rather than finding out halfway through it.
+	err = u.RequireCapabilities(ctx)
 	if err != nil {
 		return err
 	}
 	// Policy is that if staging or prod (or both) are in review then we bail
 	// out of this operation early and send out emails.
-	inReview, err := u.AnySignerInReview()
+	inReview, err := u.AnySignerInReview(ctx)
 	if err != nil {
 		return err
 	}
@@ -291,14 +437,14 @@ func (u *Updater) Update() error {
 		// and OneCRL as those are the revocations that are still
 		// in review. Once we find them we would like to post
 		// gentle reminders to the associated Bugzilla tickets.
-		intersection, err := u.FindIntersection()
+		intersection, err := u.FindIntersection(ctx)
 		if err != nil {
 			return err
 		}
-		u.BlastEmails(intersection)
+		u.BlastEmails(ctx, intersection)
 		return nil
 	}
-	err = u.FindDiffs()
+	err = u.FindDiffs(ctx)
 	if err != nil {
 		return err
 	}
@@ -306,60 +452,94 @@ func (u *Updater) Update() error {
 		log.Info("no differences found between the CCADB and OneCRL staging/production")
 		return nil
 	}
+	// Catch malformed records now, rather than as a 400 from Kinto halfway through the transaction.
+	err = u.ValidateChanges(ctx)
+	if err != nil {
+		return err
+	}
+	err = u.PushChanges(ctx)
+	if err == nil {
+		log.WithField("bugzilla", u.bugzilla.ShowBug(u.bugID)).Info("successfully completed update")
+	}
+	return err
+}
+
+// PushChanges pushes the changes found by FindDiffs to staging and production, and files a bug for them.
+// Should any step fail, then every step taken up to (and including) that step is rolled back.
+func (u *Updater) PushChanges(ctx context.Context) error {
 	// From here on we begin mutating datasets (OneCRL staging/production and Bugzilla)
 	// so we would like to put these actions into a transactional context. Ideally,
 	// each step should be able to undo itself if necessary.
-	err = transaction.Start().
-		Then(u.PushToStaging()).
-		Then(u.OpenBug()).
-		Then(u.UpdateRecordsWithBugID()).
-		Then(u.PutStagingIntoReview()).
-		Then(u.PushToProduction()).
-		Then(u.PutProductionIntoReview()).
+	return transaction.Start().
+		Then(u.PushToStaging(ctx)).
+		Then(u.OpenBug(ctx)).
+		Then(u.UpdateRecordsWithBugID(ctx)).
+		Then(u.PutStagingIntoReview(ctx)).
+		Then(u.PushToProduction(ctx)).
+		Then(u.PutProductionIntoReview(ctx)).
 		AutoRollbackOnError(true).
 		AutoClose(true).
 		Commit()
-	if err == nil {
-		log.WithField("bugzilla", u.bugzilla.ShowBug(u.bugID)).Info("successfully completed update")
-	}
-	return err
 }
 
 // TryAuth attempts the "try_authentication" Kinto API for first staging and then production.
 //
 // For more information on the Kinto API, please see https://docs.kinto-storage.org/en/stable/api/1.x/authentication.html#try-authentication
-func (u *Updater) TryAuth() error {
-	var err error = nil
-	ok, e := u.staging.TryAuth()
-	if e != nil {
-		err = e
-	} else if !ok {
-		err = fmt.Errorf("authentication for staging Kinto failed")
-	}
-	ok, e = u.production.TryAuth()
-	if e != nil {
+func (u *Updater) TryAuth(ctx context.Context) error {
+	err := tryAuth(ctx, u.staging, "staging")
+	if e := tryAuth(ctx, u.production, "production"); e != nil {
 		if err != nil {
 			err = errors.Wrap(err, e.Error())
 		} else {
 			err = e
 		}
-	} else if !ok {
-		if err != nil {
-			err = errors.Wrap(err, "authentication for production Kinto failed")
-		} else {
-			err = fmt.Errorf("authentication for production Kinto failed")
-		}
 	}
 	// If err == nil then WithStack returns nil.
 	return errors.WithStack(err)
 }
 
+// tryAuth attempts to authenticate against the given Kinto, describing
+// why it could not when it fails.
+func tryAuth(ctx context.Context, client *kinto.Client, name string) error {
+	ok, err := client.TryAuthContext(ctx)
+	switch {
+	case kinto.IsForbidden(err):
+		return errors.Wrapf(err, "the account for %s Kinto is not permitted to access it", name)
+	case err != nil:
+		return errors.Wrapf(err, "failed to reach %s Kinto", name)
+	case !ok:
+		return fmt.Errorf("authentication for %s Kinto failed, please check the configured credentials", name)
+	default:
+		return nil
+	}
+}
+
+// RequiredCapabilities are the Kinto plugins that an update relies upon.
+var RequiredCapabilities = []string{kinto.SignerCapability}
+
+// RequireCapabilities checks that both staging and production advertise every one of the RequiredCapabilities.
+func (u *Updater) RequireCapabilities(ctx context.Context) error {
+	for _, server := range []struct {
+		name   string
+		client *kinto.Client
+	}{{"staging", u.staging}, {"production", u.production}} {
+		info, err := server.client.ServerInfoContext(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "failed to retrieve the capabilities of %s Kinto", server.name)
+		}
+		if err := info.Require(RequiredCapabilities...); err != nil {
+			return errors.Wrapf(err, "%s Kinto cannot be updated", server.name)
+		}
+	}
+	return nil
+}
+
 // FindDiffs finds all entries that are within the CCADB
 // that are not within OneCRL. Each entry found constructs
 // an appropriate onecrl.Record entry and emplaces it in
 // u.records for future reference.
-func (u *Updater) FindDiffs() error {
-	oneCRL, c, err := u.getDataSets()
+func (u *Updater) FindDiffs(ctx context.Context) error {
+	oneCRL, c, err := u.getDataSets(ctx)
 	if err != nil {
 		return err
 	}
@@ -377,8 +557,8 @@ func (u *Updater) FindDiffs() error {
 
 // FindIntersection finds the intersection between
 // union(oneCRLProd, oneCRLStag) and the CCADB.
-func (u *Updater) FindIntersection() (*onecrl.Set, error) {
-	oneCRL, ccadb, err := u.getDataSets()
+func (u *Updater) FindIntersection(ctx context.Context) (*onecrl.Set, error) {
+	oneCRL, ccadb, err := u.getDataSets(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -386,16 +566,16 @@ func (u *Updater) FindIntersection() (*onecrl.Set, error) {
 }
 
 // getDataSets return the union(oneCRLProd, oneCRLStag) and the CCADB.
-func (u *Updater) getDataSets() (*onecrl.Set, *ccadb.Set, error) {
+func (u *Updater) getDataSets(ctx context.Context) (*onecrl.Set, *ccadb.Set, error) {
 	production := ProductionCollection()
-	err := u.production.AllRecords(production)
+	err := fetch(ctx, u.production, production, "production")
 	if err != nil {
 		return nil, nil, errors.WithStack(err)
 	}
 	productionSet := onecrl.NewSetFrom(production)
 	/////////
 	staging := StagingCollection()
-	err = u.staging.AllRecords(staging)
+	err = fetch(ctx, u.staging, staging, "staging")
 	if err != nil {
 		return nil, nil, errors.WithStack(err)
 	}
@@ -403,7 +583,7 @@ func (u *Updater) getDataSets() (*onecrl.Set, *ccadb.Set, error) {
 	//////
 	oneCRLUnion := productionSet.Union(stagingSet).(*onecrl.Set)
 	//////
-	ccadbRecords, err := ccadb.Default()
+	ccadbRecords, err := CCADBReport()
 	if err != nil {
 		return nil, nil, errors.WithStack(err)
 	}
@@ -411,44 +591,209 @@ func (u *Updater) getDataSets() (*onecrl.Set, *ccadb.Set, error) {
 	return oneCRLUnion, ccadbSet, nil
 }
 
+// fetch retrieves every record within the given collection. If OneCRLMirrorDir is
+// configured, then this is done by syncing the on-disk mirror of the collection.
+func fetch(ctx context.Context, client *kinto.Client, collection *onecrl.OneCRL, name string) error {
+	dir := os.Getenv(OneCRLMirrorDir)
+	if dir == "" {
+		return client.AllRecordsContext(ctx, collection)
+	}
+	m := mirror.New(client, collection, filepath.Join(dir, name+".json"))
+	changes, err := m.SyncContext(ctx)
+	if err != nil {
+		return err
+	}
+	log.WithField("mirror", m.Path()).
+		WithField("changed", len(changes.Changed)).
+		WithField("deleted", len(changes.Deleted)).
+		Debug("synced OneCRL mirror")
+	return m.Unmarshal(collection)
+}
+
+// ValidateChanges validates every change found by FindDiffs against the JSON schema of the
+// staging collection. Changes are not validated if the collection does not have a schema
+// (or has one that cannot be validated locally).
+func (u *Updater) ValidateChanges(ctx context.Context) error {
+	s, err := u.staging.CollectionSchemaContext(ctx, StagingCollection())
+	if errors.Is(err, schema.ErrUnsupported) {
+		log.WithError(err).Warn("the staging collection's schema cannot be checked locally, so changes will not be validated")
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if s == nil {
+		log.Debug("the staging collection does not have a schema, so changes will not be validated")
+		return nil
+	}
+	invalid := 0
+	var first error
+	for _, record := range u.changes {
+		e := s.Validate(record)
+		if e == nil {
+			continue
+		}
+		log.WithField("issuer", record.IssuerName).
+			WithField("serial", record.SerialNumber).
+			WithField("subject", record.Subject).
+			WithField("pubKeyHash", record.PubKeyHash).
+			WithError(e).
+			Error("change does not satisfy the schema of the staging collection")
+		if first == nil {
+			first = e
+		}
+		invalid++
+	}
+	if invalid > 0 {
+		return errors.Wrapf(first, "%d of %d changes do not satisfy the schema of the staging collection, "+
+			"the first being", invalid, len(u.changes))
+	}
+	return nil
+}
+
 func (u *Updater) NoDiffs() bool {
 	return len(u.changes) == 0
 }
 
-func (u *Updater) AnySignerInReview() (bool, error) {
-	stagingStatus, err := u.staging.SignerStatusFor(StagingCollection())
+func (u *Updater) AnySignerInReview(ctx context.Context) (bool, error) {
+	stagingStatus, err := u.staging.SignerStatusForContext(ctx, StagingCollection())
 	if err != nil {
 		return false, errors.WithStack(err)
 	}
-	prodStatus, err := u.production.SignerStatusFor(ProductionCollection())
+	prodStatus, err := u.production.SignerStatusForContext(ctx, ProductionCollection())
 	if err != nil {
 		return false, errors.WithStack(err)
 	}
+	u.stagingStatus, u.productionStatus = stagingStatus, prodStatus
 	return stagingStatus.InReview() || prodStatus.InReview(), nil
 }
 
-func (u *Updater) PushToStaging() transaction.Transactor {
-	committed := 0
+// ReviewSummary describes every review that is pending (as of AnySignerInReview), how long
+// it has been waiting as of the given time, and who requested it. For example:
+//
+//	Staging has been in review for 3 days (since 2021-02-26T00:06:02Z), requested by account:alice: "Bug 1234"
+func (u *Updater) ReviewSummary(now time.Time) []string {
+	summary := make([]string, 0, 2)
+	for _, review := range []struct {
+		name   string
+		status *kintosigner.Status
+	}{{"Staging", u.stagingStatus}, {"Production", u.productionStatus}} {
+		if review.status == nil || !review.status.InReview() {
+			continue
+		}
+		line := review.name + " has been in review"
+		if since, ok := review.status.PendingSince(); ok {
+			line += fmt.Sprintf(" for %s (since %s)", humanize(now.Sub(since)), since.UTC().Format(time.RFC3339))
+		}
+		if by := review.status.Data.LastReviewRequestBy; by != "" {
+			line += ", requested by " + by
+		}
+		if comment := review.status.Data.LastEditorComment; comment != "" {
+			line += fmt.Sprintf(": %q", comment)
+		}
+		summary = append(summary, line)
+	}
+	return summary
+}
+
+// OpenBugs returns every bug filed by this tool (on any run) that is yet to be resolved, oldest first.
+func (u *Updater) OpenBugs(ctx context.Context) ([]bugs.Bug, error) {
+	search := new(bugs.Search).
+		AddProducts(bugProduct).
+		AddComponents(bugComponent).
+		AddStatuses(bugs.OpenStatuses...).
+		WithSummary(bugSummaryPrefix).
+		Include("id", "summary", "status", "creation_time", "last_change_time")
+	resp, err := u.bugzilla.SearchBugsContext(ctx, search)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sort.Slice(resp.Bugs, func(i, j int) bool { return resp.Bugs[i].ID < resp.Bugs[j].ID })
+	return resp.Bugs, nil
+}
+
+// BugReport describes each of the given bugs, how long it has been open as of the given time, and when it
+// last changed. For example:
+//
+//	https://bugzilla.mozilla.org/show_bug.cgi?id=1234 (NEW) has been open for 3 days, last changed 2021-02-27T00:05:00Z
+func (u *Updater) BugReport(open []bugs.Bug, now time.Time) []string {
+	report := make([]string, 0, len(open))
+	for _, bug := range open {
+		line := fmt.Sprintf("%s (%s)", u.bugzilla.ShowBug(bug.ID), bug.Status)
+		if created, err := time.Parse(time.RFC3339, bug.CreationTime); err == nil {
+			line += " has been open for " + humanize(now.Sub(created))
+		}
+		if bug.LastChangeTime != "" {
+			line += ", last changed " + bug.LastChangeTime
+		}
+		report = append(report, line)
+	}
+	return report
+}
+
+// ReportOpenBugs logs the BugReport of the OpenBugs. This is purely informational,
+// so failing to search Bugzilla is logged rather than returned.
+func (u *Updater) ReportOpenBugs(ctx context.Context) {
+	open, err := u.OpenBugs(ctx)
+	if err != nil {
+		log.WithError(err).Warn("failed to search Bugzilla for open bugs")
+		return
+	}
+	log.WithField("count", len(open)).Info("bugs filed by earlier runs that are still open")
+	for _, line := range u.BugReport(open, time.Now()) {
+		log.Info(line)
+	}
+}
+
+// humanize rounds the given duration to whole days, or to whole hours if it is under two days.
+func humanize(d time.Duration) string {
+	if d >= time.Hour*48 {
+		return fmt.Sprintf("%d days", int(d/(time.Hour*24)))
+	}
+	hours := int(d / time.Hour)
+	if hours == 1 {
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d hours", hours)
+}
+
+func (u *Updater) PushToStaging(ctx context.Context) transaction.Transactor {
 	return transaction.NewTransaction().WithCommit(func() error {
 		collection := StagingCollection()
+		u.staged = make([]*api.Record, 0, len(u.changes))
 		for _, record := range u.changes {
-			err := u.staging.NewRecord(collection, record)
+			err := u.staging.NewRecordContext(ctx, collection, record)
 			if err != nil {
 				return errors.WithStack(err)
 			}
-			committed += 1
+			u.staged = append(u.staged, &api.Record{Id: record.Id, LastModified: record.LastModified})
 		}
 		return nil
 	}).WithRollback(func(_ error) error {
+		ctx, cancel := rollbackContext()
+		defer cancel()
 		// Try to delete as many of the entries that we can that
 		// WERE successfully inserted. Single error while deleting
 		// does not fail out the entire rollback, so it is possible
 		// for this rollback to leave orphaned data on staging
 		// the service is degraded and only sporadically failing.
+		//
+		// Deletions are conditioned on the record being unmodified since
+		// we last wrote it, so that we never delete an entry that someone
+		// else has since picked up and changed.
 		var err error = nil
 		collection := StagingCollection()
-		for i := 0; i < committed; i++ {
-			_, e := u.staging.Delete(collection, u.changes[i])
+		for _, record := range u.staged {
+			_, e := u.staging.DeleteIfUnmodifiedContext(ctx, collection, record)
+			switch {
+			case kinto.IsNotFound(e):
+				// Someone beat us to it, which is just as good.
+				log.WithField("id", record.ID()).Info("staging record was already deleted")
+				continue
+			case kinto.IsConflict(e):
+				log.WithField("id", record.ID()).
+					Warn("refusing to delete a staging record that was modified by someone else since it was created")
+			}
 			if e != nil {
 				if err == nil {
 					err = e
@@ -474,7 +819,7 @@ const attachmentWarning = "received an error while uploading an attachment to Bu
 // as well as the OneCRL representation side-by-side.
 //
 // If configured, then emails in BugzillaCcAccounts will be put on CC.
-func (u *Updater) OpenBug() transaction.Transactor {
+func (u *Updater) OpenBug(ctx context.Context) transaction.Transactor {
 	u.bugID = -1
 	return transaction.NewTransaction().WithCommit(func() error {
 		// Human readable, line delimited, "issuer: %s serial: %s"
@@ -500,9 +845,9 @@ func (u *Updater) OpenBug() transaction.Transactor {
 			log.WithField("CC", cc).Debug("using CC environment variable")
 		}
 		bug := &bugs.Create{
-			Product:     "Core",
-			Component:   "Security Block-lists, Allow-lists, and other State",
-			Summary:     fmt.Sprintf("CCADB entries generated %s", time.Now().UTC().Format(time.RFC3339)),
+			Product:     bugProduct,
+			Component:   bugComponent,
+			Summary:     fmt.Sprintf("%s %s", bugSummaryPrefix, time.Now().UTC().Format(time.RFC3339)),
 			Version:     "unspecified",
 			Severity:    "normal",
 			Type:        "enhancement",
@@ -510,7 +855,7 @@ func (u *Updater) OpenBug() transaction.Transactor {
 			Cc:          cc,
 		}
 		log.WithField("payload", bug).Debug("sending bugzilla creation payload")
-		resp, err := u.bugzilla.CreateBug(bug)
+		resp, err := u.bugzilla.CreateBugContext(ctx, bug)
 		if err != nil {
 			log.WithError(err).Error("bugzilla create failed")
 			return errors.WithStack(err)
@@ -523,7 +868,7 @@ func (u *Updater) OpenBug() transaction.Transactor {
 			record.Details.Bug = u.bugzilla.ShowBug(u.bugID)
 		}
 		log.WithField("issuerSerialPairs", issuerSerialPairs).Debug("attempting to post issuer/serial pairs")
-		_, err = u.bugzilla.CreateAttachment((&attachments.Create{
+		_, err = u.bugzilla.CreateAttachmentContext(ctx, (&attachments.Create{
 			BugId:       resp.Id,
 			Data:        []byte(issuerSerialPairs),
 			FileName:    "BugData.txt",
@@ -538,7 +883,7 @@ func (u *Updater) OpenBug() transaction.Transactor {
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		_, err = u.bugzilla.CreateAttachment((&attachments.Create{
+		_, err = u.bugzilla.CreateAttachmentContext(ctx, (&attachments.Create{
 			BugId:       resp.Id,
 			Data:        additions,
 			FileName:    "OneCRLAdditions.txt",
@@ -564,7 +909,7 @@ func (u *Updater) OpenBug() transaction.Transactor {
 			return errors.WithStack(err)
 		}
 		log.WithField("comparison", comparisons).Debug("attempting to post OneCRL/CCADB comparison")
-		_, err = u.bugzilla.CreateAttachment((&attachments.Create{
+		_, err = u.bugzilla.CreateAttachmentContext(ctx, (&attachments.Create{
 			BugId:       resp.Id,
 			Data:        d,
 			FileName:    "DecodedEntries.txt",
@@ -589,24 +934,27 @@ func (u *Updater) OpenBug() transaction.Transactor {
 				"closed. Please review the provided cause and call site of the cause for more information.")
 		log.WithError(cause).WithField("bugzilla", u.bugzilla.ShowBug(u.bugID)).Error("closing the listed " +
 			"bug due to a critical failure")
-		_, err := u.bugzilla.UpdateBug(bugs.Invalidate(u.bugID, report.String()))
+		ctx, cancel := rollbackContext()
+		defer cancel()
+		_, err := u.bugzilla.UpdateBugContext(ctx, bugs.Invalidate(u.bugID, report.String()))
 		return errors.WithStack(err)
 	})
 }
 
 // After we have created the bug in question on Bugzilla, we need to go back to
 // staging and update the records with the Bugzilla ID.
-func (u *Updater) UpdateRecordsWithBugID() transaction.Transactor {
+func (u *Updater) UpdateRecordsWithBugID(ctx context.Context) transaction.Transactor {
 	return transaction.NewTransaction().WithCommit(func() error {
 		collection := StagingCollection()
-		for _, record := range u.changes {
+		for i, record := range u.changes {
 			if record == nil {
 				continue
 			}
-			err := u.staging.UpdateRecord(collection, record)
+			err := u.staging.UpdateRecordIfUnmodifiedContext(ctx, collection, record)
 			if err != nil {
 				return errors.WithStack(err)
 			}
+			u.staged[i].LastModified = record.LastModified
 		}
 		return nil
 	}).WithRollback(func(_ error) error {
@@ -616,22 +964,25 @@ func (u *Updater) UpdateRecordsWithBugID() transaction.Transactor {
 	})
 }
 
-func (u *Updater) PutStagingIntoReview() transaction.Transactor {
+func (u *Updater) PutStagingIntoReview(ctx context.Context) transaction.Transactor {
 	return transaction.NewTransaction().WithCommit(func() error {
-		return errors.WithStack(u.staging.ToReview(StagingCollection()))
+		return errors.WithStack(u.staging.ToReviewContext(ctx, StagingCollection()))
 	}).WithRollback(func(_ error) error {
-		return errors.WithStack(u.staging.ToRollBack(StagingCollection()))
+		ctx, cancel := rollbackContext()
+		defer cancel()
+		return rollBack(ctx, u.staging, StagingCollection(), "staging")
 	})
 }
 
-func (u *Updater) PushToProduction() transaction.Transactor {
+func (u *Updater) PushToProduction(ctx context.Context) transaction.Transactor {
 	return transaction.NewTransaction().WithCommit(func() error {
 		collection := ProductionCollection()
 		for _, record := range u.changes {
-			// If we do not set the ID back to default then production will
-			// end up having IDs that were generated by staging rather than itself.
-			record.Id = ""
-			err := u.production.NewRecord(collection, record)
+			// If we do not clear out the Kinto metadata then production will end up having
+			// IDs that were generated by staging rather than itself. The staging metadata
+			// is still held within u.staged in case we need to roll back.
+			record.Record = nil
+			err := u.production.NewRecordContext(ctx, collection, record)
 			if err != nil {
 				return errors.WithStack(err)
 			}
@@ -640,18 +991,39 @@ func (u *Updater) PushToProduction() transaction.Transactor {
 	})
 }
 
-func (u *Updater) PutProductionIntoReview() transaction.Transactor {
+func (u *Updater) PutProductionIntoReview(ctx context.Context) transaction.Transactor {
 	return transaction.NewTransaction().WithCommit(func() error {
-		return errors.WithStack(u.production.ToReview(ProductionCollection()))
+		return errors.WithStack(u.production.ToReviewContext(ctx, ProductionCollection()))
 	}).WithRollback(func(_ error) error {
-		return errors.WithStack(u.production.ToRollBack(ProductionCollection()))
+		ctx, cancel := rollbackContext()
+		defer cancel()
+		return rollBack(ctx, u.production, ProductionCollection(), "production")
 	})
 }
 
-func (u *Updater) BlastEmails(intersection *onecrl.Set) {
+// rollBack asks the signer to roll back any changes made to the given collection. If we were
+// never permitted to do so then retrying will not help, so the operator is told as much.
+func rollBack(ctx context.Context, client *kinto.Client, collection *onecrl.OneCRL, name string) error {
+	err := client.ToRollBackContext(ctx, collection)
+	if kinto.IsUnauthorized(err) || kinto.IsForbidden(err) {
+		return errors.Wrapf(err, "the account for %s Kinto may not roll back %s, "+
+			"the collection must be rolled back by hand", name, collection.Get())
+	}
+	return errors.WithStack(err)
+}
+
+// rollbackContext returns a fresh context for rolling back a failed run.
+//
+// This is intentionally NOT derived from the run's context, as a run that
+// failed due to its deadline must still be able to clean up after itself.
+func rollbackContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), rollbackTimeout)
+}
+
+func (u *Updater) BlastEmails(ctx context.Context, intersection *onecrl.Set) {
 	bugIDs := make(map[int]bool, 0)
 	builder := strings.Builder{}
-	builder.WriteString("Changes are still in review. The following bugs appear to require resolution.\n")
+	builder.WriteString(reminderPrefix + " The following bugs appear to require resolution.\n")
 	for e := range intersection.Iter() {
 		entry := e.(*onecrl.Record)
 		id, err := u.bugzilla.IDFromShowBug(entry.Details.Bug)
@@ -666,16 +1038,45 @@ func (u *Updater) BlastEmails(intersection *onecrl.Set) {
 		}
 		builder.WriteByte('\t')
 		builder.WriteString(entry.Details.Bug)
+		builder.WriteByte('\n')
 		bugIDs[id] = true
 	}
+	for _, line := range u.ReviewSummary(time.Now()) {
+		log.Info(line)
+		builder.WriteString(line)
+		builder.WriteByte('\n')
+	}
 	for id := range bugIDs {
-		_, err := u.bugzilla.UpdateBug(&bugs.Update{
-			Id:      id,
-			Ids:     []int{id},
-			Comment: &bugs.Comment{Body: builder.String()},
+		if u.RecentlyReminded(ctx, id) {
+			log.WithField("ID", id).Info("blocking bug has already been pinged recently")
+			continue
+		}
+		_, err := u.bugzilla.UpdateBugContext(ctx, &bugs.Update{
+			Id:          id,
+			Ids:         []int{id},
+			Comment:     &bugs.Comment{Body: builder.String()},
+			CommentTags: []string{reminderTag},
 		})
 		if err != nil {
 			log.WithError(err).WithField("ID", id).Warn("failed to ping blocking bug")
 		}
 	}
 }
+
+// RecentlyReminded returns whether the given bug has received a reminder from BlastEmails within the
+// last reminderInterval. Reminders are recognized by their tag or, for those posted before reminders
+// were tagged, by their text. Should the comments of the bug not be retrievable then it is assumed
+// that no reminder has been posted, as a duplicate reminder is preferable to a missing one.
+func (u *Updater) RecentlyReminded(ctx context.Context, bug int) bool {
+	comments, err := u.bugzilla.GetCommentsContext(ctx, bug, time.Now().Add(-reminderInterval))
+	if err != nil {
+		log.WithError(err).WithField("ID", bug).Warn("failed to retrieve the comments of blocking bug")
+		return false
+	}
+	for _, comment := range comments {
+		if comment.HasTag(reminderTag) || strings.HasPrefix(comment.Text, reminderPrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,31 +5,42 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/joho/godotenv"
+	bugzAuth "github.com/mozilla/OneCRL-Tools/bugzilla/api/auth"
+	"github.com/mozilla/OneCRL-Tools/bugzilla/api/bugs"
+	bugzilla "github.com/mozilla/OneCRL-Tools/bugzilla/client"
+	bugzfake "github.com/mozilla/OneCRL-Tools/bugzilla/fake"
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/auth"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/authz"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/batch"
 
 	"github.com/mozilla/OneCRL-Tools/ccadb2OneCRL/onecrl"
 	"github.com/mozilla/OneCRL-Tools/kinto"
+	kintolocal "github.com/mozilla/OneCRL-Tools/kinto/local"
 )
 
 func TestE2E(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping docker end-to-end test because -short")
-		return
-	}
-
-	setup()
-	c, err := godotenv.Unmarshal(testConfig)
+	bugz := bugzfake.New().AddUser("chris@chenderson.org", "")
+	bugzServer := httptest.NewServer(bugz)
+	defer bugzServer.Close()
+	ccadbServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join("testdata", "ccadb.csv"))
+	}))
+	defer ccadbServer.Close()
+	c, err := godotenv.Unmarshal(fmt.Sprintf(testConfig, setup(t), bugzServer.URL, bugzfake.APIKey, ccadbServer.URL))
 	if err != nil {
 		panic(err)
 	}
@@ -38,8 +49,26 @@ func TestE2E(t *testing.T) {
 		if err != nil {
 			panic(err)
 		}
+		// Otherwise the configuration of this test leaks into those that follow.
+		k := k
+		t.Cleanup(func() { _ = os.Unsetenv(k) })
 	}
 	_main()
+	// The one CCADB entry of testdata/ccadb.csv is not within OneCRL, so it should
+	// have been filed in a bug and added to both staging and production.
+	if bugz.Bugs() != 1 {
+		t.Errorf("expected exactly one bug to be filed, got %d", bugz.Bugs())
+	}
+	for _, bucket := range []string{"security-state-staging", "production-security-state"} {
+		collection := onecrl.NewOneCRL()
+		collection.Bucket.ID = bucket
+		if err := local.AllRecords(collection); err != nil {
+			t.Fatal(err)
+		}
+		if len(collection.Data) != 4 {
+			t.Errorf("expected %s to hold the 3 records of the fixture and the 1 new record, got %d", bucket, len(collection.Data))
+		}
+	}
 }
 
 var dev = &auth.User{
@@ -56,84 +85,61 @@ var devRW = &authz.Permissions{
 	Read:  []string{"system.Everyone"},
 }
 
-var local = kinto.NewClient("http", "localhost:8888", "/v1").WithAuthenticator(dev)
-var staging = kinto.NewClient("https", "firefox.settings.services.allizom.org", "/v1")
-var production = kinto.NewClient("https", "firefox.settings.services.mozilla.com", "/v1")
+// local is a client of the SQLite backed Kinto served for the duration of TestE2E (see makeLocal).
+var local *kinto.Client
 
-func setup() {
-	makeLocal()
-	syncStaging()
-	syncProduction()
+// setup serves a local Kinto whose staging and production both hold the OneCRL records
+// of testdata/onecrl.json, and returns its URL.
+func setup(t *testing.T) string {
+	u := makeLocal(t)
+	seed(t, "security-state-staging")
+	seed(t, "production-security-state")
+	return u
 }
 
-func syncStaging() {
-	dataA := onecrl.NewOneCRL()
-	if err := staging.AllRecords(dataA); err != nil {
-		panic(err)
-	}
-	d := make([]interface{}, len(dataA.Data))
-	for i, v := range dataA.Data {
-		d[i] = v
-	}
-	max, err := local.BatchMaxRequests()
+// seed copies the OneCRL records of testdata/onecrl.json into the OneCRL collection of the given bucket.
+func seed(t *testing.T, bucket string) {
+	f, err := os.Open(filepath.Join("testdata", "onecrl.json"))
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	batches := batch.NewBatches(d, max, nil, http.MethodPost, dataA.Get())
-	for _, b := range batches {
-		if err := local.Batch(b); err != nil {
-			panic(err)
-		}
-	}
-}
-
-func syncProduction() {
-	dataA := onecrl.NewOneCRL()
-	if err := production.AllRecords(dataA); err != nil {
-		panic(err)
+	defer f.Close()
+	fixture := onecrl.NewOneCRL()
+	if err := json.NewDecoder(f).Decode(fixture); err != nil {
+		t.Fatal(err)
 	}
-	d := make([]interface{}, len(dataA.Data))
-	for i, v := range dataA.Data {
+	d := make([]interface{}, len(fixture.Data))
+	for i, v := range fixture.Data {
 		d[i] = v
 	}
 	max, err := local.BatchMaxRequests()
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	dataA.Bucket.ID = "production-security-state"
-	batches := batch.NewBatches(d, max, nil, http.MethodPost, dataA.Get())
-	for _, b := range batches {
+	fixture.Bucket.ID = bucket
+	for _, b := range batch.NewBatches(d, max, nil, http.MethodPost, fixture.Get()) {
 		if err := local.Batch(b); err != nil {
-			panic(err)
+			t.Fatal(err)
 		}
 	}
 }
 
-func makeLocal() {
-	cwd, err := os.Getwd()
+// makeLocal serves a fresh SQLite backed Kinto, with the same accounts, buckets, and
+// collections that the Docker based Kinto used to be set up with, and returns its URL.
+func makeLocal(t *testing.T) string {
+	server, err := kintolocal.NewServer(":memory:", kintolocal.DefaultConfig())
 	if err != nil {
 		panic(err)
 	}
-	dir := filepath.Join(filepath.Dir(cwd), "kinto", "local")
-	down := exec.Command("docker-compose", "down")
-	down.Dir = dir
-	out, err := down.CombinedOutput()
-	if err != nil {
-		panic(fmt.Sprintf("KINTO_TESTDIR: '%s', Output: '%s', Error:'%v'", dir, string(out), err))
-	}
-	up := exec.Command("docker-compose", "up")
-	up.Dir = dir
-	err = up.Start()
+	s := httptest.NewServer(server)
+	t.Cleanup(func() {
+		s.Close()
+		_ = server.Close()
+	})
+	local, err = kinto.NewClientFromStr(s.URL + kintolocal.Base)
 	if err != nil {
 		panic(err)
 	}
-	start := time.Now()
-	for !local.Alive() {
-		time.Sleep(time.Millisecond * 200)
-		if time.Now().Sub(start) > time.Minute {
-			panic("took more than one minute to docker-compose up")
-		}
-	}
 	local.WithAuthenticator(&auth.Unauthenticated{})
 	err = local.NewAdmin(admin.Password)
 	if err != nil {
@@ -162,6 +168,7 @@ func makeLocal() {
 	if err != nil {
 		panic(err)
 	}
+	return s.URL + kintolocal.Base
 }
 
 func TestKintoPrincipal(t *testing.T) {
@@ -215,23 +222,292 @@ func TestKintoPrincipal4(t *testing.T) {
 	}
 }
 
+// testConfig is formatted with the URL of the local Kinto, which serves as both staging and production,
+// followed by the URL and API key of a fake Bugzilla and the URL of the CCADB report.
 const testConfig = `
-ONECRL_PRODUCTION="http://localhost:8888/v1"
+ONECRL_PRODUCTION="%[1]s"
 ONECRL_PRODUCTION_USER="superDev"
 ONECRL_PRODUCTION_PASSWORD="password"
 
-ONECRL_STAGING="http://localhost:8888/v1"
+ONECRL_STAGING="%[1]s"
 ONECRL_STAGING_USER="superDev"
 ONECRL_STAGING_PASSWORD="password"
 
 ONECRL_STAGING_BUCKET="production-security-state"
 ONECRL_STAGING_COLLECTION="onecrl"
 
-BUGZILLA="https://bugzilla-dev.allizom.org"
-BUGZILLA_API_KEY="PcKr3LgH6bL0WDXlPuC0wLhFTUuhT8UJSvPKF0UQ"
+BUGZILLA="%[2]s"
+BUGZILLA_API_KEY="%[3]s"
 BUGZILLA_CC_ACCOUNTS="chris@chenderson.org"
 
+CCADB="%[4]s"
+
 LOG_LEVEL="trace"
 
 LOG_DIR=/tmp/ccadb2onecrl/logs
 `
+
+func TestParseRunTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"", runTimeoutDefault, false},
+		{"30m", time.Minute * 30, false},
+		{"90s", time.Second * 90, false},
+		{"-1m", 0, true},
+		{"0s", 0, true},
+		{"an hour", 0, true},
+	} {
+		if err := os.Setenv(RunTimeout, tc.value); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseRunTimeout()
+		if tc.err != (err != nil) {
+			t.Errorf("%q: unexpected error state %v", tc.value, err)
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %s want %s", tc.value, got, tc.want)
+		}
+	}
+	_ = os.Unsetenv(RunTimeout)
+}
+
+func TestParseOpenBugReport(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  bool
+		err   bool
+	}{
+		{"", false, false},
+		{"true", true, false},
+		{"false", false, false},
+		{"sometimes", false, true},
+	} {
+		if err := os.Setenv(OpenBugReport, tc.value); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseOpenBugReport()
+		if tc.err != (err != nil) {
+			t.Errorf("%q: unexpected error state %v", tc.value, err)
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %t want %t", tc.value, got, tc.want)
+		}
+	}
+	_ = os.Unsetenv(OpenBugReport)
+}
+
+// collectionWithSchema serves the metadata of the staging collection with the given schema.
+func collectionWithSchema(t *testing.T, schema string) *kinto.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1"+StagingCollection().Patch() {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_, _ = fmt.Fprintf(w, `{"data": {"id": "onecrl", "schema": %s}}`, schema)
+	}))
+	t.Cleanup(server.Close)
+	c, err := kinto.NewClientFromStr(server.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.WithRetryPolicy(kinto.NoRetries())
+}
+
+func TestValidateChanges(t *testing.T) {
+	staging := collectionWithSchema(t, `{
+		"type": "object",
+		"required": ["details"],
+		"properties": {"issuerName": {"type": "string", "contentEncoding": "base64"}}
+	}`)
+	u := NewUpdate(staging, nil, nil)
+	u.changes = []*onecrl.Record{{IssuerName: "MFAx", SerialNumber: "AQ=="}}
+	if err := u.ValidateChanges(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	u.changes = append(u.changes, &onecrl.Record{IssuerName: "not base64!", SerialNumber: "AQ=="})
+	if err := u.ValidateChanges(context.Background()); err == nil {
+		t.Fatal("expected a record with a malformed issuer to be rejected")
+	}
+}
+
+func TestValidateChangesOfKintoRecords(t *testing.T) {
+	staging := collectionWithSchema(t, `{
+		"type": "object",
+		"required": ["details", "enabled"],
+		"additionalProperties": false,
+		"properties": {
+			"enabled": {"type": "boolean"},
+			"issuerName": {"type": "string", "contentEncoding": "base64"},
+			"serialNumber": {"type": "string", "contentEncoding": "base64"},
+			"subject": {"type": "string", "contentEncoding": "base64"},
+			"pubKeyHash": {"type": "string", "contentEncoding": "base64"},
+			"details": {
+				"type": "object",
+				"additionalProperties": false,
+				"properties": {
+					"bug": {"type": "string"},
+					"who": {"type": "string"},
+					"why": {"type": "string"},
+					"name": {"type": "string"},
+					"created": {"type": "string"}
+				}
+			}
+		}
+	}`)
+	u := NewUpdate(staging, nil, nil)
+	u.changes = []*onecrl.Record{{
+		Schema:       1603376223000,
+		Details:      onecrl.Details{Bug: "https://bugzilla.mozilla.org/show_bug.cgi?id=1", Who: "tester", Name: "Tribute"},
+		IssuerName:   "MFAx",
+		SerialNumber: "AQ==",
+		Record:       &api.Record{Id: "a", LastModified: 1603376223283},
+	}}
+	if err := u.ValidateChanges(context.Background()); err != nil {
+		t.Fatalf("expected the fields managed by Kinto to be ignored, got %v", err)
+	}
+}
+
+func TestValidateChangesWithoutSchema(t *testing.T) {
+	u := NewUpdate(collectionWithSchema(t, "null"), nil, nil)
+	u.changes = []*onecrl.Record{{IssuerName: "not base64!", SerialNumber: "AQ=="}}
+	if err := u.ValidateChanges(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// collectionWithStatus serves the given signer metadata for any collection.
+func collectionWithStatus(t *testing.T, metadata string) *kinto.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"data": %s}`, metadata)
+	}))
+	t.Cleanup(server.Close)
+	c, err := kinto.NewClientFromStr(server.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.WithRetryPolicy(kinto.NoRetries())
+}
+
+func TestReviewSummary(t *testing.T) {
+	staging := collectionWithStatus(t, `{
+		"status": "to-review",
+		"last_review_request_by": "account:alice",
+		"last_review_request_date": "2021-02-26T00:06:02.000000+00:00",
+		"last_editor_comment": "Bug 1234"
+	}`)
+	production := collectionWithStatus(t, `{"status": "signed", "last_review_request_date": "2021-01-01T00:00:00+00:00"}`)
+	u := NewUpdate(staging, production, nil)
+	inReview, err := u.AnySignerInReview(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inReview {
+		t.Fatal("expected staging to be in review")
+	}
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	summary := u.ReviewSummary(now)
+	want := `Staging has been in review for 3 days (since 2021-02-26T00:06:02Z), requested by account:alice: "Bug 1234"`
+	if len(summary) != 1 || summary[0] != want {
+		t.Errorf("expected %q, got %q", want, summary)
+	}
+}
+
+// serverWithCapabilities serves a root resource which advertises the given capabilities.
+func serverWithCapabilities(t *testing.T, capabilities string) *kinto.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"url": "http://%s/v1/", "capabilities": %s}`, r.Host, capabilities)
+	}))
+	t.Cleanup(server.Close)
+	c, err := kinto.NewClientFromStr(server.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.WithRetryPolicy(kinto.NoRetries())
+}
+
+func TestRequireCapabilities(t *testing.T) {
+	signed := serverWithCapabilities(t, `{"signer": {"resources": []}, "history": {}}`)
+	unsigned := serverWithCapabilities(t, `{"history": {}}`)
+	if err := NewUpdate(signed, signed, nil).RequireCapabilities(context.Background()); err != nil {
+		t.Error(err)
+	}
+	err := NewUpdate(signed, unsigned, nil).RequireCapabilities(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "production Kinto cannot be updated") || !strings.Contains(err.Error(), kinto.SignerCapability) {
+		t.Errorf("expected production to be missing the signer, got %v", err)
+	}
+}
+
+func TestOpenBugs(t *testing.T) {
+	server := httptest.NewServer(bugzfake.New())
+	defer server.Close()
+	bugz := bugzilla.NewClient(server.URL).WithAuth(&bugzAuth.ApiKey{ApiKey: bugzfake.APIKey})
+	for _, summary := range []string{
+		bugSummaryPrefix + " 2021-02-26T00:05:00Z",
+		"Something else entirely",
+		bugSummaryPrefix + " 2021-03-01T00:05:00Z",
+		bugSummaryPrefix + " 2021-03-02T00:05:00Z",
+	} {
+		_, err := bugz.CreateBug(&bugs.Create{Product: bugProduct, Component: bugComponent, Summary: summary, Version: "unspecified"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bugz.UpdateBug(bugs.Invalidate(4, "Rolled back.")); err != nil {
+		t.Fatal(err)
+	}
+	u := NewUpdate(nil, nil, bugz)
+	open, err := u.OpenBugs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 2 || open[0].ID != 1 || open[1].ID != 3 {
+		t.Fatalf("expected bugs 1 and 3 to be open, got %+v", open)
+	}
+	created, err := time.Parse(time.RFC3339, open[0].CreationTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := u.BugReport(open, created.Add(time.Hour*24*3))
+	want := fmt.Sprintf("%s (NEW) has been open for 3 days, last changed %s", bugz.ShowBug(1), open[0].LastChangeTime)
+	if len(report) != 2 || report[0] != want {
+		t.Errorf("expected a report starting with %q, got %q", want, report)
+	}
+}
+
+func TestBlastEmailsRemindsOnce(t *testing.T) {
+	b := bugzfake.New()
+	server := httptest.NewServer(b)
+	defer server.Close()
+	bugz := bugzilla.NewClient(server.URL).WithAuth(&bugzAuth.ApiKey{ApiKey: bugzfake.APIKey})
+	intersection := onecrl.NewSet()
+	for _, summary := range []string{bugSummaryPrefix + " 2021-02-26T00:05:00Z", bugSummaryPrefix + " 2021-03-01T00:05:00Z"} {
+		created, err := bugz.CreateBug(&bugs.Create{Product: bugProduct, Component: bugComponent, Summary: summary, Version: "unspecified"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		intersection.Add(&onecrl.Record{
+			IssuerName:   "MFAx",
+			SerialNumber: base64.StdEncoding.EncodeToString([]byte{byte(created.Id)}),
+			Details:      onecrl.Details{Bug: bugz.ShowBug(created.Id)},
+		})
+	}
+	// The second bug was reminded before reminders were tagged.
+	legacy := "Changes are still in review. The following bugs appear to require resolution.\n\t" + bugz.ShowBug(2)
+	if _, err := bugz.UpdateBug(bugs.AddComment(2, legacy)); err != nil {
+		t.Fatal(err)
+	}
+	u := NewUpdate(nil, nil, bugz)
+	for run := 0; run < 2; run++ {
+		u.BlastEmails(context.Background(), intersection)
+	}
+	for id, want := range map[int]int{1: 2, 2: 2} {
+		if comments := b.Comments(id); len(comments) != want {
+			t.Errorf("expected bug %d to have %d comments, got %+v", id, want, comments)
+		}
+	}
+	if comments := b.Comments(1); !comments[1].HasTag(reminderTag) {
+		t.Errorf("expected the reminder to be tagged, got %+v", comments[1])
+	}
+}
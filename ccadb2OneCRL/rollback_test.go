@@ -0,0 +1,277 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bugzAuth "github.com/mozilla/OneCRL-Tools/bugzilla/api/auth"
+	bugzilla "github.com/mozilla/OneCRL-Tools/bugzilla/client"
+	bugzfake "github.com/mozilla/OneCRL-Tools/bugzilla/fake"
+	"github.com/mozilla/OneCRL-Tools/ccadb2OneCRL/ccadb"
+	"github.com/mozilla/OneCRL-Tools/ccadb2OneCRL/onecrl"
+	"github.com/mozilla/OneCRL-Tools/kinto"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/authz"
+	kintolocal "github.com/mozilla/OneCRL-Tools/kinto/local"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+// A fault fails the nth request (counting from one) whose method and path
+// match the given pattern (E.G. `^POST /v1/.*/records$`).
+type fault struct {
+	pattern string
+	nth     int
+}
+
+// faulty serves the given handler, save for the requests that its faults fail,
+// which are answered with the given status and body instead.
+type faulty struct {
+	handler http.Handler
+	status  int
+	body    string
+	faults  []fault
+	seen    []int
+	lock    sync.Mutex
+}
+
+func (f *faulty) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := r.Method + " " + r.URL.Path
+	fail := false
+	f.lock.Lock()
+	for i, fault := range f.faults {
+		if regexp.MustCompile(fault.pattern).MatchString(request) {
+			f.seen[i]++
+			fail = fail || f.seen[i] == fault.nth
+		}
+	}
+	f.lock.Unlock()
+	if !fail {
+		f.handler.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.status)
+	_, _ = fmt.Fprint(w, f.body)
+}
+
+// serveFaulty serves the given handler, failing the requests of the given faults.
+func serveFaulty(t *testing.T, handler http.Handler, status int, body string, faults []fault) *httptest.Server {
+	s := httptest.NewServer(&faulty{handler: handler, status: status, body: body, faults: faults, seen: make([]int, len(faults))})
+	t.Cleanup(s.Close)
+	return s
+}
+
+const (
+	kintoFault    = `{"code": 503, "errno": 201, "error": "Service Unavailable", "message": "injected fault"}`
+	bugzillaFault = `{"error": true, "code": 100500, "message": "injected fault", "documentation": "https://bugzilla.readthedocs.io/en/latest/api/index.html"}`
+)
+
+// faultyKinto serves a Kinto wherein staging's OneCRL holds a single, signed, record. The returned
+// client is of the Kinto itself (rather than through the faults) so as to inspect its end state.
+func faultyKinto(t *testing.T, faults []fault) (*kinto.Client, *kinto.Client) {
+	config := kintolocal.DefaultConfig()
+	config.Signer.Resources = []*kintosigner.Resource{{
+		Source:      kintosigner.Location{Bucket: "security-state-staging", Collection: "onecrl"},
+		Destination: kintosigner.Location{Bucket: "security-state", Collection: "onecrl"},
+	}}
+	server, err := kintolocal.NewServer(":memory:", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+	direct := httptest.NewServer(server)
+	t.Cleanup(direct.Close)
+	inspector := kintoClient(t, direct.URL)
+	if err := inspector.NewAdmin(admin.Password); err != nil {
+		t.Fatal(err)
+	}
+	inspector.WithAuthenticator(admin)
+	collection := StagingCollection()
+	perms := &authz.Permissions{Read: []string{"system.Everyone"}}
+	if err := inspector.NewBucketWithPermissions(collection.Bucket, perms); err != nil {
+		t.Fatal(err)
+	}
+	if err := inspector.NewCollectionWithPermissions(collection.Collection, perms); err != nil {
+		t.Fatal(err)
+	}
+	if err := inspector.NewRecord(collection, &onecrl.Record{IssuerName: "MFAx", SerialNumber: "AQ=="}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inspector.ToSign(collection); err != nil {
+		t.Fatal(err)
+	}
+	faulted := serveFaulty(t, server, http.StatusServiceUnavailable, kintoFault, faults)
+	return kintoClient(t, faulted.URL).WithAuthenticator(admin), inspector
+}
+
+func kintoClient(t *testing.T, url string) *kinto.Client {
+	c, err := kinto.NewClientFromStr(url + kintolocal.Base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.WithRetryPolicy(kinto.NoRetries())
+}
+
+// changes returns the given number of changes, each revoking a freshly minted certificate.
+func changes(t *testing.T, n int) []*onecrl.Record {
+	records := make([]*onecrl.Record, n)
+	for i := range records {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 1)),
+			Subject:      pkix.Name{CommonName: fmt.Sprintf("Revoked Intermediate %d", i)},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := &ccadb.Certificate{PemInfo: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+		if records[i], err = onecrl.FromCCADB(cert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return records
+}
+
+// state is the end state of staging, production, and Bugzilla after an update.
+type state struct {
+	// The number of records within the OneCRL of staging and production, and the signer's status of each.
+	staging, production             int
+	stagingStatus, productionStatus string
+	// The status (and resolution, if any) of the bug that was filed, or empty if none was.
+	bug         string
+	attachments int
+}
+
+func TestPushChangesRollback(t *testing.T) {
+	const (
+		records    = `^POST /v1/buckets/security-state-staging/collections/onecrl/records$`
+		record     = `^PATCH /v1/buckets/security-state-staging/collections/onecrl/records/[^/]+$`
+		collection = `^PATCH /v1/buckets/security-state-staging/collections/onecrl$`
+		bug        = `^POST /rest/bug$`
+		attachment = `^POST /rest/bug/\d+/attachment$`
+	)
+	wip, review, signed := kintosigner.StatusWorkInProgress, kintosigner.StatusToReview, kintosigner.StatusSigned
+	for _, tc := range []struct {
+		name                          string
+		staging, production, bugzilla []fault
+		err                           bool
+		want                          state
+	}{
+		{
+			name: "no faults",
+			want: state{staging: 4, production: 4, stagingStatus: review, productionStatus: review, bug: "NEW", attachments: 3},
+		},
+		{
+			// The two records that were pushed are deleted, and no bug is ever filed.
+			name:    "third staging record",
+			staging: []fault{{records, 3}},
+			err:     true,
+			want:    state{staging: 1, production: 1, stagingStatus: wip, productionStatus: signed},
+		},
+		{
+			name:     "bug creation",
+			bugzilla: []fault{{bug, 1}},
+			err:      true,
+			want:     state{staging: 1, production: 1, stagingStatus: wip, productionStatus: signed},
+		},
+		{
+			// Attachments are a best effort, so the update carries on without the second.
+			name:     "second attachment",
+			bugzilla: []fault{{attachment, 2}},
+			want:     state{staging: 4, production: 4, stagingStatus: review, productionStatus: review, bug: "NEW", attachments: 2},
+		},
+		{
+			name:    "second staging record update with the bug",
+			staging: []fault{{record, 2}},
+			err:     true,
+			want:    state{staging: 1, production: 1, stagingStatus: wip, productionStatus: signed, bug: "RESOLVED INVALID", attachments: 3},
+		},
+		{
+			// Staging is rolled back by the signer, so there is nothing left for the deletions to do.
+			name:    "staging review request",
+			staging: []fault{{collection, 1}},
+			err:     true,
+			want:    state{staging: 1, production: 1, stagingStatus: signed, productionStatus: signed, bug: "RESOLVED INVALID", attachments: 3},
+		},
+		{
+			// Should the signer fail to roll back staging, then the records are deleted one by one instead.
+			name:    "staging review request and rollback",
+			staging: []fault{{collection, 1}, {collection, 2}},
+			err:     true,
+			want:    state{staging: 1, production: 1, stagingStatus: wip, productionStatus: signed, bug: "RESOLVED INVALID", attachments: 3},
+		},
+		{
+			// PushToProduction cannot roll itself back, so the record that made it to production is left behind.
+			name:       "second production record",
+			production: []fault{{records, 2}},
+			err:        true,
+			want:       state{staging: 1, production: 2, stagingStatus: signed, productionStatus: wip, bug: "RESOLVED INVALID", attachments: 3},
+		},
+		{
+			name:       "production review request",
+			production: []fault{{collection, 1}},
+			err:        true,
+			want:       state{staging: 1, production: 1, stagingStatus: signed, productionStatus: signed, bug: "RESOLVED INVALID", attachments: 3},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			staging, stagingInspector := faultyKinto(t, tc.staging)
+			production, productionInspector := faultyKinto(t, tc.production)
+			fake := bugzfake.New()
+			bugz := serveFaulty(t, fake, http.StatusInternalServerError, bugzillaFault, tc.bugzilla)
+			u := NewUpdate(staging, production, bugzilla.NewClient(bugz.URL).WithAuth(&bugzAuth.ApiKey{ApiKey: bugzfake.APIKey}))
+			u.changes = changes(t, 3)
+			err := u.PushChanges(context.Background())
+			if tc.err != (err != nil) {
+				t.Fatalf("expected an error to be %v, got %v", tc.err, err)
+			}
+			got := state{}
+			got.staging, got.stagingStatus = inspect(t, stagingInspector)
+			got.production, got.productionStatus = inspect(t, productionInspector)
+			if bug, ok := fake.Bug(1); ok {
+				got.bug = strings.TrimSpace(bug.Status + " " + bug.Resolution)
+				got.attachments = len(fake.Attachments(1))
+			}
+			if got != tc.want {
+				t.Errorf("expected %+v, got %+v (err: %v)", tc.want, got, err)
+			}
+		})
+	}
+}
+
+// inspect returns the number of records within the given Kinto's OneCRL, and the signer's status of it.
+func inspect(t *testing.T, client *kinto.Client) (int, string) {
+	collection := StagingCollection()
+	count, err := client.CountRecords(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := client.SignerStatusFor(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count, status.Data.Status
+}
@@ -0,0 +1,35 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// An Alert is sent by Kinto (via the Alert header) when the targeted API
+// is deprecated or is approaching its end of service.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/deprecation.html
+type Alert struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	URL     string `json:"url"`
+}
+
+func parseAlert(header string) *Alert {
+	alert := new(Alert)
+	if err := json.Unmarshal([]byte(header), alert); err != nil {
+		// Be lenient, the message is still worth surfacing.
+		alert.Message = header
+	}
+	return alert
+}
+
+// logAlert is the default handler for Alert headers.
+func logAlert(alert *Alert) {
+	log.Printf("Kinto sent an alert (%s): %s %s\n", alert.Code, alert.Message, alert.URL)
+}
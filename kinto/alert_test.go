@@ -0,0 +1,31 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAlertHandler(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alert", `{"code": "soft-eol", "message": "Service will be decommissioned", "url": "https://example.org/eol"}`)
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}))
+	var got *Alert
+	c.WithAlertHandler(func(alert *Alert) {
+		got = alert
+	})
+	if err := c.AllRecords(NewOneCRL()); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("expected the alert handler to be called")
+	}
+	want := Alert{Code: "soft-eol", Message: "Service will be decommissioned", URL: "https://example.org/eol"}
+	if *got != want {
+		t.Errorf("got %+v want %+v", *got, want)
+	}
+}
@@ -4,10 +4,21 @@
 
 package authz
 
+import (
+	"fmt"
+	"strings"
+)
+
 // https://docs.kinto-storage.org/en/stable/api/1.x/permissions.html#api-principals
 type Permissions struct {
 	Read  []string `json:"read,omitempty"`
 	Write []string `json:"write,omitempty"`
+	// Only meaningful for buckets.
+	CollectionCreate []string `json:"collection:create,omitempty"`
+	// Only meaningful for buckets.
+	GroupCreate []string `json:"group:create,omitempty"`
+	// Only meaningful for collections.
+	RecordCreate []string `json:"record:create,omitempty"`
 }
 
 const (
@@ -15,5 +26,84 @@ const (
 	authenticated = "system.Authenticated"
 )
 
+// The principals which Kinto provides to every request.
+//
+// https://docs.kinto-storage.org/en/stable/api/1.x/permissions.html#api-principals
+const (
+	// Every request, authenticated or not.
+	Everyone = world
+	// Every authenticated request.
+	Authenticated = authenticated
+)
+
+// The permissions that may be granted upon a resource.
+//
+// https://docs.kinto-storage.org/en/stable/api/1.x/permissions.html
+const (
+	Read             = "read"
+	Write            = "write"
+	CollectionCreate = "collection:create"
+	GroupCreate      = "group:create"
+	RecordCreate     = "record:create"
+)
+
 var WorldR = &Permissions{Read: []string{world}}
 var WorldRW = &Permissions{Write: []string{world}, Read: []string{world}}
+
+// Account returns the principal of the Kinto account of the given name.
+//
+// https://docs.kinto-storage.org/en/stable/api/1.x/accounts.html
+func Account(name string) string {
+	return "account:" + name
+}
+
+// An Operation is a single JSON-Patch operation upon the permissions of a resource,
+// which allows for granting (or revoking) a permission without first reading (and
+// thereby racing) the principals which already hold it.
+//
+// https://docs.kinto-storage.org/en/stable/api/1.x/records.html#json-patch-operations
+type Operation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+}
+
+// Grant returns the operation which grants the given permission (E.G. Write) to the given principal.
+func Grant(permission, principal string) Operation {
+	return Operation{Op: "add", Path: path(permission, principal)}
+}
+
+// Revoke returns the operation which revokes the given permission (E.G. Write) from the given principal.
+func Revoke(permission, principal string) Operation {
+	return Operation{Op: "remove", Path: path(permission, principal)}
+}
+
+// pointerEscaper escapes a JSON pointer token (https://tools.ietf.org/html/rfc6901#section-3), which
+// matters for group principals as they are URIs (E.G. "/buckets/main/groups/reviewers").
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func path(permission, principal string) string {
+	return fmt.Sprintf("/permissions/%s/%s", permission, pointerEscaper.Replace(principal))
+}
+
+// Effective is a resource upon which the current user holds some permission, as listed by the
+// permissions endpoint. The bucket and collection IDs are only set for resources within them.
+//
+// https://docs.kinto-storage.org/en/stable/api/1.x/permissions.html#list-every-permissions
+type Effective struct {
+	URI          string   `json:"uri"`
+	ResourceName string   `json:"resource_name"`
+	ID           string   `json:"id"`
+	BucketID     string   `json:"bucket_id,omitempty"`
+	CollectionID string   `json:"collection_id,omitempty"`
+	Permissions  []string `json:"permissions"`
+}
+
+// Has returns whether the given permission is held upon the resource.
+func (e *Effective) Has(permission string) bool {
+	for _, p := range e.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
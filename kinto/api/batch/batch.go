@@ -5,25 +5,79 @@
 package batch
 
 import (
+	"encoding/json"
 	"math"
+	"net/http"
 
 	"github.com/mozilla/OneCRL-Tools/kinto/api"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/authz"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
 )
 
 // https://docs.kinto-storage.org/en/stable/api/1.x/batch.html
 type Batch struct {
-	Defaults *Defaults        `json:"defaults"`
+	Defaults *Defaults        `json:"defaults,omitempty"`
 	Requests []BatchedRequest `json:"requests"`
 }
 
+// A BatchedRequest is a single request within a Batch. Its Method and Path may be
+// left empty if they are instead provided by the Defaults of the Batch.
 type BatchedRequest struct {
-	Body *api.Payload `json:"body"`
+	Method string       `json:"method,omitempty"`
+	Path   string       `json:"path,omitempty"`
+	Body   *api.Payload `json:"body,omitempty"`
 }
 
 type Defaults struct {
-	Method string `json:"method"`
-	Path   string `json:"path"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// BatchResponse is Kinto's answer to a Batch. Kinto responds to the batch itself with a 200 even if
+// some (or all) of the batched requests failed, so each batched request has its own Response.
+//
+// https://docs.kinto-storage.org/en/stable/api/1.x/batch.html
+type BatchResponse struct {
+	// One response per batched request, in the same order as the requests of the Batch.
+	Responses []Response `json:"responses"`
+}
+
+// Response is the result of a single batched request.
+type Response struct {
+	Status  int               `json:"status"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// OK returns whether the batched request succeeded (that is, was a 2xx).
+func (r *Response) OK() bool {
+	return r.Status >= 200 && r.Status < 300
+}
+
+// Unmarshal decodes the body of the batched request's response into the given target.
+func (r *Response) Unmarshal(target interface{}) error {
+	return json.Unmarshal(r.Body, target)
+}
+
+// Succeeded returns the indices (within the Batch) of every request that succeeded.
+func (b *BatchResponse) Succeeded() []int {
+	return b.filter(true)
+}
+
+// Failed returns the indices (within the Batch) of every request that failed.
+func (b *BatchResponse) Failed() []int {
+	return b.filter(false)
+}
+
+func (b *BatchResponse) filter(ok bool) []int {
+	indices := make([]int, 0)
+	for i := range b.Responses {
+		if b.Responses[i].OK() == ok {
+			indices = append(indices, i)
+		}
+	}
+	return indices
 }
 
 func (b *Batch) Post() string {
@@ -32,7 +86,7 @@ func (b *Batch) Post() string {
 
 // NewBatch returns a Batch whose inner requests are homogenous (Kinto allows for mixing requests
 // within batch operations (say, for example, two POSTs of records and one GET of a collection)) however this
-// API does not.
+// API does not. See Builder for constructing batches of mixed requests.
 func NewBatch(records []interface{}, perms *authz.Permissions, method, path string) *Batch {
 	requests := make([]BatchedRequest, len(records))
 	for i, record := range records {
@@ -46,7 +100,7 @@ func NewBatch(records []interface{}, perms *authz.Permissions, method, path stri
 
 // NewBatches returns a slice of Batch whose inner requests are homogenous (Kinto allows for mixing requests
 // within batch operations (say, for example, two POSTs of records and one GET of a collection)) however this
-// API does not.
+// API does not. See Builder for constructing batches of mixed requests.
 //
 // maxRequest must be less-than-or equal to Kinto's configured "batch_max_requests". See Client.BatchMaxRequests for
 // more information on how to retrieve this value programatically.
@@ -60,7 +114,95 @@ func NewBatches(records []interface{}, maxRequests int, perms *authz.Permissions
 	return batches
 }
 
+// A Builder builds batches whose requests may each have their own method and path. This allows for,
+// say, creating new records, patching older ones, and putting the collection into review all at once.
+//
+//	b := batch.NewBuilder().
+//		Create(collection, newRecord, nil).
+//		Update(collection, oldRecord, nil).
+//		Delete(collection, staleRecord).
+//		SignerStatus(collection, kintosigner.ToReview())
+//	_, err := client.BatchAll(b)
+//
+// Requests are sent in the order in which they were added.
+type Builder struct {
+	requests []BatchedRequest
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{requests: make([]BatchedRequest, 0)}
+}
+
+// Create POSTs a new record to the records of the given collection.
+func (b *Builder) Create(collection api.Getter, record interface{}, perms *authz.Permissions) *Builder {
+	return b.Request(http.MethodPost, collection.Get(), api.NewPayload(record, perms))
+}
+
+// Put creates (or replaces) the given record within the given collection.
+func (b *Builder) Put(collection api.Getter, record api.Recorded, perms *authz.Permissions) *Builder {
+	return b.Request(http.MethodPut, recordPath(collection, record), api.NewPayload(record, perms))
+}
+
+// Update PATCHes the given record within the given collection.
+func (b *Builder) Update(collection api.Getter, record api.Recorded, perms *authz.Permissions) *Builder {
+	return b.Request(http.MethodPatch, recordPath(collection, record), api.NewPayload(record, perms))
+}
+
+// Delete deletes the given record from the given collection.
+func (b *Builder) Delete(collection api.Getter, record api.Recorded) *Builder {
+	return b.Request(http.MethodDelete, recordPath(collection, record), nil)
+}
+
+// Get retrieves the given resource (E.G. a collection's records, or a single record).
+func (b *Builder) Get(resource api.Getter) *Builder {
+	return b.Request(http.MethodGet, resource.Get(), nil)
+}
+
+// SignerStatus PATCHes the Kinto Signer status of the given collection (E.G. kintosigner.ToReview()).
+func (b *Builder) SignerStatus(collection api.Patcher, status kintosigner.Status) *Builder {
+	return b.Request(http.MethodPatch, collection.Patch(), api.NewPayload(status.Data, nil))
+}
+
+// Request adds an arbitrary request. The body may be nil.
+func (b *Builder) Request(method, path string, body *api.Payload) *Builder {
+	b.requests = append(b.requests, BatchedRequest{Method: method, Path: path, Body: body})
+	return b
+}
+
+// Len returns the number of requests that have been added.
+func (b *Builder) Len() int {
+	return len(b.requests)
+}
+
+// Build splits the requests into as few batches as possible, each holding no more than maxRequests.
+// A maxRequests of zero (or less) places every request within a single batch.
+//
+// maxRequest must be less-than-or equal to Kinto's configured "batch_max_requests". See Client.BatchMaxRequests for
+// more information on how to retrieve this value programatically.
+func (b *Builder) Build(maxRequests int) []*Batch {
+	if maxRequests <= 0 {
+		maxRequests = len(b.requests)
+	}
+	batches := make([]*Batch, numBatches(len(b.requests), maxRequests))
+	for i := 0; i < len(batches); i++ {
+		start := i * maxRequests
+		end := min(start+maxRequests, len(b.requests))
+		requests := make([]BatchedRequest, end-start)
+		copy(requests, b.requests[start:end])
+		batches[i] = &Batch{Requests: requests}
+	}
+	return batches
+}
+
+func recordPath(collection api.Getter, record api.Recorded) string {
+	return collection.Get() + "/" + record.ID()
+}
+
 func numBatches(records, maxRequests int) int {
+	if records == 0 {
+		return 0
+	}
 	return int(math.Ceil(float64(records) / float64(maxRequests)))
 }
 
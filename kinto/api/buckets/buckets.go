@@ -10,7 +10,8 @@ import (
 
 // https://docs.kinto-storage.org/en/stable/api/1.x/buckets.html
 type Bucket struct {
-	ID string `json:"id"`
+	ID           string `json:"id"`
+	LastModified uint64 `json:"last_modified,omitempty"`
 }
 
 func NewBucket(name string) *Bucket {
@@ -32,3 +33,11 @@ func (b *Bucket) Patch() string {
 func (b *Bucket) Put() string {
 	return b.Get()
 }
+
+func (b *Bucket) Delete() string {
+	return b.Get()
+}
+
+func (b *Bucket) Resource() string {
+	return b.Get()
+}
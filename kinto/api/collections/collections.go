@@ -5,9 +5,11 @@
 package collections
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
 )
 
 // https://docs.kinto-storage.org/en/stable/api/1.x/collections.html
@@ -35,3 +37,47 @@ func (c *Collection) Patch() string {
 func (c *Collection) Put() string {
 	return c.Patch()
 }
+
+func (c *Collection) Delete() string {
+	return c.Patch()
+}
+
+func (c *Collection) Resource() string {
+	return c.Patch()
+}
+
+// Metadata is the content of the collection object itself (as opposed to the records within it).
+// Fields which are left empty are omitted, so that a Metadata may be used to PATCH only the
+// fields that are set.
+//
+// https://docs.kinto-storage.org/en/stable/api/1.x/collections.html
+type Metadata struct {
+	ID           string `json:"id,omitempty"`
+	LastModified uint64 `json:"last_modified,omitempty"`
+	// The JSON schema which every record of the collection must satisfy (see the schema package).
+	//
+	// https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#collection-json-schema
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Presentation hints for the Kinto Admin UI.
+	UISchema      json.RawMessage `json:"uiSchema,omitempty"`
+	DisplayFields []string        `json:"displayFields,omitempty"`
+	Sort          string          `json:"sort,omitempty"`
+	// Fields maintained by the Kinto Signer plugin. Kinto refuses
+	// any attempt to set those other than Status directly.
+	//
+	// https://github.com/Kinto/kinto-signer
+	Status                string `json:"status,omitempty"`
+	LastEditBy            string `json:"last_edit_by,omitempty"`
+	LastEditDate          string `json:"last_edit_date,omitempty"`
+	LastReviewRequestBy   string `json:"last_review_request_by,omitempty"`
+	LastReviewRequestDate string `json:"last_review_request_date,omitempty"`
+	LastReviewBy          string `json:"last_review_by,omitempty"`
+	LastReviewDate        string `json:"last_review_date,omitempty"`
+	LastSignatureBy       string `json:"last_signature_by,omitempty"`
+	LastSignatureDate     string `json:"last_signature_date,omitempty"`
+	LastEditorComment     string `json:"last_editor_comment,omitempty"`
+	LastReviewerComment   string `json:"last_reviewer_comment,omitempty"`
+	// The content signature of the collection, which is only present
+	// upon collections that Kinto Signer publishes (E.G. OneCRL).
+	Signature *kintosigner.Signature `json:"signature,omitempty"`
+}
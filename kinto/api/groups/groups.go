@@ -0,0 +1,69 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package groups
+
+import (
+	"fmt"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+)
+
+// A Group is a named set of principals within a bucket. The group itself is then a principal
+// (see Principal) that may be granted permissions, which is how the Kinto Signer plugin decides
+// who may edit (E.G. "onecrl-editors") and who may review (E.G. "onecrl-reviewers") a collection.
+//
+// https://docs.kinto-storage.org/en/stable/api/1.x/groups.html
+type Group struct {
+	ID           string          `json:"id"`
+	Members      []string        `json:"members"`
+	LastModified uint64          `json:"last_modified,omitempty"`
+	Bucket       *buckets.Bucket `json:"-"`
+}
+
+func NewGroup(bucket *buckets.Bucket, name string, members ...string) *Group {
+	if members == nil {
+		members = []string{}
+	}
+	return &Group{ID: name, Members: members, Bucket: bucket}
+}
+
+func (g *Group) Get() string {
+	return fmt.Sprintf("%s/groups/%s", g.Bucket.Get(), g.ID)
+}
+
+func (g *Group) Post() string {
+	return fmt.Sprintf("%s/groups", g.Bucket.Get())
+}
+
+func (g *Group) Patch() string {
+	return g.Get()
+}
+
+func (g *Group) Put() string {
+	return g.Get()
+}
+
+func (g *Group) Delete() string {
+	return g.Get()
+}
+
+func (g *Group) Resource() string {
+	return g.Get()
+}
+
+// Principal returns the principal by which members of this group are known.
+func (g *Group) Principal() string {
+	return g.Get()
+}
+
+// Has returns whether the given principal is a member of this group.
+func (g *Group) Has(principal string) bool {
+	for _, member := range g.Members {
+		if member == principal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package query builds filtered, sorted, and trimmed views of a Kinto collection.
+//
+// A Query wraps any collection (that is, any api.Getter) and is itself an api.Getter, so it
+// may be given anywhere that the collection itself may be given. Results are unmarshalled
+// into the wrapped collection.
+//
+//	collection := onecrl.NewOneCRL()
+//	q := query.New(collection).
+//		Eq("details.bug", "https://bugzilla.mozilla.org/show_bug.cgi?id=1234").
+//		Gt("last_modified", 1603376223283).
+//		Fields("issuerName", "serialNumber").
+//		Sort("-last_modified")
+//	err := client.AllRecords(q)
+//	fmt.Println(collection.Data)
+//
+// Values are sent as JSON literals, so that the string "123" matches the string "123"
+// rather than the number 123.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/filtering.html
+// https://docs.kinto-storage.org/en/stable/api/1.x/sorting.html
+// https://docs.kinto-storage.org/en/stable/api/1.x/selecting_fields.html
+package query // import "github.com/mozilla/OneCRL-Tools/kinto/api/query"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+)
+
+// A Query is a view over a collection. Every method of a Query modifies it
+// in place and returns it, so that calls may be chained.
+type Query struct {
+	collection api.Getter
+	params     url.Values
+	err        error
+}
+
+// New constructs a query which matches every record of the given collection.
+func New(collection api.Getter) *Query {
+	return &Query{
+		collection: collection,
+		params:     url.Values{},
+	}
+}
+
+// Get returns the collection's endpoint along with this query's parameters.
+func (q *Query) Get() string {
+	if len(q.params) == 0 {
+		return q.collection.Get()
+	}
+	return q.collection.Get() + "?" + q.params.Encode()
+}
+
+// UnmarshalJSON unmarshals into the wrapped collection.
+func (q *Query) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, q.collection)
+}
+
+// Collection returns the collection that this query wraps.
+func (q *Query) Collection() api.Getter {
+	return q.collection
+}
+
+// Err returns the reason why the query cannot be sent, if any. Kinto splits the values given
+// to In and NotIn on commas (without any means of escaping them), so a value which contains a
+// comma cannot be matched. The Kinto client refuses to send a query which has an error.
+func (q *Query) Err() error {
+	return q.err
+}
+
+// Values returns a copy of the query's parameters.
+func (q *Query) Values() url.Values {
+	values := url.Values{}
+	for key, value := range q.params {
+		values[key] = append([]string{}, value...)
+	}
+	return values
+}
+
+// Eq matches records whose field is equal to the given value.
+func (q *Query) Eq(field string, value interface{}) *Query {
+	return q.set(field, value)
+}
+
+// NotEq matches records whose field is not equal to the given value.
+func (q *Query) NotEq(field string, value interface{}) *Query {
+	return q.set("not_"+field, value)
+}
+
+// In matches records whose field is equal to any of the given values. No value may contain
+// a comma (see Err).
+func (q *Query) In(field string, values ...interface{}) *Query {
+	return q.setAll("in_"+field, values)
+}
+
+// NotIn matches records whose field is equal to none of the given values. No value may
+// contain a comma (see Err).
+func (q *Query) NotIn(field string, values ...interface{}) *Query {
+	return q.setAll("exclude_"+field, values)
+}
+
+// Gt matches records whose field is strictly greater than the given value.
+func (q *Query) Gt(field string, value interface{}) *Query {
+	return q.set("gt_"+field, value)
+}
+
+// Lt matches records whose field is strictly less than the given value.
+func (q *Query) Lt(field string, value interface{}) *Query {
+	return q.set("lt_"+field, value)
+}
+
+// Min matches records whose field is greater than or equal to the given value.
+func (q *Query) Min(field string, value interface{}) *Query {
+	return q.set("min_"+field, value)
+}
+
+// Max matches records whose field is less than or equal to the given value.
+func (q *Query) Max(field string, value interface{}) *Query {
+	return q.set("max_"+field, value)
+}
+
+// Like matches records whose field contains the given pattern, wherein "*" is a wildcard.
+func (q *Query) Like(field string, pattern string) *Query {
+	q.params.Set("like_"+field, pattern)
+	return q
+}
+
+// Has matches records which have the given field at all.
+func (q *Query) Has(field string) *Query {
+	q.params.Set("has_"+field, "true")
+	return q
+}
+
+// HasNot matches records which do not have the given field.
+func (q *Query) HasNot(field string) *Query {
+	q.params.Set("has_"+field, "false")
+	return q
+}
+
+// ModifiedSince matches records modified after the given timestamp.
+func (q *Query) ModifiedSince(timestamp uint64) *Query {
+	q.params.Set("_since", strconv.FormatUint(timestamp, 10))
+	return q
+}
+
+// ModifiedBefore matches records modified before the given timestamp.
+func (q *Query) ModifiedBefore(timestamp uint64) *Query {
+	q.params.Set("_before", strconv.FormatUint(timestamp, 10))
+	return q
+}
+
+// Sort orders the results by the given fields, in order of precedence. A field
+// prefixed with "-" is sorted in descending order (E.G. "-last_modified").
+func (q *Query) Sort(fields ...string) *Query {
+	q.params.Set("_sort", strings.Join(fields, ","))
+	return q
+}
+
+// Fields trims every result down to the given fields. The id and
+// last_modified fields are always returned by Kinto.
+func (q *Query) Fields(fields ...string) *Query {
+	q.params.Set("_fields", strings.Join(fields, ","))
+	return q
+}
+
+// Limit sets the number of records returned per page. Calls which walk every page
+// (E.G. AllRecords) still return every match, just over more requests.
+func (q *Query) Limit(limit int) *Query {
+	q.params.Set("_limit", strconv.Itoa(limit))
+	return q
+}
+
+func (q *Query) set(key string, value interface{}) *Query {
+	q.params.Set(key, literal(value))
+	return q
+}
+
+func (q *Query) setAll(key string, values []interface{}) *Query {
+	literals := make([]string, len(values))
+	for i, value := range values {
+		literals[i] = literal(value)
+		if strings.Contains(literals[i], ",") && q.err == nil {
+			q.err = fmt.Errorf("the value %s of %s contains a comma, which Kinto would split into separate values", literals[i], key)
+		}
+	}
+	q.params.Set(key, strings.Join(literals, ","))
+	return q
+}
+
+// literal renders the given value as a JSON literal, which is how Kinto interprets
+// filter values. Anything that fails to marshal is sent as-is.
+func literal(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
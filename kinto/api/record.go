@@ -29,13 +29,35 @@ type Record struct {
 }
 
 func (r *Record) ID() string {
+	if r == nil {
+		return ""
+	}
 	return r.Id
 }
 
+// Version returns the last_modified timestamp of the revision of this record
+// that was last read from (or written to) Kinto. A zero value means that this
+// record has never been seen by Kinto.
+func (r *Record) Version() uint64 {
+	if r == nil {
+		return 0
+	}
+	return r.LastModified
+}
+
 type Recorded interface {
 	ID() string
 }
 
+// A Versioned record knows which revision of itself it was read at, which enables
+// concurrency-safe writes via the If-Match family of headers.
+//
+// For details see https://docs.kinto-storage.org/en/stable/api/1.x/records.html#concurrency-control
+type Versioned interface {
+	Recorded
+	Version() uint64
+}
+
 type DeleteResponse struct {
 	Data struct {
 		Deleted      bool   `json:"deleted"`
@@ -29,3 +29,13 @@ type Patcher interface {
 type Deleter interface {
 	Delete() string
 }
+
+// RecordResource is the Resourcer of a single record within a collection.
+type RecordResource struct {
+	Collection Getter
+	ID         string
+}
+
+func (r *RecordResource) Resource() string {
+	return r.Collection.Get() + "/" + r.ID
+}
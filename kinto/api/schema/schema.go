@@ -0,0 +1,516 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package schema validates records against the JSON schema of a Kinto collection before they are
+// ever sent to Kinto, so that a malformed record is caught up front rather than being rejected by
+// the server with a 400 halfway through a series of writes.
+//
+// Only the subset of JSON Schema that is used by Kinto collections is supported. That is:
+//
+//	type, enum, const
+//	properties, required, additionalProperties
+//	items, minItems, maxItems, uniqueItems
+//	minLength, maxLength, pattern, format (date, date-time, uri, email), contentEncoding (base64)
+//	minimum, maximum, exclusiveMinimum, exclusiveMaximum (as numbers, or as the booleans of draft 4), multipleOf
+//	allOf, anyOf, oneOf, not
+//
+// Any other keyword is ignored, as the specification demands, except for $ref which is
+// refused by Parse (as ignoring it would silently accept anything). Patterns are compiled as
+// RE2 (see the regexp package), and Parse refuses those that are not.
+//
+// For details on collection schemas, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#collection-json-schema
+package schema // import "github.com/mozilla/OneCRL-Tools/kinto/api/schema"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned by Parse for schemas that cannot be validated locally. That is, those
+// that use a keyword which cannot be safely ignored (namely $ref), those with a keyword of a form
+// that cannot be decoded, and those with a pattern that Go does not support (E.G. the lookaheads
+// of ECMA 262 regular expressions).
+var ErrUnsupported = errors.New("schema: unsupported keyword")
+
+// Schema is a parsed JSON schema. Use Parse to construct one.
+type Schema struct {
+	Type                 types              `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                json.RawMessage    `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	UniqueItems          bool               `json:"uniqueItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MultipleOf           *float64           `json:"multipleOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+
+	// The boolean schema false, which matches nothing.
+	never bool
+	// The compiled Pattern.
+	pattern *regexp.Regexp
+	// The decoded Const.
+	constant interface{}
+}
+
+// Parse parses and compiles the given JSON schema.
+func Parse(b []byte) (*Schema, error) {
+	s := new(Schema)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if err := s.compile("#"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UnmarshalJSON accepts both schema objects and the boolean schemas true and false.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	switch string(bytes.TrimSpace(b)) {
+	case "true":
+		*s = Schema{}
+		return nil
+	case "false":
+		*s = Schema{never: true}
+		return nil
+	}
+	type plain Schema
+	aux := struct {
+		*plain
+		ExclusiveMinimum json.RawMessage `json:"exclusiveMinimum,omitempty"`
+		ExclusiveMaximum json.RawMessage `json:"exclusiveMaximum,omitempty"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	var err error
+	if s.ExclusiveMinimum, s.Minimum, err = exclusive(aux.ExclusiveMinimum, s.Minimum); err != nil {
+		return err
+	}
+	s.ExclusiveMaximum, s.Maximum, err = exclusive(aux.ExclusiveMaximum, s.Maximum)
+	return err
+}
+
+// exclusive decodes exclusiveMinimum (or exclusiveMaximum) given the inclusive minimum (or maximum)
+// and returns both bounds. As of draft 6 of JSON Schema the keyword is a number, however in draft 4
+// it was a boolean which, if true, made the minimum (or maximum) itself exclusive.
+func exclusive(keyword json.RawMessage, inclusive *float64) (*float64, *float64, error) {
+	if len(keyword) == 0 {
+		return nil, inclusive, nil
+	}
+	var draft4 bool
+	if err := json.Unmarshal(keyword, &draft4); err == nil {
+		if draft4 {
+			return inclusive, nil, nil
+		}
+		return nil, inclusive, nil
+	}
+	bound := new(float64)
+	if err := json.Unmarshal(keyword, bound); err != nil {
+		return nil, nil, err
+	}
+	return bound, inclusive, nil
+}
+
+func (s *Schema) compile(location string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return fmt.Errorf("%w $ref at %s", ErrUnsupported, location)
+	}
+	if s.Pattern != "" {
+		p, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%w pattern at %s: %v", ErrUnsupported, location, err)
+		}
+		s.pattern = p
+	}
+	if len(s.Const) > 0 {
+		if err := json.Unmarshal(s.Const, &s.constant); err != nil {
+			return fmt.Errorf("%w const at %s: %v", ErrUnsupported, location, err)
+		}
+	}
+	for name, property := range s.Properties {
+		if err := property.compile(location + "/properties/" + name); err != nil {
+			return err
+		}
+	}
+	if err := s.AdditionalProperties.compile(location + "/additionalProperties"); err != nil {
+		return err
+	}
+	if err := s.Items.compile(location + "/items"); err != nil {
+		return err
+	}
+	if err := s.Not.compile(location + "/not"); err != nil {
+		return err
+	}
+	for keyword, schemas := range map[string][]*Schema{"allOf": s.AllOf, "anyOf": s.AnyOf, "oneOf": s.OneOf} {
+		for i, sub := range schemas {
+			if err := sub.compile(fmt.Sprintf("%s/%s/%d", location, keyword, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A Violation is a single way in which an instance failed to match a schema.
+type Violation struct {
+	// The location of the offending value within the instance (E.G. "details.bug").
+	// The instance itself is the empty path.
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// A ValidationError lists every way in which an instance failed to match a schema.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return "schema: " + strings.Join(messages, "; ")
+}
+
+// ignored are the fields of a record that Kinto removes before validating it against
+// the schema of its collection, as they are managed by Kinto itself. They are ignored
+// here likewise, both as properties of the record and as required properties.
+//
+// For details, please see the validate_schema function of:
+// https://github.com/Kinto/kinto/blob/master/kinto/schema_validation.py
+var ignored = []string{"id", "last_modified", "schema"}
+
+// Validate validates the given value, which is first marshalled to JSON (so that
+// struct tags, omitempty, and so on, are honored just as they are when sent to Kinto).
+// As with Kinto, the id, last_modified, and schema fields of the value are not validated.
+// A non-nil error is a *ValidationError, unless the value failed to marshal.
+func (s *Schema) Validate(value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.ValidateJSON(b)
+}
+
+// ValidateJSON is the same as Validate, however the value is given as JSON.
+func (s *Schema) ValidateJSON(b []byte) error {
+	var instance interface{}
+	if err := json.Unmarshal(b, &instance); err != nil {
+		return err
+	}
+	root := *s
+	if object, ok := instance.(map[string]interface{}); ok {
+		for _, field := range ignored {
+			delete(object, field)
+		}
+		root.Required = make([]string, 0, len(s.Required))
+		for _, name := range s.Required {
+			if !isIgnored(name) {
+				root.Required = append(root.Required, name)
+			}
+		}
+	}
+	violations := root.validate("", instance)
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
+
+func (s *Schema) validate(path string, instance interface{}) []Violation {
+	if s == nil {
+		return nil
+	}
+	if s.never {
+		return []Violation{{path, "no value is allowed here"}}
+	}
+	violations := make([]Violation, 0)
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{path, fmt.Sprintf(format, args...)})
+	}
+	if len(s.Type) > 0 && !s.Type.matches(instance) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(instance))
+		// Every other keyword presumes the right type, so there is nothing more to say.
+		return violations
+	}
+	if len(s.Enum) > 0 && !contains(s.Enum, instance) {
+		fail("%s is not one of %s", literal(instance), literal(s.Enum))
+	}
+	if len(s.Const) > 0 && !reflect.DeepEqual(s.constant, instance) {
+		fail("expected %s, got %s", string(s.Const), literal(instance))
+	}
+	switch v := instance.(type) {
+	case map[string]interface{}:
+		violations = append(violations, s.validateObject(path, v)...)
+	case []interface{}:
+		violations = append(violations, s.validateArray(path, v)...)
+	case string:
+		violations = append(violations, s.validateString(path, v)...)
+	case float64:
+		violations = append(violations, s.validateNumber(path, v)...)
+	}
+	for _, sub := range s.AllOf {
+		violations = append(violations, sub.validate(path, instance)...)
+	}
+	if len(s.AnyOf) > 0 && matching(s.AnyOf, path, instance) == 0 {
+		fail("does not match any of the permitted schemas")
+	}
+	if len(s.OneOf) > 0 {
+		if n := matching(s.OneOf, path, instance); n != 1 {
+			fail("expected to match exactly one of the permitted schemas, matched %d", n)
+		}
+	}
+	if s.Not != nil && len(s.Not.validate(path, instance)) == 0 {
+		fail("matches a schema that it must not")
+	}
+	return violations
+}
+
+func (s *Schema) validateObject(path string, object map[string]interface{}) []Violation {
+	violations := make([]Violation, 0)
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			violations = append(violations, Violation{join(path, name), "is required"})
+		}
+	}
+	// Walk the properties in a stable order so that the violations are as well.
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := s.Properties[name]; ok {
+			violations = append(violations, property.validate(join(path, name), object[name])...)
+		} else if s.AdditionalProperties != nil {
+			if s.AdditionalProperties.never {
+				violations = append(violations, Violation{join(path, name), "is not a permitted property"})
+			} else {
+				violations = append(violations, s.AdditionalProperties.validate(join(path, name), object[name])...)
+			}
+		}
+	}
+	return violations
+}
+
+func (s *Schema) validateArray(path string, array []interface{}) []Violation {
+	violations := make([]Violation, 0)
+	if s.MinItems != nil && len(array) < *s.MinItems {
+		violations = append(violations, Violation{path, fmt.Sprintf("expected at least %d items, got %d", *s.MinItems, len(array))})
+	}
+	if s.MaxItems != nil && len(array) > *s.MaxItems {
+		violations = append(violations, Violation{path, fmt.Sprintf("expected at most %d items, got %d", *s.MaxItems, len(array))})
+	}
+	if s.UniqueItems {
+		for i := 0; i < len(array); i++ {
+			if contains(array[i+1:], array[i]) {
+				violations = append(violations, Violation{path, fmt.Sprintf("%s appears more than once", literal(array[i]))})
+			}
+		}
+	}
+	for i, item := range array {
+		violations = append(violations, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+	}
+	return violations
+}
+
+func (s *Schema) validateString(path string, str string) []Violation {
+	violations := make([]Violation, 0)
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{path, fmt.Sprintf(format, args...)})
+	}
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		fail("expected at least %d characters, got %d", *s.MinLength, length)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		fail("expected at most %d characters, got %d", *s.MaxLength, length)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		fail("%q does not match the pattern %s", str, s.Pattern)
+	}
+	if err := checkFormat(s.Format, str); err != nil {
+		fail("%q is not a valid %s", str, s.Format)
+	}
+	if strings.EqualFold(s.ContentEncoding, "base64") {
+		if _, err := base64.StdEncoding.DecodeString(str); err != nil {
+			fail("%q is not valid base64", str)
+		}
+	}
+	return violations
+}
+
+func (s *Schema) validateNumber(path string, n float64) []Violation {
+	violations := make([]Violation, 0)
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{path, fmt.Sprintf(format, args...)})
+	}
+	if s.Minimum != nil && n < *s.Minimum {
+		fail("%v is less than the minimum of %v", n, *s.Minimum)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		fail("%v is greater than the maximum of %v", n, *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+		fail("%v is not greater than %v", n, *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+		fail("%v is not less than %v", n, *s.ExclusiveMaximum)
+	}
+	if s.MultipleOf != nil && *s.MultipleOf != 0 {
+		if q := n / *s.MultipleOf; q != math.Trunc(q) {
+			fail("%v is not a multiple of %v", n, *s.MultipleOf)
+		}
+	}
+	return violations
+}
+
+// checkFormat validates the handful of formats that are likely to appear in a Kinto
+// collection. Unknown formats are accepted, as the specification permits.
+func checkFormat(format, str string) error {
+	var err error
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, str)
+	case "date":
+		_, err = time.Parse("2006-01-02", str)
+	case "uri":
+		var u *url.URL
+		u, err = url.Parse(str)
+		if err == nil && !u.IsAbs() {
+			err = fmt.Errorf("%s is not absolute", str)
+		}
+	case "email":
+		_, err = mail.ParseAddress(str)
+	}
+	return err
+}
+
+// matching returns how many of the given schemas the instance matches.
+func matching(schemas []*Schema, path string, instance interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		if len(s.validate(path, instance)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// types is the "type" keyword, which may be either a single type or a list of types.
+type types []string
+
+func (t *types) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = types{single}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+func (t types) matches(instance interface{}) bool {
+	actual := typeOf(instance)
+	for _, want := range t {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(instance interface{}) string {
+	switch v := instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", instance)
+	}
+}
+
+func contains(values []interface{}, instance interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, instance) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIgnored(field string) bool {
+	for _, f := range ignored {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func literal(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
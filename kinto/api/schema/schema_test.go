@@ -0,0 +1,193 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// A trimmed down version of the OneCRL collection's schema.
+const oneCRL = `{
+	"type": "object",
+	"required": ["details", "enabled"],
+	"properties": {
+		"schema": {"type": "integer"},
+		"enabled": {"type": "boolean"},
+		"issuerName": {"type": "string", "contentEncoding": "base64", "minLength": 1},
+		"serialNumber": {"type": "string", "pattern": "^[A-Za-z0-9+/=]+$"},
+		"subject": {"type": "string", "contentEncoding": "base64"},
+		"pubKeyHash": {"type": "string", "contentEncoding": "base64"},
+		"details": {
+			"type": "object",
+			"required": ["bug", "who", "why", "name", "created"],
+			"additionalProperties": false,
+			"properties": {
+				"bug": {"type": "string"},
+				"who": {"type": "string"},
+				"why": {"type": "string"},
+				"name": {"type": "string"},
+				"created": {"type": "string"}
+			}
+		}
+	},
+	"oneOf": [
+		{"required": ["issuerName", "serialNumber"]},
+		{"required": ["subject", "pubKeyHash"]}
+	]
+}`
+
+const valid = `{
+	"schema": 1,
+	"enabled": false,
+	"issuerName": "MFAxJDAiBgNVBAsTG0dsb2JhbFNpZ24gRUNDIFJvb3QgQ0EgLSBSNDETMBEGA1UEChMKR2xvYmFsU2lnbjETMBEGA1UEAxMKR2xvYmFsU2lnbg==",
+	"serialNumber": "Ae5fInnr9AhEtNXlphoM",
+	"details": {"bug": "", "who": "", "why": "", "name": "", "created": ""}
+}`
+
+func parse(t *testing.T, s string) *Schema {
+	t.Helper()
+	parsed, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestValid(t *testing.T) {
+	if err := parse(t, oneCRL).ValidateJSON([]byte(valid)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		path     string
+	}{
+		{"missing bug", `"bug": "", `, ``, "details.bug"},
+		{"bad base64", `"MFAx`, `"!!!MFAx`, "issuerName"},
+		{"bad pattern", `"Ae5f`, `"-Ae5f`, "serialNumber"},
+		{"wrong type", `"enabled": false`, `"enabled": "false"`, "enabled"},
+		{"additional property", `"created": ""`, `"created": "", "when": ""`, "details.when"},
+		{"neither kind of entry", `"serialNumber": "Ae5fInnr9AhEtNXlphoM",`, ``, ""},
+	}
+	s := parse(t, oneCRL)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instance := strings.Replace(valid, test.from, test.to, 1)
+			if instance == valid {
+				t.Fatal("test did not modify the instance")
+			}
+			err := s.ValidateJSON([]byte(instance))
+			var validation *ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("expected a *ValidationError, got %T %v", err, err)
+			}
+			for _, v := range validation.Violations {
+				if v.Path == test.path {
+					return
+				}
+			}
+			t.Errorf("expected a violation at %q, got %v", test.path, err)
+		})
+	}
+}
+
+func TestValidateStruct(t *testing.T) {
+	s := parse(t, `{"type": "object", "required": ["name"], "properties": {"name": {"type": "string", "maxLength": 3}}}`)
+	type record struct {
+		Name string `json:"name,omitempty"`
+	}
+	if err := s.Validate(record{Name: "abc"}); err != nil {
+		t.Error(err)
+	}
+	if err := s.Validate(record{Name: "abcd"}); err == nil {
+		t.Error("expected a violation of maxLength")
+	}
+	if err := s.Validate(record{}); err == nil {
+		t.Error("expected an omitted field to be missing")
+	}
+}
+
+func TestKintoFieldsAreIgnored(t *testing.T) {
+	s := parse(t, `{
+		"type": "object",
+		"required": ["id", "name"],
+		"additionalProperties": false,
+		"properties": {"id": {"type": "integer"}, "name": {"type": "string"}}
+	}`)
+	if err := s.ValidateJSON([]byte(`{"id": "abc", "last_modified": 1603376223283, "schema": 1603376223000, "name": "a"}`)); err != nil {
+		t.Errorf("expected id, last_modified, and schema to be ignored, got %v", err)
+	}
+	if err := s.ValidateJSON([]byte(`{"name": "a"}`)); err != nil {
+		t.Errorf("expected a missing id to be ignored, got %v", err)
+	}
+	// Only the fields of the record itself are managed by Kinto.
+	nested := parse(t, `{"properties": {"details": {"additionalProperties": false}}}`)
+	if err := nested.ValidateJSON([]byte(`{"details": {"id": "abc"}}`)); err == nil {
+		t.Error("expected a nested id to be validated")
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []struct {
+		schema  string
+		valid   []string
+		invalid []string
+	}{
+		{`{"enum": ["a", 1, null]}`, []string{`"a"`, `1`, `null`}, []string{`"b"`, `2`}},
+		{`{"const": {"a": 1}}`, []string{`{"a": 1}`}, []string{`{"a": 2}`}},
+		{`{"type": ["string", "null"]}`, []string{`"a"`, `null`}, []string{`1`}},
+		{`{"type": "number", "minimum": 1, "exclusiveMaximum": 3}`, []string{`1`, `2.5`}, []string{`0`, `3`}},
+		{`{"type": "integer"}`, []string{`1`, `1.0`}, []string{`1.5`}},
+		{`{"multipleOf": 5}`, []string{`10`}, []string{`11`}},
+		{`{"type": "array", "items": {"type": "integer"}, "minItems": 1, "uniqueItems": true}`,
+			[]string{`[1, 2]`}, []string{`[]`, `[1, 1]`, `["a"]`}},
+		{`{"format": "date-time"}`, []string{`"2020-10-22T14:17:03Z"`}, []string{`"yesterday"`}},
+		{`{"format": "uri"}`, []string{`"https://bugzilla.mozilla.org/show_bug.cgi?id=1"`}, []string{`"bugzilla"`}},
+		{`{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, []string{`"a"`, `1`}, []string{`true`}},
+		{`{"not": {"type": "string"}}`, []string{`1`}, []string{`"a"`}},
+		{`{"allOf": [{"minLength": 2}, {"maxLength": 3}]}`, []string{`"ab"`}, []string{`"a"`, `"abcd"`}},
+		{`{"properties": {"a": false}}`, []string{`{}`}, []string{`{"a": 1}`}},
+	}
+	for _, test := range tests {
+		s := parse(t, test.schema)
+		for _, instance := range test.valid {
+			if err := s.ValidateJSON([]byte(instance)); err != nil {
+				t.Errorf("%s: expected %s to be valid, got %v", test.schema, instance, err)
+			}
+		}
+		for _, instance := range test.invalid {
+			if err := s.ValidateJSON([]byte(instance)); err == nil {
+				t.Errorf("%s: expected %s to be invalid", test.schema, instance)
+			}
+		}
+	}
+}
+
+func TestDraft4ExclusiveBounds(t *testing.T) {
+	s := parse(t, `{"minimum": 1, "exclusiveMinimum": true, "maximum": 3, "exclusiveMaximum": false}`)
+	for instance, valid := range map[string]bool{`1`: false, `1.5`: true, `3`: true, `3.5`: false} {
+		if err := s.ValidateJSON([]byte(instance)); (err == nil) != valid {
+			t.Errorf("expected %s to be valid (%v), got %v", instance, valid, err)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, schema := range []string{
+		`{"properties": {"a": {"$ref": "#/definitions/a"}}}`,
+		`{"properties": {"a": {"pattern": "^(?!CN=)"}}}`,
+		`{"properties": {"a": {"minLength": "1"}}}`,
+		`{"exclusiveMaximum": "3"}`,
+	} {
+		if _, err := Parse([]byte(schema)); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, got %v", schema, err)
+		}
+	}
+}
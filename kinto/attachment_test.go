@@ -0,0 +1,133 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/auth"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintoattachment"
+)
+
+const attachmentContent = "-----BEGIN CERTIFICATE-----\n...\n-----END CERTIFICATE-----\n"
+
+func attachmentMetadata(content string) *kintoattachment.Attachment {
+	sum := sha256.Sum256([]byte(content))
+	return &kintoattachment.Attachment{
+		Filename: "intermediate.pem",
+		Hash:     hex.EncodeToString(sum[:]),
+		Size:     int64(len(content)),
+		Location: "security-state/intermediates/intermediate.pem",
+		Mimetype: "application/x-pem-file",
+	}
+}
+
+// attachments serves the given content from a stand-in CDN, which
+// is advertised by the returned client's capabilities.
+func attachments(t *testing.T, content string) *Client {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("credentials were sent to the CDN")
+		}
+		if r.URL.Path != "/attachments/security-state/intermediates/intermediate.pem" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(cdn.Close)
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"attachments": map[string]interface{}{"base_url": cdn.URL + "/attachments/"},
+			},
+		})
+	}))
+	return c.WithAuthenticator(&auth.Token{Token: "secret"})
+}
+
+func TestUploadAttachment(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1"+NewOneCRL().Get()+"/intermediate/attachment" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		file, header, err := r.FormFile("attachment")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		content, _ := ioutil.ReadAll(file)
+		if string(content) != attachmentContent {
+			t.Errorf("unexpected content %s", string(content))
+		}
+		if header.Filename != "intermediate.pem" || header.Header.Get("Content-Type") != "application/x-pem-file" {
+			t.Errorf("unexpected part %v", header.Header)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(attachmentMetadata(attachmentContent))
+	}))
+	got, err := c.UploadAttachment(NewOneCRL(), "intermediate", "intermediate.pem",
+		"application/x-pem-file", strings.NewReader(attachmentContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *attachmentMetadata(attachmentContent) {
+		t.Errorf("unexpected attachment %v", got)
+	}
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/v1"+NewOneCRL().Get()+"/intermediate/attachment" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	if err := c.DeleteAttachment(NewOneCRL(), "intermediate"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	c := attachments(t, attachmentContent)
+	content, err := c.DownloadAttachment(attachmentMetadata(attachmentContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != attachmentContent {
+		t.Errorf("unexpected content %s", string(content))
+	}
+}
+
+func TestDownloadAttachmentTampered(t *testing.T) {
+	tampered := strings.Replace(attachmentContent, "...", "!!!", 1)
+	c := attachments(t, tampered)
+	if _, err := c.DownloadAttachment(attachmentMetadata(attachmentContent)); err == nil {
+		t.Fatal("expected a hash mismatch")
+	}
+}
+
+func TestDownloadAttachmentTooLarge(t *testing.T) {
+	c := attachments(t, attachmentContent+"trailing")
+	if _, err := c.DownloadAttachment(attachmentMetadata(attachmentContent)); err == nil {
+		t.Fatal("expected a size mismatch")
+	}
+}
+
+func TestAttachmentsBaseURLMissing(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"capabilities": {}}`))
+	}))
+	if _, err := c.AttachmentsBaseURL(); err == nil {
+		t.Fatal("expected an error for a server without the attachments capability")
+	}
+}
@@ -0,0 +1,232 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/batch"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+// batched answers every batched request with the status at the same index.
+func batched(t *testing.T, statuses ...int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := new(batch.Batch)
+		if err := json.NewDecoder(r.Body).Decode(b); err != nil {
+			t.Error(err)
+			return
+		}
+		if len(b.Requests) != len(statuses) {
+			t.Errorf("expected %d batched requests, got %d", len(statuses), len(b.Requests))
+		}
+		responses := make([]map[string]interface{}, len(statuses))
+		for i, status := range statuses {
+			body := map[string]interface{}{"data": map[string]interface{}{"id": fmt.Sprintf("record-%d", i)}}
+			if status >= 400 {
+				body = map[string]interface{}{"code": status, "errno": ErrnoInvalidParameters, "error": http.StatusText(status)}
+			}
+			responses[i] = map[string]interface{}{
+				"status":  status,
+				"path":    b.Defaults.Path,
+				"headers": map[string]string{"ETag": fmt.Sprintf(`"%d"`, i)},
+				"body":    body,
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"responses": responses})
+	})
+}
+
+func threeRecords() *batch.Batch {
+	records := []interface{}{&OneCRLRecord{}, &OneCRLRecord{}, &OneCRLRecord{}}
+	return batch.NewBatch(records, nil, http.MethodPost, NewOneCRL().Post())
+}
+
+func TestBatchResponses(t *testing.T) {
+	c := testClient(t, batched(t, http.StatusCreated, http.StatusBadRequest, http.StatusCreated))
+	resp, err := c.BatchResponses(threeRecords())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Succeeded(); len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Errorf("expected requests 0 and 2 to succeed, got %v", got)
+	}
+	if got := resp.Failed(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected request 1 to fail, got %v", got)
+	}
+	if resp.Responses[2].Headers["ETag"] != `"2"` {
+		t.Errorf("expected the headers of each request, got %v", resp.Responses[2].Headers)
+	}
+	record := new(OneCRLRecord)
+	if err := resp.Responses[2].Unmarshal(&struct {
+		Data *OneCRLRecord `json:"data"`
+	}{Data: record}); err != nil {
+		t.Fatal(err)
+	}
+	if record.ID() != "record-2" {
+		t.Errorf("expected the body of each request, got %s", string(resp.Responses[2].Body))
+	}
+}
+
+func TestBatchIgnoresPartialFailure(t *testing.T) {
+	c := testClient(t, batched(t, http.StatusCreated, http.StatusBadRequest, http.StatusCreated))
+	if err := c.Batch(threeRecords()); err != nil {
+		t.Fatalf("expected only the failure of the batch as a whole to be an error, got %v", err)
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	c := testClient(t, batched(t, http.StatusCreated, http.StatusBadRequest, http.StatusServiceUnavailable))
+	resp, err := c.BatchResponses(threeRecords())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = newBatchError(resp)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a *BatchError, got %T %v", err, err)
+	}
+	if got := batchErr.Indices(); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("expected requests 1 and 2 to fail, got %v", got)
+	}
+	if !IsInvalidRecord(batchErr.Failed[1]) {
+		t.Errorf("expected request 1 to be an invalid record, got %v", batchErr.Failed[1])
+	}
+	if !IsBackendError(batchErr.Failed[2]) {
+		t.Errorf("expected request 2 to be a backend error, got %v", batchErr.Failed[2])
+	}
+}
+
+func TestBatchSucceeds(t *testing.T) {
+	c := testClient(t, batched(t, http.StatusCreated, http.StatusCreated, http.StatusCreated))
+	if err := c.Batch(threeRecords()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchAll(t *testing.T) {
+	collection := NewOneCRL()
+	batches := 0
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/" {
+			_, _ = w.Write([]byte(`{"settings": {"batch_max_requests": 2}}`))
+			return
+		}
+		batches++
+		b := new(batch.Batch)
+		if err := json.NewDecoder(r.Body).Decode(b); err != nil {
+			t.Error(err)
+			return
+		}
+		if b.Defaults != nil {
+			t.Errorf("expected no defaults, got %v", b.Defaults)
+		}
+		if len(b.Requests) > 2 {
+			t.Errorf("expected no more than 2 requests per batch, got %d", len(b.Requests))
+		}
+		responses := make([]map[string]interface{}, len(b.Requests))
+		for i, request := range b.Requests {
+			status := http.StatusOK
+			if request.Method == http.MethodDelete {
+				status = http.StatusNotFound
+			}
+			responses[i] = map[string]interface{}{
+				"status": status,
+				"path":   request.Method + " " + request.Path,
+				"body":   request.Body,
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"responses": responses})
+	}))
+	b := batch.NewBuilder().
+		Create(collection, &OneCRLRecord{SerialNumber: "1"}, nil).
+		Update(collection, &OneCRLRecord{SerialNumber: "2", Record: &api.Record{Id: "b"}}, nil).
+		Delete(collection, &api.Record{Id: "c"}).
+		Get(collection).
+		SignerStatus(collection, kintosigner.ToReview())
+	resp, err := c.BatchAll(b)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a *BatchError, got %T %v", err, err)
+	}
+	if got := batchErr.Indices(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("expected only the DELETE to fail, got %v", got)
+	}
+	if batches != 3 {
+		t.Errorf("expected 5 requests to be split into 3 batches, got %d", batches)
+	}
+	want := []string{
+		"POST " + collection.Get(),
+		"PATCH " + collection.Get() + "/b",
+		"DELETE " + collection.Get() + "/c",
+		"GET " + collection.Get(),
+		"PATCH " + collection.Patch(),
+	}
+	if len(resp.Responses) != len(want) {
+		t.Fatalf("expected %d responses, got %d", len(want), len(resp.Responses))
+	}
+	for i, path := range want {
+		if resp.Responses[i].Path != path {
+			t.Errorf("expected response %d to be for %s, got %s", i, path, resp.Responses[i].Path)
+		}
+	}
+	status := new(kintosigner.Status)
+	if err := resp.Responses[4].Unmarshal(status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.InReview() {
+		t.Errorf("expected the signer status to be sent, got %s", string(resp.Responses[4].Body))
+	}
+}
+
+func TestBuilderCreate(t *testing.T) {
+	collection := NewOneCRL()
+	before, err := local.CountRecords(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := local.BatchAll(batch.NewBuilder().Create(collection, &OneCRLRecord{SerialNumber: "tribute"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Responses) != 1 || resp.Responses[0].Status != http.StatusCreated {
+		t.Fatalf("expected the record to be created, got %+v", resp.Responses)
+	}
+	created := new(OneCRLRecord)
+	if err := resp.Responses[0].Unmarshal(api.NewPayload(created, nil)); err != nil {
+		t.Fatal(err)
+	}
+	got := new(OneCRLRecord)
+	if err := local.GetRecord(collection, created.ID(), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SerialNumber != "tribute" {
+		t.Errorf("expected the created record to be stored, got %+v", got)
+	}
+	if after, err := local.CountRecords(collection); err != nil || after != before+1 {
+		t.Errorf("expected %d records, got %d %v", before+1, after, err)
+	}
+}
+
+func TestBuilderBuild(t *testing.T) {
+	b := batch.NewBuilder()
+	if got := len(b.Build(25)); got != 0 {
+		t.Errorf("expected no batches for no requests, got %d", got)
+	}
+	for i := 0; i < 51; i++ {
+		b.Get(NewOneCRL())
+	}
+	if got := len(b.Build(25)); got != 3 {
+		t.Errorf("expected 3 batches, got %d", got)
+	}
+	if got := len(b.Build(0)); got != 1 {
+		t.Errorf("expected a single batch without a maximum, got %d", got)
+	}
+}
@@ -0,0 +1,48 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/middleware/cassette"
+)
+
+// production returns a client of production whose exchanges are replayed from testdata/<test name>.json.
+//
+// In order to (re)record the cassette of a test against production, run the test with CASSETTE_RECORD=1.
+// A test whose cassette has not been recorded yet is skipped.
+func production(t *testing.T) *Client {
+	path := filepath.Join("testdata", t.Name()+".json")
+	if _, err := os.Stat(path); os.IsNotExist(err) && os.Getenv(cassette.RecordEnv) == "" {
+		t.Skipf("%s has not been recorded, run the test with %s=1 to record it", path, cassette.RecordEnv)
+	}
+	tape := cassette.Open(t, path)
+	return NewClient("https", "firefox.settings.services.mozilla.com", "/v1").
+		WithRetryPolicy(NoRetries()).
+		WithMiddleware(tape.Middleware())
+}
+
+func TestProductionOneCRL(t *testing.T) {
+	oneCRL := NewOneCRL()
+	if err := production(t).AllRecords(oneCRL); err != nil {
+		t.Fatal(err)
+	}
+	if len(oneCRL.Data) < 2 {
+		t.Fatalf("expected OneCRL to span at least two pages of records, got %d records", len(oneCRL.Data))
+	}
+	for _, record := range oneCRL.Data {
+		if record.Record == nil || record.Id == "" {
+			t.Fatalf("record without an ID %v", record)
+		}
+		byIssuer := record.IssuerName != "" && record.SerialNumber != ""
+		bySubject := record.Subject != "" && record.PubKeyHash != ""
+		if byIssuer == bySubject {
+			t.Errorf("record %s is neither issuer/serial nor subject/key hash", record.Id)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintochanges"
+)
+
+// DefaultPollInterval is how often WaitForPublish polls the monitor/changes endpoint of newly constructed clients.
+//
+// See Client.WithPollInterval to change this value.
+const DefaultPollInterval = time.Second * 30
+
+// WithPollInterval sets how often WaitForPublish polls the monitor/changes endpoint.
+//
+// By default, this is set to DefaultPollInterval.
+func (c *Client) WithPollInterval(interval time.Duration) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.poll = interval
+	return c
+}
+
+// Changes lists the collections of the server that have changed since the given timestamp (or every
+// collection, if zero), newest first. Nothing is returned if no collection has changed.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-changes
+func (c *Client) Changes(since uint64) ([]*kintochanges.Change, error) {
+	return c.ChangesContext(context.Background(), since)
+}
+
+// ChangesContext is the same as Changes, however the requests are bound to the given context.
+func (c *Client) ChangesContext(ctx context.Context, since uint64) ([]*kintochanges.Change, error) {
+	changeset, err := c.SyncRecordsContext(ctx, kintochanges.Monitor, since, 0)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*kintochanges.Change, len(changeset.Changed))
+	for i, record := range changeset.Changed {
+		changes[i] = new(kintochanges.Change)
+		if err := json.Unmarshal(record, changes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// WaitForPublish polls the monitor/changes endpoint (see WithPollInterval) until the timestamp of
+// the given collection moves past the given timestamp, and returns its new timestamp. Given the
+// timestamp of a change (E.G. of the approved review of a OneCRL change), this returns once that
+// change is live.
+//
+// Should the collection not be published within the given timeout, then an error matching
+// context.DeadlineExceeded is returned.
+func (c *Client) WaitForPublish(collection *collections.Collection, since uint64, timeout time.Duration) (uint64, error) {
+	return c.WaitForPublishContext(context.Background(), collection, since, timeout)
+}
+
+// WaitForPublishContext is the same as WaitForPublish, however the requests are bound to the given context.
+func (c *Client) WaitForPublishContext(ctx context.Context, collection *collections.Collection, since uint64, timeout time.Duration) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c.lock.Lock()
+	interval := c.poll
+	c.lock.Unlock()
+	for {
+		changes, err := c.ChangesContext(ctx, since)
+		if err != nil && ctx.Err() == nil {
+			return 0, err
+		}
+		for _, change := range changes {
+			if change.Is(collection) && change.LastModified > since {
+				return change.LastModified, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("%s was not published past %d within %s: %w", collection.Patch(), since, timeout, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintochanges"
+)
+
+// monitor serves the monitor/changes endpoint, wherein the timestamp of OneCRL
+// advances to published once it has been polled the given number of times.
+func monitor(t *testing.T, published uint64, after int) (http.Handler, *int) {
+	polls := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/buckets/monitor/collections/changes/records" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		polls++
+		onecrl := uint64(1000)
+		if polls > after {
+			onecrl = published
+		}
+		all := []*kintochanges.Change{
+			{ID: "a", LastModified: onecrl, Bucket: "security-state", Collection: "onecrl", Host: "example.org"},
+			{ID: "b", LastModified: 1000 + uint64(polls), Bucket: "main", Collection: "regions", Host: "example.org"},
+		}
+		since, _ := strconv.ParseUint(strings.Trim(r.URL.Query().Get("_since"), `"`), 10, 64)
+		changed := make([]*kintochanges.Change, 0)
+		timestamp := uint64(0)
+		for _, change := range all {
+			if change.LastModified > since {
+				changed = append(changed, change)
+			}
+			if change.LastModified > timestamp {
+				timestamp = change.LastModified
+			}
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, timestamp))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": changed})
+	}), &polls
+}
+
+func TestChanges(t *testing.T) {
+	handler, _ := monitor(t, 2000, 0)
+	changes, err := testClient(t, handler).Changes(1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || !changes[0].Is(NewOneCRL().Collection) || changes[0].LastModified != 2000 {
+		t.Errorf("expected only OneCRL to have changed, got %v", changes)
+	}
+}
+
+func TestWaitForPublish(t *testing.T) {
+	handler, polls := monitor(t, 2000, 2)
+	c := testClient(t, handler).WithPollInterval(time.Millisecond)
+	published, err := c.WaitForPublish(NewOneCRL().Collection, 1500, time.Second*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 2000 || *polls != 3 {
+		t.Errorf("expected to be published at 2000 after 3 polls, got %d after %d", published, *polls)
+	}
+}
+
+func TestWaitForPublishTimeout(t *testing.T) {
+	handler, _ := monitor(t, 2000, 1<<30)
+	c := testClient(t, handler).WithPollInterval(time.Millisecond * 5)
+	_, err := c.WaitForPublish(NewOneCRL().Collection, 1500, time.Millisecond*50)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+}
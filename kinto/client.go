@@ -6,14 +6,19 @@ package kinto // import "github.com/mozilla/OneCRL-Tools/kinto"
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,16 +27,36 @@ import (
 	"github.com/mozilla/OneCRL-Tools/kinto/api/authz"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/batch"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/schema"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintoattachment"
 	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+	"github.com/mozilla/OneCRL-Tools/middleware"
 )
 
 type expectations map[int]bool
 
 var (
-	ok          = expectations{http.StatusOK: true}
-	okOrCreated = expectations{http.StatusOK: true, http.StatusCreated: true}
+	ok              = expectations{http.StatusOK: true}
+	okOrCreated     = expectations{http.StatusOK: true, http.StatusCreated: true}
+	okOrNotModified = expectations{http.StatusOK: true, http.StatusNotModified: true}
+	okOrNoContent   = expectations{http.StatusOK: true, http.StatusNoContent: true}
 )
 
+// ErrConflict is matched (via errors.Is) by any Error that is a 412 Precondition Failed.
+// That is, a concurrency-safe write (such as UpdateRecordIfUnmodified) was rejected because the
+// target was modified (or created) by someone else since it was last read.
+//
+// For details see https://docs.kinto-storage.org/en/stable/api/1.x/records.html#concurrency-control
+var ErrConflict = errors.New("kinto: precondition failed, the resource was modified by someone else")
+
+// DefaultTimeout is the timeout given to the inner HTTP client of every newly
+// constructed Client. It bounds any single HTTP exchange (including reading the body),
+// regardless of whether the context provided to a call carries a deadline of its own.
+//
+// See Client.WithTimeout to change this value.
+const DefaultTimeout = time.Minute * 2
+
 // Client is a thread safe client for the Kinto REST API.
 //
 // For information on the API that this client targets,
@@ -45,7 +70,12 @@ type Client struct {
 	tool          string
 	backoff       time.Duration
 	authenticator auth.Authenticator
+	retry         *RetryPolicy
+	alerts        func(alert *Alert)
 	inner         *http.Client
+	transport     http.RoundTripper
+	middleware    []middleware.Middleware
+	poll          time.Duration
 	lock          sync.Mutex
 }
 
@@ -56,9 +86,12 @@ func NewClient(scheme, host, base string) *Client {
 		host:          host,
 		base:          base,
 		scheme:        scheme,
-		inner:         new(http.Client),
+		inner:         &http.Client{Timeout: DefaultTimeout},
 		authenticator: new(auth.Unauthenticated),
+		retry:         DefaultRetryPolicy(),
+		alerts:        logAlert,
 		tool:          "https://github.com/mozilla/OneCRL-Tools/kinto",
+		poll:          DefaultPollInterval,
 		lock:          sync.Mutex{},
 	}
 }
@@ -96,9 +129,93 @@ func (c *Client) WithToolHeader(tool string) *Client {
 	return c
 }
 
+// WithTimeout sets the timeout for any single HTTP exchange with Kinto. A timeout of zero
+// means no timeout, in which case cancellation is only ever done via the contexts given
+// to the *Context family of methods.
+//
+// By default, this is set to DefaultTimeout.
+func (c *Client) WithTimeout(timeout time.Duration) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	inner := *c.inner
+	inner.Timeout = timeout
+	c.inner = &inner
+	return c
+}
+
+// WithHTTPClient sets the HTTP client used for every exchange with Kinto (E.G. in order to share a
+// connection pool between clients). The given client is copied rather than modified, and its timeout
+// replaces that set by WithTimeout. Any middleware (see WithMiddleware) wraps the client's transport.
+func (c *Client) WithHTTPClient(client *http.Client) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	inner := *client
+	inner.Transport = middleware.Chain(client.Transport, c.middleware...)
+	c.inner = &inner
+	c.transport = client.Transport
+	return c
+}
+
+// WithTransport sets the transport used for every exchange with Kinto (E.G. one that goes through
+// a proxy, trusts a private root, or presents a client certificate; see middleware.Transport).
+// Any middleware (see WithMiddleware) wraps the given transport.
+//
+// By default, this is http.DefaultTransport.
+func (c *Client) WithTransport(transport http.RoundTripper) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.transport = transport
+	c.chain()
+	return c
+}
+
+// WithMiddleware appends the given middleware (E.G. middleware.Logging) to that which wraps every exchange with
+// Kinto. Middleware sees every attempt that is made, retries included. The first middleware ever given is outermost.
+func (c *Client) WithMiddleware(m ...middleware.Middleware) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.middleware = append(c.middleware, m...)
+	c.chain()
+	return c
+}
+
+// WithRetryPolicy sets the policy used for retrying requests that have failed transiently
+// (E.G. a 503, or a connection reset). A nil policy is the same as NoRetries.
+//
+// By default, this is set to DefaultRetryPolicy.
+func (c *Client) WithRetryPolicy(policy *RetryPolicy) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if policy == nil {
+		policy = NoRetries()
+	}
+	c.retry = policy
+	return c
+}
+
+// WithAlertHandler sets the function that is called whenever Kinto responds with an Alert
+// header, which is how Kinto notifies clients that the API they are using is deprecated or
+// approaching its end of service. A nil handler discards alerts.
+//
+// By default, alerts are logged.
+func (c *Client) WithAlertHandler(handler func(alert *Alert)) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if handler == nil {
+		handler = func(_ *Alert) {}
+	}
+	c.alerts = handler
+	return c
+}
+
 // Alive returns back whether any error occurred while doing a GET on /
 func (c *Client) Alive() bool {
-	req, err := c.newRequest(http.MethodGet, "/", nil)
+	return c.AliveContext(context.Background())
+}
+
+// AliveContext is the same as Alive, however the request is bound to the given context.
+func (c *Client) AliveContext(ctx context.Context) bool {
+	req, err := c.newRequest(ctx, http.MethodGet, "/", nil)
 	if err != nil {
 		panic(err)
 	}
@@ -107,7 +224,12 @@ func (c *Client) Alive() bool {
 
 // NewAdmin is the same as NewAccount, however with the "admin" user pre-configured.
 func (c *Client) NewAdmin(password string) error {
-	return c.NewAccount(&auth.User{
+	return c.NewAdminContext(context.Background(), password)
+}
+
+// NewAdminContext is the same as NewAdmin, however the request is bound to the given context.
+func (c *Client) NewAdminContext(ctx context.Context, password string) error {
+	return c.NewAccountContext(ctx, &auth.User{
 		Username: "admin",
 		Password: password,
 	})
@@ -117,8 +239,13 @@ func (c *Client) NewAdmin(password string) error {
 //
 // See https://docs.kinto-storage.org/en/stable/api/1.x/accounts.html#put--accounts-(user_id) for details.
 func (c *Client) NewAccount(user *auth.User) error {
+	return c.NewAccountContext(context.Background(), user)
+}
+
+// NewAccountContext is the same as NewAccount, however the request is bound to the given context.
+func (c *Client) NewAccountContext(ctx context.Context, user *auth.User) error {
 	payload := api.NewPayload(user, nil)
-	req, err := c.newRequest(http.MethodPut, user.Put(), &payload)
+	req, err := c.newRequest(ctx, http.MethodPut, user.Put(), &payload)
 	if err != nil {
 		return err
 	}
@@ -129,15 +256,25 @@ func (c *Client) NewAccount(user *auth.User) error {
 //
 // See https://docs.kinto-storage.org/en/stable/api/1.x/buckets.html#post--buckets for details.
 func (c *Client) NewBucket(bucket *buckets.Bucket) error {
-	return c.NewBucketWithPermissions(bucket, nil)
+	return c.NewBucketContext(context.Background(), bucket)
+}
+
+// NewBucketContext is the same as NewBucket, however the request is bound to the given context.
+func (c *Client) NewBucketContext(ctx context.Context, bucket *buckets.Bucket) error {
+	return c.NewBucketWithPermissionsContext(ctx, bucket, nil)
 }
 
 // NewBucketWithPermissions creates a new bucket with the provided permissions.
 //
 // See https://docs.kinto-storage.org/en/stable/api/1.x/buckets.html#post--buckets for details.
 func (c *Client) NewBucketWithPermissions(bucket *buckets.Bucket, perms *authz.Permissions) error {
+	return c.NewBucketWithPermissionsContext(context.Background(), bucket, perms)
+}
+
+// NewBucketWithPermissionsContext is the same as NewBucketWithPermissions, however the request is bound to the given context.
+func (c *Client) NewBucketWithPermissionsContext(ctx context.Context, bucket *buckets.Bucket, perms *authz.Permissions) error {
 	payload := api.NewPayload(bucket, perms)
-	req, err := c.newRequest(http.MethodPost, bucket.Post(), &payload)
+	req, err := c.newRequest(ctx, http.MethodPost, bucket.Post(), &payload)
 	if err != nil {
 		return err
 	}
@@ -149,7 +286,12 @@ func (c *Client) NewBucketWithPermissions(bucket *buckets.Bucket, perms *authz.P
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#post--buckets-(bucket_id)-collections
 func (c *Client) NewCollection(collection api.Poster) error {
-	return c.NewCollectionWithPermissions(collection, nil)
+	return c.NewCollectionContext(context.Background(), collection)
+}
+
+// NewCollectionContext is the same as NewCollection, however the request is bound to the given context.
+func (c *Client) NewCollectionContext(ctx context.Context, collection api.Poster) error {
+	return c.NewCollectionWithPermissionsContext(ctx, collection, nil)
 }
 
 // NewCollectionWithPermissions creates a new collection with the provided permissions.
@@ -157,40 +299,511 @@ func (c *Client) NewCollection(collection api.Poster) error {
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#post--buckets-(bucket_id)-collections
 func (c *Client) NewCollectionWithPermissions(collection api.Poster, perms *authz.Permissions) error {
+	return c.NewCollectionWithPermissionsContext(context.Background(), collection, perms)
+}
+
+// NewCollectionWithPermissionsContext is the same as NewCollectionWithPermissions, however the request is bound to the given context.
+func (c *Client) NewCollectionWithPermissionsContext(ctx context.Context, collection api.Poster, perms *authz.Permissions) error {
 	payload := api.NewPayload(collection, perms)
-	req, err := c.newRequest(http.MethodPost, collection.Post(), &payload)
+	req, err := c.newRequest(ctx, http.MethodPost, collection.Post(), &payload)
 	if err != nil {
 		return err
 	}
 	return c.do(req, &payload, okOrCreated)
 }
 
+// Buckets lists every bucket that the current user may read.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/buckets.html#retrieving-all-buckets
+func (c *Client) Buckets() ([]*buckets.Bucket, error) {
+	return c.BucketsContext(context.Background())
+}
+
+// BucketsContext is the same as Buckets, however the request is bound to the given context.
+func (c *Client) BucketsContext(ctx context.Context) ([]*buckets.Bucket, error) {
+	list := make([]*buckets.Bucket, 0)
+	err := c.StreamRecordsContext(ctx, endpoint("/buckets"), func(b json.RawMessage) error {
+		bucket := new(buckets.Bucket)
+		list = append(list, bucket)
+		return json.Unmarshal(b, bucket)
+	})
+	return list, err
+}
+
+// GetBucket retrieves the bucket of the given name along with its permissions.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/buckets.html#retrieving-an-existing-bucket
+func (c *Client) GetBucket(name string) (*buckets.Bucket, *authz.Permissions, error) {
+	return c.GetBucketContext(context.Background(), name)
+}
+
+// GetBucketContext is the same as GetBucket, however the request is bound to the given context.
+func (c *Client) GetBucketContext(ctx context.Context, name string) (*buckets.Bucket, *authz.Permissions, error) {
+	bucket := buckets.NewBucket(name)
+	perms, err := c.getResource(ctx, bucket, bucket)
+	return bucket, perms, err
+}
+
+// DeleteBucket deletes the given bucket along with EVERYTHING within it (collections, groups, and records).
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/buckets.html#deleting-a-bucket
+func (c *Client) DeleteBucket(bucket api.Deleter) error {
+	return c.DeleteBucketContext(context.Background(), bucket)
+}
+
+// DeleteBucketContext is the same as DeleteBucket, however the request is bound to the given context.
+func (c *Client) DeleteBucketContext(ctx context.Context, bucket api.Deleter) error {
+	return c.deleteResource(ctx, bucket)
+}
+
+// Collections lists every collection within the given bucket that the current user may read.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#retrieving-all-collections
+func (c *Client) Collections(bucket *buckets.Bucket) ([]*collections.Collection, error) {
+	return c.CollectionsContext(context.Background(), bucket)
+}
+
+// CollectionsContext is the same as Collections, however the request is bound to the given context.
+func (c *Client) CollectionsContext(ctx context.Context, bucket *buckets.Bucket) ([]*collections.Collection, error) {
+	list := make([]*collections.Collection, 0)
+	err := c.StreamRecordsContext(ctx, endpoint(bucket.Get()+"/collections"), func(b json.RawMessage) error {
+		collection := collections.NewCollection(bucket, "")
+		list = append(list, collection)
+		return json.Unmarshal(b, collection)
+	})
+	return list, err
+}
+
+// DeleteCollection deletes the given collection along with every record within it.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#deleting-a-collection
+func (c *Client) DeleteCollection(collection api.Deleter) error {
+	return c.DeleteCollectionContext(context.Background(), collection)
+}
+
+// DeleteCollectionContext is the same as DeleteCollection, however the request is bound to the given context.
+func (c *Client) DeleteCollectionContext(ctx context.Context, collection api.Deleter) error {
+	return c.deleteResource(ctx, collection)
+}
+
+// CollectionMetadata retrieves the metadata (E.G. the JSON schema and signer status) of the given collection.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#retrieving-an-existing-collection
+func (c *Client) CollectionMetadata(collection api.Patcher) (*collections.Metadata, error) {
+	return c.CollectionMetadataContext(context.Background(), collection)
+}
+
+// CollectionMetadataContext is the same as CollectionMetadata, however the request is bound to the given context.
+func (c *Client) CollectionMetadataContext(ctx context.Context, collection api.Patcher) (*collections.Metadata, error) {
+	metadata := new(collections.Metadata)
+	req, err := c.newRequest(ctx, http.MethodGet, collection.Patch(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return metadata, c.do(req, api.NewPayload(metadata, nil), ok)
+}
+
+// UpdateCollectionMetadata PATCHes the metadata of the given collection with every field that is set
+// within the given metadata. Fields that are left empty are left untouched. On success, the given
+// metadata is updated to the collection's metadata in full.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#updating-an-existing-collection
+func (c *Client) UpdateCollectionMetadata(collection api.Patcher, metadata *collections.Metadata) error {
+	return c.UpdateCollectionMetadataContext(context.Background(), collection, metadata)
+}
+
+// UpdateCollectionMetadataContext is the same as UpdateCollectionMetadata, however the request is bound to the given context.
+func (c *Client) UpdateCollectionMetadataContext(ctx context.Context, collection api.Patcher, metadata *collections.Metadata) error {
+	payload := api.NewPayload(metadata, nil)
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), payload)
+	if err != nil {
+		return err
+	}
+	return c.do(req, payload, ok)
+}
+
+// CollectionSchema retrieves the JSON schema of the given collection, which may be used to
+// validate records before they are sent to Kinto. A nil schema (and nil error) is returned
+// if the collection does not have a schema.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/collections.html#collection-json-schema
+func (c *Client) CollectionSchema(collection api.Patcher) (*schema.Schema, error) {
+	return c.CollectionSchemaContext(context.Background(), collection)
+}
+
+// CollectionSchemaContext is the same as CollectionSchema, however the request is bound to the given context.
+func (c *Client) CollectionSchemaContext(ctx context.Context, collection api.Patcher) (*schema.Schema, error) {
+	metadata, err := c.CollectionMetadataContext(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.Schema) == 0 || string(metadata.Schema) == "null" {
+		return nil, nil
+	}
+	return schema.Parse(metadata.Schema)
+}
+
+// VerifySignature downloads the records of the given (signed) collection and checks them against the
+// collection's content signature using the given verifier. That is, it confirms that the collection
+// is exactly what Firefox will accept. An error matching kintosigner.ErrBadSignature is returned if
+// the records do not match the signature.
+//
+// Note that only published collections (E.G. within "security-state" rather than "security-state-staging")
+// are signed.
+//
+// If the verifier has no HTTPClient of its own, then the signing chain is downloaded using this client's
+// HTTP client (and, therefore, its transport and middleware). The given verifier is never modified.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-signer#signature-verification
+func (c *Client) VerifySignature(collection api.Patcher, verifier *kintosigner.Verifier) error {
+	return c.VerifySignatureContext(context.Background(), collection, verifier)
+}
+
+// VerifySignatureContext is the same as VerifySignature, however the requests are bound to the given context.
+func (c *Client) VerifySignatureContext(ctx context.Context, collection api.Patcher, verifier *kintosigner.Verifier) error {
+	metadata, err := c.CollectionMetadataContext(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if metadata.Signature == nil {
+		return fmt.Errorf("kinto: %s is not signed", collection.Patch())
+	}
+	changes, err := c.SyncRecordsContext(ctx, endpoint(collection.Patch()+"/records"), 0, 0)
+	if err != nil {
+		return err
+	}
+	if verifier.HTTPClient == nil {
+		v := *verifier
+		v.HTTPClient = c.getInner()
+		verifier = &v
+	}
+	return verifier.Verify(ctx, metadata.Signature, changes.Changed, changes.Timestamp)
+}
+
 // Batch POSTs a single batch request. Note that the size of a batch request is bounded
 // by the remote server's "batch_max_requests" settings (which can be found under "settings" under the root resource).
 //
 // The most reliable way to to use this endpoint is to query this limit via `BatchMaxRequests` and use that value
 // in the batch.NewBatches API.
 //
+// Kinto does not apply a batch atomically, and an error is only returned if the batch as a whole failed.
+// The failure of any single batched request goes unreported, so use BatchResponses (or BatchAll)
+// in order to learn exactly which requests were applied.
+//
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/batch.html
 func (c *Client) Batch(b *batch.Batch) error {
-	req, err := c.newRequest(http.MethodPost, b.Post(), &b)
+	return c.BatchContext(context.Background(), b)
+}
+
+// BatchContext is the same as Batch, however the request is bound to the given context.
+func (c *Client) BatchContext(ctx context.Context, b *batch.Batch) error {
+	req, err := c.newRequest(ctx, http.MethodPost, b.Post(), &b)
 	if err != nil {
 		return err
 	}
 	return c.do(req, nil, okOrCreated)
 }
 
+// BatchResponses is the same as Batch, however the result of every batched request is returned
+// and the failure of any batched request is NOT an error. An error is only returned if the batch
+// as a whole failed (in which case, none of the batched requests were applied).
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/batch.html
+func (c *Client) BatchResponses(b *batch.Batch) (*batch.BatchResponse, error) {
+	return c.BatchResponsesContext(context.Background(), b)
+}
+
+// BatchResponsesContext is the same as BatchResponses, however the request is bound to the given context.
+func (c *Client) BatchResponsesContext(ctx context.Context, b *batch.Batch) (*batch.BatchResponse, error) {
+	resp := new(batch.BatchResponse)
+	req, err := c.newRequest(ctx, http.MethodPost, b.Post(), &b)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.do(req, resp, okOrCreated); err != nil {
+		return nil, err
+	}
+	if len(resp.Responses) != len(b.Requests) {
+		return nil, fmt.Errorf("sent %d batched requests but Kinto answered %d", len(b.Requests), len(resp.Responses))
+	}
+	return resp, nil
+}
+
+// BatchAll sends every request of the given builder, split into as many batches as is necessary
+// to respect the server's "batch_max_requests" (see BatchMaxRequests). Batches are sent one after
+// another, in order.
+//
+// The result of every request is returned, indexed in the order in which the requests were added to
+// the builder. If any request failed then a *BatchError is returned as well. If a batch as a whole
+// failed, then the results of the batches that were already sent are returned along with the error,
+// and none of the requests that follow were applied.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/batch.html
+func (c *Client) BatchAll(b *batch.Builder) (*batch.BatchResponse, error) {
+	return c.BatchAllContext(context.Background(), b)
+}
+
+// BatchAllContext is the same as BatchAll, however the requests are bound to the given context.
+func (c *Client) BatchAllContext(ctx context.Context, b *batch.Builder) (*batch.BatchResponse, error) {
+	max, err := c.BatchMaxRequestsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all := &batch.BatchResponse{Responses: make([]batch.Response, 0, b.Len())}
+	for _, bat := range b.Build(max) {
+		resp, err := c.BatchResponsesContext(ctx, bat)
+		if err != nil {
+			return all, err
+		}
+		all.Responses = append(all.Responses, resp.Responses...)
+	}
+	return all, newBatchError(all)
+}
+
 // AllRecords retrieves all records for the given collection.
 //
+// Kinto paginates record listings (see the "paginate_by" server setting), so every
+// page advertised via the Next-Page header is followed and the records of each page
+// are joined together before being decoded into the provided collection. The provided
+// collection is only written to if every page was successfully retrieved.
+//
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/records.html#retrieving-stored-records
+// https://docs.kinto-storage.org/en/stable/api/1.x/pagination.html
 func (c *Client) AllRecords(collection api.Getter) error {
-	r, err := c.newRequest(http.MethodGet, collection.Get(), nil)
+	return c.AllRecordsContext(context.Background(), collection)
+}
+
+// AllRecordsContext is the same as AllRecords, however the request is bound to the given context.
+func (c *Client) AllRecordsContext(ctx context.Context, collection api.Getter) error {
+	records := make([]json.RawMessage, 0)
+	err := c.StreamRecordsContext(ctx, collection, func(record json.RawMessage) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	joined, err := json.Marshal(struct {
+		Data []json.RawMessage `json:"data"`
+	}{Data: records})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(joined, collection)
+}
+
+// StreamRecords walks every page of records for the given collection, handing each
+// record to the provided consumer as it is received. This is useful for collections
+// that are too large to comfortably hold in memory all at once.
+//
+// If the consumer returns an error then no further pages are requested and that
+// error is returned as-is.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/pagination.html
+func (c *Client) StreamRecords(collection api.Getter, consumer func(record json.RawMessage) error) error {
+	return c.StreamRecordsContext(context.Background(), collection, consumer)
+}
+
+// StreamRecordsContext is the same as StreamRecords, however the request is bound to the given context.
+func (c *Client) StreamRecordsContext(ctx context.Context, collection api.Getter, consumer func(record json.RawMessage) error) error {
+	if err := invalid(collection); err != nil {
+		return err
+	}
+	r, err := c.newRequest(ctx, http.MethodGet, collection.Get(), nil)
+	if err != nil {
+		return err
+	}
+	for r != nil {
+		page := struct {
+			Data []json.RawMessage `json:"data"`
+		}{}
+		resp, err := c.send(r, &page, ok)
+		if err != nil {
+			return err
+		}
+		for _, record := range page.Data {
+			if err := consumer(record); err != nil {
+				return err
+			}
+		}
+		r, err = c.nextPage(ctx, resp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A Changeset describes every change made to a collection since a given timestamp.
+type Changeset struct {
+	// The timestamp (ETag) of the collection as of this sync. This is
+	// the value that should be provided as "since" for the next sync.
+	Timestamp uint64
+	// Whether Kinto reported that nothing has changed since the requested timestamp.
+	// If set, then Changed and Deleted are empty and Timestamp is that which was requested.
+	NotModified bool
+	// Every record that was created or updated since the requested timestamp, in the order that
+	// Kinto returned them (newest first). Each record is given as-is, so that no field is lost.
+	Changed []json.RawMessage
+	// The ID of every record that was deleted since the requested timestamp.
+	Deleted []string
+}
+
+// SyncRecords retrieves every change made to the given collection since the given timestamp,
+// which is typically the Timestamp of a previous Changeset. A timestamp of zero retrieves the
+// entire collection. Deleted records are reported by Kinto as tombstones, which are collected
+// into the Deleted IDs of the Changeset.
+//
+// If the timestamp is not zero, then the request is made with If-None-Match, so that an unchanged
+// collection costs a single 304 Not Modified.
+//
+// If expected is not zero, then it is sent as the _expected query parameter. This is the timestamp
+// that the caller knows the collection to be at (E.G. from the monitor/changes endpoint) and is
+// used to bust any cache (such as a CDN) in front of Kinto which may be serving a stale listing.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/synchronisation.html
+func (c *Client) SyncRecords(collection api.Getter, since, expected uint64) (*Changeset, error) {
+	return c.SyncRecordsContext(context.Background(), collection, since, expected)
+}
+
+// SyncRecordsContext is the same as SyncRecords, however the request is bound to the given context.
+func (c *Client) SyncRecordsContext(ctx context.Context, collection api.Getter, since, expected uint64) (*Changeset, error) {
+	if err := invalid(collection); err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if since != 0 {
+		query.Set("_since", etag(since))
+	}
+	if expected != 0 {
+		query.Set("_expected", etag(expected))
+	}
+	r, err := c.newRequest(ctx, http.MethodGet, withQuery(collection.Get(), query), nil)
 	if err != nil {
+		return nil, err
+	}
+	if since != 0 {
+		r.Header.Set("If-None-Match", etag(since))
+	}
+	changes := &Changeset{Changed: make([]json.RawMessage, 0), Deleted: make([]string, 0)}
+	for first := true; r != nil; first = false {
+		page := struct {
+			Data []json.RawMessage `json:"data"`
+		}{}
+		accept := ok
+		if first {
+			accept = okOrNotModified
+		}
+		resp, err := c.send(r, &page, accept)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			if resp.StatusCode == http.StatusNotModified {
+				return &Changeset{Timestamp: since, NotModified: true}, nil
+			}
+			// Only the first page's ETag speaks for the collection as a whole.
+			changes.Timestamp, err = parseETag(resp.Header.Get("ETag"))
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, record := range page.Data {
+			tombstone := struct {
+				Id      string `json:"id"`
+				Deleted bool   `json:"deleted"`
+			}{}
+			if err := json.Unmarshal(record, &tombstone); err != nil {
+				return nil, err
+			}
+			if tombstone.Deleted {
+				changes.Deleted = append(changes.Deleted, tombstone.Id)
+			} else {
+				changes.Changed = append(changes.Changed, record)
+			}
+		}
+		r, err = c.nextPage(ctx, resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// GetRecord retrieves the record of the given ID from the given collection into the provided
+// record. If the collection is a query (see the query package) then only its field
+// selection applies. A record that does not exist is reported as an error satisfying IsNotFound.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/records.html#retrieving-stored-records
+func (c *Client) GetRecord(collection api.Getter, id string, record interface{}) error {
+	return c.GetRecordContext(context.Background(), collection, id, record)
+}
+
+// GetRecordContext is the same as GetRecord, however the request is bound to the given context.
+func (c *Client) GetRecordContext(ctx context.Context, collection api.Getter, id string, record interface{}) error {
+	if err := invalid(collection); err != nil {
 		return err
 	}
-	return c.do(r, collection, ok)
+	path, query := splitQuery(collection.Get())
+	fields := url.Values{}
+	if f, ok := query["_fields"]; ok {
+		fields["_fields"] = f
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, withQuery(path+"/"+url.PathEscape(id), fields), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, api.NewPayload(record, nil), ok)
+}
+
+// CountRecords returns the number of records within the given collection, or the number of
+// records matching the given query (see the query package). No records are transferred.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/records.html#retrieving-stored-records
+func (c *Client) CountRecords(collection api.Getter) (int, error) {
+	return c.CountRecordsContext(context.Background(), collection)
+}
+
+// CountRecordsContext is the same as CountRecords, however the request is bound to the given context.
+func (c *Client) CountRecordsContext(ctx context.Context, collection api.Getter) (int, error) {
+	if err := invalid(collection); err != nil {
+		return 0, err
+	}
+	req, err := c.newRequest(ctx, http.MethodHead, collection.Get(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.send(req, nil, ok)
+	if err != nil {
+		return 0, err
+	}
+	// Kinto renamed Total-Records to Total-Objects, so either may be present depending on the version.
+	total := resp.Header.Get("Total-Objects")
+	if total == "" {
+		total = resp.Header.Get("Total-Records")
+	}
+	count, err := strconv.Atoi(total)
+	if err != nil {
+		return 0, fmt.Errorf("Kinto did not give us a record count. Got '%s'", total)
+	}
+	return count, nil
 }
 
 // NewRecord POSTs a new record under the given collection with default permissions.
@@ -198,7 +811,12 @@ func (c *Client) AllRecords(collection api.Getter) error {
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/records.html#uploading-a-record
 func (c *Client) NewRecord(collection api.Getter, record interface{}) error {
-	return c.NewRecordWithPermissions(collection, record, nil)
+	return c.NewRecordContext(context.Background(), collection, record)
+}
+
+// NewRecordContext is the same as NewRecord, however the request is bound to the given context.
+func (c *Client) NewRecordContext(ctx context.Context, collection api.Getter, record interface{}) error {
+	return c.NewRecordWithPermissionsContext(ctx, collection, record, nil)
 }
 
 // NewRecordWithPermissions POSTs a new record under the given collection with the given permissions.
@@ -206,8 +824,13 @@ func (c *Client) NewRecord(collection api.Getter, record interface{}) error {
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/records.html#uploading-a-record
 func (c *Client) NewRecordWithPermissions(collection api.Getter, record interface{}, perms *authz.Permissions) error {
+	return c.NewRecordWithPermissionsContext(context.Background(), collection, record, perms)
+}
+
+// NewRecordWithPermissionsContext is the same as NewRecordWithPermissions, however the request is bound to the given context.
+func (c *Client) NewRecordWithPermissionsContext(ctx context.Context, collection api.Getter, record interface{}, perms *authz.Permissions) error {
 	payload := api.NewPayload(record, perms)
-	req, err := c.newRequest(http.MethodPost, collection.Get(), &payload)
+	req, err := c.newRequest(ctx, http.MethodPost, collection.Get(), &payload)
 	if err != nil {
 		return err
 	}
@@ -219,7 +842,12 @@ func (c *Client) NewRecordWithPermissions(collection api.Getter, record interfac
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/records.html#patch--buckets-(bucket_id)-collections-(collection_id)-records-(record_id)
 func (c *Client) UpdateRecord(collection api.Getter, record api.Recorded) error {
-	return c.UpdateRecordWithPermissions(collection, record, nil)
+	return c.UpdateRecordContext(context.Background(), collection, record)
+}
+
+// UpdateRecordContext is the same as UpdateRecord, however the request is bound to the given context.
+func (c *Client) UpdateRecordContext(ctx context.Context, collection api.Getter, record api.Recorded) error {
+	return c.UpdateRecordWithPermissionsContext(ctx, collection, record, nil)
 }
 
 // UpdateRecordWithPermissions PATCHes a given record under the given collection with the given permissions.
@@ -227,8 +855,13 @@ func (c *Client) UpdateRecord(collection api.Getter, record api.Recorded) error
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/records.html#patch--buckets-(bucket_id)-collections-(collection_id)-records-(record_id)
 func (c *Client) UpdateRecordWithPermissions(collection api.Getter, record api.Recorded, perms *authz.Permissions) error {
+	return c.UpdateRecordWithPermissionsContext(context.Background(), collection, record, perms)
+}
+
+// UpdateRecordWithPermissionsContext is the same as UpdateRecordWithPermissions, however the request is bound to the given context.
+func (c *Client) UpdateRecordWithPermissionsContext(ctx context.Context, collection api.Getter, record api.Recorded, perms *authz.Permissions) error {
 	payload := api.NewPayload(record.(interface{}), perms)
-	req, err := c.newRequest(http.MethodPatch, collection.Get()+"/"+record.ID(), &payload)
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Get()+"/"+record.ID(), &payload)
 	if err != nil {
 		return err
 	}
@@ -240,21 +873,226 @@ func (c *Client) UpdateRecordWithPermissions(collection api.Getter, record api.R
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/records.html#delete-stored-records
 func (c *Client) Delete(collection api.Getter, record api.Recorded) (*api.DeleteResponse, error) {
+	return c.DeleteContext(context.Background(), collection, record)
+}
+
+// DeleteContext is the same as Delete, however the request is bound to the given context.
+func (c *Client) DeleteContext(ctx context.Context, collection api.Getter, record api.Recorded) (*api.DeleteResponse, error) {
 	resp := new(api.DeleteResponse)
-	req, err := c.newRequest(http.MethodDelete, collection.Get()+"/"+record.ID(), nil)
+	req, err := c.newRequest(ctx, http.MethodDelete, collection.Get()+"/"+record.ID(), nil)
 	if err != nil {
 		return resp, err
 	}
 	return resp, c.do(req, resp, ok)
 }
 
+// NewRecordIfAbsent is the same as NewRecord, however the record is only created if
+// it does not already exist (via the If-None-Match: * header). If the record carries an
+// ID and a record of that ID already exists, then an error matching ErrConflict is returned.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/records.html#concurrency-control
+func (c *Client) NewRecordIfAbsent(collection api.Getter, record interface{}) error {
+	return c.NewRecordIfAbsentContext(context.Background(), collection, record)
+}
+
+// NewRecordIfAbsentContext is the same as NewRecordIfAbsent, however the request is bound to the given context.
+func (c *Client) NewRecordIfAbsentContext(ctx context.Context, collection api.Getter, record interface{}) error {
+	payload := api.NewPayload(record, nil)
+	method, endpoint := http.MethodPost, collection.Get()
+	if recorded, ok := record.(api.Recorded); ok && recorded.ID() != "" {
+		// A POST with an existing ID returns the existing record, so we must
+		// PUT in order to have the server check for the record's existence.
+		method, endpoint = http.MethodPut, collection.Get()+"/"+recorded.ID()
+	}
+	req, err := c.newRequest(ctx, method, endpoint, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-None-Match", "*")
+	return c.do(req, &payload, okOrCreated)
+}
+
+// UpdateRecordIfUnmodified is the same as UpdateRecord, however the record is only updated if it has
+// not been modified since it was last read (via the If-Match header). That is, the record's
+// last_modified must be that of the latest revision held by Kinto. If it is not, then an error
+// matching ErrConflict is returned.
+//
+// On success, the record's last_modified is updated to that of the new revision.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/records.html#concurrency-control
+func (c *Client) UpdateRecordIfUnmodified(collection api.Getter, record api.Versioned) error {
+	return c.UpdateRecordIfUnmodifiedContext(context.Background(), collection, record)
+}
+
+// UpdateRecordIfUnmodifiedContext is the same as UpdateRecordIfUnmodified, however the request is bound to the given context.
+func (c *Client) UpdateRecordIfUnmodifiedContext(ctx context.Context, collection api.Getter, record api.Versioned) error {
+	if record.Version() == 0 {
+		return fmt.Errorf("record '%s' does not have a last_modified timestamp to condition an update on", record.ID())
+	}
+	payload := api.NewPayload(record.(interface{}), nil)
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Get()+"/"+record.ID(), &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-Match", etag(record.Version()))
+	return c.do(req, &payload, okOrCreated)
+}
+
+// DeleteIfUnmodified is the same as Delete, however the record is only deleted if it has not
+// been modified since it was last read (via the If-Match header). If it has, then an error
+// matching ErrConflict is returned.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/records.html#concurrency-control
+func (c *Client) DeleteIfUnmodified(collection api.Getter, record api.Versioned) (*api.DeleteResponse, error) {
+	return c.DeleteIfUnmodifiedContext(context.Background(), collection, record)
+}
+
+// DeleteIfUnmodifiedContext is the same as DeleteIfUnmodified, however the request is bound to the given context.
+func (c *Client) DeleteIfUnmodifiedContext(ctx context.Context, collection api.Getter, record api.Versioned) (*api.DeleteResponse, error) {
+	resp := new(api.DeleteResponse)
+	if record.Version() == 0 {
+		return resp, fmt.Errorf("record '%s' does not have a last_modified timestamp to condition a deletion on", record.ID())
+	}
+	req, err := c.newRequest(ctx, http.MethodDelete, collection.Get()+"/"+record.ID(), nil)
+	if err != nil {
+		return resp, err
+	}
+	req.Header.Set("If-Match", etag(record.Version()))
+	return resp, c.do(req, resp, ok)
+}
+
+// UploadAttachment attaches the given file to the record of the given ID (creating the record if it
+// does not exist), returning the metadata that Kinto Attachment recorded for it. Any previous
+// attachment of the record is replaced.
+//
+// For details on the Kinto Attachment plugin, please see:
+// https://github.com/Kinto/kinto-attachment
+func (c *Client) UploadAttachment(collection api.Getter, id, filename, mimetype string, content io.Reader) (*kintoattachment.Attachment, error) {
+	return c.UploadAttachmentContext(context.Background(), collection, id, filename, mimetype, content)
+}
+
+// UploadAttachmentContext is the same as UploadAttachment, however the request is bound to the given context.
+func (c *Client) UploadAttachmentContext(ctx context.Context, collection api.Getter, id, filename, mimetype string, content io.Reader) (*kintoattachment.Attachment, error) {
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="attachment"; filename="%s"`, quoteEscaper.Replace(filename)))
+	if mimetype == "" {
+		mimetype = "application/octet-stream"
+	}
+	header.Set("Content-Type", mimetype)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+	req, err := c.newRawRequest(ctx, http.MethodPost, kintoattachment.Endpoint(collection, id), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	attachment := new(kintoattachment.Attachment)
+	return attachment, c.do(req, attachment, okOrCreated)
+}
+
+// DeleteAttachment removes the attachment of the record of the given ID. The record itself is kept.
+//
+// For details on the Kinto Attachment plugin, please see:
+// https://github.com/Kinto/kinto-attachment
+func (c *Client) DeleteAttachment(collection api.Getter, id string) error {
+	return c.DeleteAttachmentContext(context.Background(), collection, id)
+}
+
+// DeleteAttachmentContext is the same as DeleteAttachment, however the request is bound to the given context.
+func (c *Client) DeleteAttachmentContext(ctx context.Context, collection api.Getter, id string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, kintoattachment.Endpoint(collection, id), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil, okOrNoContent)
+}
+
+// AttachmentsBaseURL discovers the URL from which the server's attachments are served,
+// as advertised by the Kinto Attachment plugin within the server's capabilities.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/utilities.html#api-utilities
+func (c *Client) AttachmentsBaseURL() (string, error) {
+	return c.AttachmentsBaseURLContext(context.Background())
+}
+
+// AttachmentsBaseURLContext is the same as AttachmentsBaseURL, however the request is bound to the given context.
+func (c *Client) AttachmentsBaseURLContext(ctx context.Context) (string, error) {
+	info, err := c.ServerInfoContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if info.Capabilities.Attachments == nil || info.Capabilities.Attachments.BaseURL == "" {
+		return "", fmt.Errorf("%s does not advertise the attachments capability", info.URL)
+	}
+	return info.Capabilities.Attachments.BaseURL, nil
+}
+
+// DownloadAttachment retrieves the content of the given attachment, which is served from the server's
+// attachments base URL (see AttachmentsBaseURL). The content is only returned if it is of the size, and
+// has the hash, declared by the attachment.
+//
+// Attachments are typically served from a CDN rather than from Kinto itself, so this client's
+// credentials are never sent along with the download.
+func (c *Client) DownloadAttachment(attachment *kintoattachment.Attachment) ([]byte, error) {
+	return c.DownloadAttachmentContext(context.Background(), attachment)
+}
+
+// DownloadAttachmentContext is the same as DownloadAttachment, however the requests are bound to the given context.
+func (c *Client) DownloadAttachmentContext(ctx context.Context, attachment *kintoattachment.Attachment) ([]byte, error) {
+	base, err := c.AttachmentsBaseURLContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, attachment.URL(base), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-AUTOMATED-TOOL", c.tool)
+	resp, err := c.getInner().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// Read no more than one byte beyond what we expect, which is enough to tell that it is too large.
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, attachment.Size+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newError(resp.StatusCode, content)
+	}
+	if err := attachment.Verify(content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
 // SignerStatusFor retrieves the Kinto Signer signer status for the given collection.
 //
 // For details on the Kinto Signer plugin, please see:
 // https://github.com/Kinto/kinto-signer
 func (c *Client) SignerStatusFor(collection api.Patcher) (*kintosigner.Status, error) {
+	return c.SignerStatusForContext(context.Background(), collection)
+}
+
+// SignerStatusForContext is the same as SignerStatusFor, however the request is bound to the given context.
+func (c *Client) SignerStatusForContext(ctx context.Context, collection api.Patcher) (*kintosigner.Status, error) {
 	resp := new(kintosigner.Status)
-	req, err := c.newRequest(http.MethodGet, collection.Patch(), nil)
+	req, err := c.newRequest(ctx, http.MethodGet, collection.Patch(), nil)
 	if err != nil {
 		return resp, err
 	}
@@ -266,7 +1104,12 @@ func (c *Client) SignerStatusFor(collection api.Patcher) (*kintosigner.Status, e
 // For details on the Kinto Signer plugin, please see:
 // https://github.com/Kinto/kinto-signer
 func (c *Client) ToReview(collection api.Patcher) error {
-	req, err := c.newRequest(http.MethodPatch, collection.Patch(), kintosigner.ToReview())
+	return c.ToReviewContext(context.Background(), collection)
+}
+
+// ToReviewContext is the same as ToReview, however the request is bound to the given context.
+func (c *Client) ToReviewContext(ctx context.Context, collection api.Patcher) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), kintosigner.ToReview())
 	if err != nil {
 		return err
 	}
@@ -278,19 +1121,87 @@ func (c *Client) ToReview(collection api.Patcher) error {
 // For details on the Kinto Signer plugin, please see:
 // https://github.com/Kinto/kinto-signer
 func (c *Client) ToWIP(collection api.Patcher) error {
-	req, err := c.newRequest(http.MethodPatch, collection.Patch(), kintosigner.WIP())
+	return c.ToWIPContext(context.Background(), collection)
+}
+
+// ToWIPContext is the same as ToWIP, however the request is bound to the given context.
+func (c *Client) ToWIPContext(ctx context.Context, collection api.Patcher) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), kintosigner.WIP())
 	if err != nil {
 		return err
 	}
 	return c.do(req, nil, okOrCreated)
 }
 
+// ToReviewWithComment puts the given collection into the "to-review" state, with the given
+// note to its reviewers (E.G. the bug that motivated the changes).
+//
+// For details on the Kinto Signer plugin, please see:
+// https://github.com/Kinto/kinto-signer
+func (c *Client) ToReviewWithComment(collection api.Patcher, comment string) error {
+	return c.ToReviewWithCommentContext(context.Background(), collection, comment)
+}
+
+// ToReviewWithCommentContext is the same as ToReviewWithComment, however the request is bound to the given context.
+func (c *Client) ToReviewWithCommentContext(ctx context.Context, collection api.Patcher, comment string) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), kintosigner.ToReviewWithComment(comment))
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil, okOrCreated)
+}
+
+// ToWIPWithComment puts the given collection into the "work-in-progress" state, with
+// the given note to its editors.
+//
+// For details on the Kinto Signer plugin, please see:
+// https://github.com/Kinto/kinto-signer
+func (c *Client) ToWIPWithComment(collection api.Patcher, comment string) error {
+	return c.ToWIPWithCommentContext(context.Background(), collection, comment)
+}
+
+// ToWIPWithCommentContext is the same as ToWIPWithComment, however the request is bound to the given context.
+func (c *Client) ToWIPWithCommentContext(ctx context.Context, collection api.Patcher, comment string) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), kintosigner.WIPWithComment(comment))
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil, okOrCreated)
+}
+
+// DeclineReview declines the review that is pending upon the given collection for the given reason,
+// returning the collection to its editors. The changes under review are kept, rather than rolled back.
+// Note that Kinto Signer forbids the user that requested a review from declining it.
+//
+// For details on the Kinto Signer plugin, please see:
+// https://github.com/Kinto/kinto-signer
+func (c *Client) DeclineReview(collection api.Patcher, reason string) error {
+	return c.DeclineReviewContext(context.Background(), collection, reason)
+}
+
+// DeclineReviewContext is the same as DeclineReview, however the requests are bound to the given context.
+func (c *Client) DeclineReviewContext(ctx context.Context, collection api.Patcher, reason string) error {
+	status, err := c.SignerStatusForContext(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if !status.InReview() {
+		return fmt.Errorf("kinto: %s is not in review, its status is %q", collection.Patch(), status.Data.Status)
+	}
+	return c.ToWIPWithCommentContext(ctx, collection, reason)
+}
+
 // ToSign puts the given collection into the "to-sign" state.
 //
 // For details on the Kinto Signer plugin, please see:
 // https://github.com/Kinto/kinto-signer
 func (c *Client) ToSign(collection api.Patcher) error {
-	req, err := c.newRequest(http.MethodPatch, collection.Patch(), kintosigner.ToSign())
+	return c.ToSignContext(context.Background(), collection)
+}
+
+// ToSignContext is the same as ToSign, however the request is bound to the given context.
+func (c *Client) ToSignContext(ctx context.Context, collection api.Patcher) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), kintosigner.ToSign())
 	if err != nil {
 		return err
 	}
@@ -302,7 +1213,12 @@ func (c *Client) ToSign(collection api.Patcher) error {
 // For details on the Kinto Signer plugin, please see:
 // https://github.com/Kinto/kinto-signer
 func (c *Client) ToSigned(collection api.Patcher) error {
-	req, err := c.newRequest(http.MethodPatch, collection.Patch(), kintosigner.Signed())
+	return c.ToSignedContext(context.Background(), collection)
+}
+
+// ToSignedContext is the same as ToSigned, however the request is bound to the given context.
+func (c *Client) ToSignedContext(ctx context.Context, collection api.Patcher) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), kintosigner.Signed())
 	if err != nil {
 		return err
 	}
@@ -314,7 +1230,12 @@ func (c *Client) ToSigned(collection api.Patcher) error {
 // For details on the Kinto Signer plugin, please see:
 // https://github.com/Kinto/kinto-signer
 func (c *Client) ToRollBack(collection api.Patcher) error {
-	req, err := c.newRequest(http.MethodPatch, collection.Patch(), kintosigner.ToRollback())
+	return c.ToRollBackContext(context.Background(), collection)
+}
+
+// ToRollBackContext is the same as ToRollBack, however the request is bound to the given context.
+func (c *Client) ToRollBackContext(ctx context.Context, collection api.Patcher) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), kintosigner.ToRollback())
 	if err != nil {
 		return err
 	}
@@ -326,7 +1247,12 @@ func (c *Client) ToRollBack(collection api.Patcher) error {
 // For details on the Kinto Signer plugin, please see:
 // https://github.com/Kinto/kinto-signer
 func (c *Client) ToResign(collection api.Patcher) error {
-	req, err := c.newRequest(http.MethodPatch, collection.Patch(), kintosigner.ToResign())
+	return c.ToResignContext(context.Background(), collection)
+}
+
+// ToResignContext is the same as ToResign, however the request is bound to the given context.
+func (c *Client) ToResignContext(ctx context.Context, collection api.Patcher) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, collection.Patch(), kintosigner.ToResign())
 	if err != nil {
 		return err
 	}
@@ -338,17 +1264,21 @@ func (c *Client) ToResign(collection api.Patcher) error {
 //
 // See https://docs.kinto-storage.org/en/stable/api/1.x/authentication.html#try-authentication for details.
 func (c *Client) TryAuth() (bool, error) {
-	r, err := c.newRequest(http.MethodGet, "/", nil)
-	if err != nil {
-		return false, err
+	return c.TryAuthContext(context.Background())
+}
+
+// TryAuthContext is the same as TryAuth, however the request is bound to the given context.
+func (c *Client) TryAuthContext(ctx context.Context) (bool, error) {
+	info, err := c.ServerInfoContext(ctx)
+	if IsUnauthorized(err) {
+		// Some authentication policies (E.G. OpenID) reject bad credentials outright rather
+		// than falling back to an anonymous session, which is still a failed authentication.
+		return false, nil
 	}
-	ret := make(map[string]interface{})
-	err = c.do(r, &ret, map[int]bool{200: true})
 	if err != nil {
 		return false, err
 	}
-	_, authenticated := ret["user"]
-	return authenticated, nil
+	return info.Authenticated(), nil
 }
 
 // BatchMaxRequests retrieves the "settings.batch_max_requests" from the utility endpoint.
@@ -358,23 +1288,19 @@ func (c *Client) TryAuth() (bool, error) {
 // For details, please see:
 // https://docs.kinto-storage.org/en/stable/api/1.x/utilities.html#api-utilities
 func (c *Client) BatchMaxRequests() (int, error) {
-	answer := struct {
-		Settings struct {
-			BatchMaxRequests int `json:"batch_max_requests"`
-		} `json:"settings"`
-	}{}
-	r, err := c.newRequest(http.MethodGet, "/", nil)
-	if err != nil {
-		return 0, err
-	}
-	err = c.do(r, &answer, map[int]bool{200: true})
+	return c.BatchMaxRequestsContext(context.Background())
+}
+
+// BatchMaxRequestsContext is the same as BatchMaxRequests, however the request is bound to the given context.
+func (c *Client) BatchMaxRequestsContext(ctx context.Context) (int, error) {
+	info, err := c.ServerInfoContext(ctx)
 	if err != nil {
 		return 0, err
 	}
-	return answer.Settings.BatchMaxRequests, nil
+	return info.Settings.BatchMaxRequests, nil
 }
 
-func (c *Client) newRequest(method string, endpoint string, body interface{}) (*http.Request, error) {
+func (c *Client) newRequest(ctx context.Context, method string, endpoint string, body interface{}) (*http.Request, error) {
 	var b io.Reader
 	if body != nil {
 		bodyBytes, err := json.Marshal(body)
@@ -383,7 +1309,36 @@ func (c *Client) newRequest(method string, endpoint string, body interface{}) (*
 		}
 		b = bytes.NewReader(bodyBytes)
 	}
-	req, err := http.NewRequest(method, fmt.Sprintf("%s://%s%s%s", c.scheme, c.host, c.base, endpoint), b)
+	return c.newRawRequest(ctx, method, endpoint, b)
+}
+
+// newRawRequest is the same as newRequest, however the body is sent as-is rather than as JSON.
+func (c *Client) newRawRequest(ctx context.Context, method string, endpoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s://%s%s%s", c.scheme, c.host, c.base, endpoint), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-AUTOMATED-TOOL", c.tool)
+	return req, nil
+}
+
+// nextPage builds the request for the page advertised by the Next-Page header
+// of the given response. A nil request is returned if there are no more pages.
+//
+// Only the path and query of the advertised URL are honored. The scheme and host are
+// always those of this client so that credentials are never sent to a host other than
+// the one that was configured (Kinto deployments behind a proxy may also advertise an
+// internal hostname).
+func (c *Client) nextPage(ctx context.Context, resp *http.Response) (*http.Request, error) {
+	next := resp.Header.Get("Next-Page")
+	if next == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(next)
+	if err != nil {
+		return nil, fmt.Errorf("Kinto gave us a Next-Page header, but it did not parse to a URL. Got '%s'", next)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s%s", c.scheme, c.host, u.RequestURI()), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -392,23 +1347,86 @@ func (c *Client) newRequest(method string, endpoint string, body interface{}) (*
 }
 
 func (c *Client) do(r *http.Request, target interface{}, accept expectations) error {
-	backoff := c.getBackoff()
+	_, err := c.send(r, target, accept)
+	return err
+}
+
+// send is the same as do, however the response is returned so that headers
+// (E.G. Next-Page) may be inspected by the caller. The body of the returned
+// response has already been consumed and closed.
+//
+// Requests which fail transiently are retried according to the client's RetryPolicy.
+func (c *Client) send(r *http.Request, target interface{}, accept expectations) (*http.Response, error) {
 	c.authenticate(r)
+	policy := c.getRetryPolicy()
+	var resp *http.Response
+	var err error
+	for attempt := 1; ; attempt++ {
+		resp, err = c.attempt(r)
+		delay, retry := policy.next(attempt, r, resp, err)
+		if !retry {
+			break
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+			log.Printf("Kinto responded to %s %s with %d, retrying in %s\n", r.Method, r.URL.Path, resp.StatusCode, delay)
+		} else {
+			log.Printf("%s %s failed (%v), retrying in %s\n", r.Method, r.URL.Path, err, delay)
+		}
+		if err := sleep(r.Context(), delay); err != nil {
+			return nil, err
+		}
+		if r, err = rewind(r); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	if accept != nil {
+		if _, ok := accept[resp.StatusCode]; !ok {
+			// A failure to read the body still leaves us with
+			// a status code, which is better than nothing.
+			b, _ := ioutil.ReadAll(resp.Body)
+			return resp, newError(resp.StatusCode, b)
+		}
+	}
+	if target != nil && resp.StatusCode != http.StatusNotModified {
+		return resp, json.NewDecoder(resp.Body).Decode(&target)
+	}
+	return resp, nil
+}
+
+// attempt makes a single attempt at the given request, honoring any Backoff
+// that Kinto has previously asked for and recording any that it asks for now.
+//
+// If a non-nil error is returned alongside a non-nil response, then the body
+// of that response has already been closed.
+func (c *Client) attempt(r *http.Request) (*http.Response, error) {
+	backoff := c.getBackoff()
 	if backoff > 0 {
 		// Kinto kindly asks us that we backoff when necessary
 		// See https://docs.kinto-storage.org/en/stable/api/1.x/backoff.html
-		log.Printf("Kinto has asked us to backoff for %d seconds\n", c.backoff)
-		time.Sleep(time.Second * c.backoff)
+		log.Printf("Kinto has asked us to backoff for %s\n", backoff)
+		if err := sleep(r.Context(), backoff); err != nil {
+			return nil, err
+		}
 	}
-	resp, err := c.inner.Do(r)
+	resp, err := c.getInner().Do(r)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if alert := resp.Header.Get("Alert"); alert != "" {
+		c.getAlertHandler()(parseAlert(alert))
 	}
 	receivedBackoff := resp.Header.Get("Backoff")
 	if receivedBackoff != "" {
 		b, err := strconv.Atoi(receivedBackoff)
 		if err != nil {
-			return fmt.Errorf(
+			_ = resp.Body.Close()
+			return resp, fmt.Errorf(
 				"Kinto gave us a Backoff header, but "+
 					"it did not parse to an integer. Got '%s'",
 				receivedBackoff)
@@ -417,29 +1435,82 @@ func (c *Client) do(r *http.Request, target interface{}, accept expectations) er
 	} else {
 		c.setBackoff(time.Duration(0))
 	}
-	if accept != nil {
-		if _, ok := accept[resp.StatusCode]; !ok {
-			defer resp.Body.Close()
-			b, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return fmt.Errorf("expected status code %v, got %d", accept, resp.StatusCode)
-			}
-			return fmt.Errorf("expected status code %v, got %d. Message %s", accept, resp.StatusCode, string(b))
-		}
-	}
-	if target != nil {
-		defer resp.Body.Close()
-		return json.NewDecoder(resp.Body).Decode(&target)
+	return resp, nil
+}
+
+// etag formats a Kinto timestamp as the (quoted) entity tag that Kinto
+// expects within the If-Match and If-None-Match headers.
+func etag(timestamp uint64) string {
+	return fmt.Sprintf(`"%d"`, timestamp)
+}
+
+// quoteEscaper escapes a value for use within a quoted MIME parameter.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// invalid returns the reason why the given endpoint cannot be sent, should it be one
+// which reports as much (E.G. a query.Query with a value that Kinto cannot match).
+func invalid(endpoint api.Getter) error {
+	if e, ok := endpoint.(interface{ Err() error }); ok {
+		return e.Err()
 	}
 	return nil
 }
 
+// withQuery appends the given query to the given endpoint, which may already carry a query of its own.
+func withQuery(endpoint string, query url.Values) string {
+	if len(query) == 0 {
+		return endpoint
+	}
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + query.Encode()
+	}
+	return endpoint + "?" + query.Encode()
+}
+
+// splitQuery splits the given endpoint into its path and its query (if any).
+func splitQuery(endpoint string) (string, url.Values) {
+	i := strings.Index(endpoint, "?")
+	if i < 0 {
+		return endpoint, url.Values{}
+	}
+	query, err := url.ParseQuery(endpoint[i+1:])
+	if err != nil {
+		return endpoint[:i], url.Values{}
+	}
+	return endpoint[:i], query
+}
+
+// parseETag parses a quoted Kinto timestamp (as found in the ETag header).
+func parseETag(header string) (uint64, error) {
+	timestamp, err := strconv.ParseUint(strings.Trim(header, `"`), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Kinto gave us an ETag header, but it was not a timestamp. Got '%s'", header)
+	}
+	return timestamp, nil
+}
+
 func (c *Client) authenticate(r *http.Request) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	c.authenticator.Authenticate(r)
 }
 
+// chain replaces the inner HTTP client with a copy whose transport is wrapped by the client's middleware.
+// The inner client is never modified in place, as requests that are in flight may be using it.
+//
+// The caller must hold c.lock.
+func (c *Client) chain() {
+	inner := *c.inner
+	inner.Transport = middleware.Chain(c.transport, c.middleware...)
+	c.inner = &inner
+}
+
+func (c *Client) getInner() *http.Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.inner
+}
+
 func (c *Client) getBackoff() time.Duration {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -451,3 +1522,15 @@ func (c *Client) setBackoff(backoff time.Duration) {
 	defer c.lock.Unlock()
 	c.backoff = backoff
 }
+
+func (c *Client) getRetryPolicy() *RetryPolicy {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.retry
+}
+
+func (c *Client) getAlertHandler() func(alert *Alert) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.alerts
+}
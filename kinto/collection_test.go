@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+)
+
+func TestCollectionMetadata(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1"+NewOneCRL().Patch() {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"data": {
+			"id": "onecrl",
+			"last_modified": 42,
+			"status": "to-review",
+			"last_review_request_by": "account:dev",
+			"schema": {"type": "object", "required": ["details"]}
+		}}`))
+	}))
+	metadata, err := c.CollectionMetadata(NewOneCRL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Status != "to-review" || metadata.LastReviewRequestBy != "account:dev" || metadata.LastModified != 42 {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+	s, err := c.CollectionSchema(NewOneCRL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ValidateJSON([]byte(`{"enabled": true}`)); err == nil {
+		t.Error("expected a record without details to be invalid")
+	}
+}
+
+func TestCollectionWithoutSchema(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": {"id": "onecrl", "last_modified": 42}}`))
+	}))
+	s, err := c.CollectionSchema(NewOneCRL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != nil {
+		t.Error("expected no schema")
+	}
+}
+
+func TestUpdateCollectionMetadata(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			t.Errorf("expected a PATCH, got %s", r.Method)
+		}
+		sent := make(map[string]map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Error(err)
+			return
+		}
+		if len(sent["data"]) != 1 || sent["data"]["schema"] == nil {
+			t.Errorf("expected only the schema to be sent, got %v", sent["data"])
+		}
+		_, _ = w.Write([]byte(`{"data": {"id": "onecrl", "last_modified": 43, "schema": {"type": "object"}}}`))
+	}))
+	metadata := &collections.Metadata{Schema: json.RawMessage(`{"type": "object"}`)}
+	if err := c.UpdateCollectionMetadata(NewOneCRL(), metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.ID != "onecrl" || metadata.LastModified != 43 {
+		t.Errorf("expected the metadata to be updated, got %+v", metadata)
+	}
+}
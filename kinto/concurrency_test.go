@@ -0,0 +1,122 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+)
+
+// conditional simulates Kinto's handling of If-Match and If-None-Match
+// for a single record whose current revision is at the given timestamp.
+func conditional(t *testing.T, id string, current uint64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if match := r.Header.Get("If-Match"); match != "" {
+			if match != etag(current) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				_, _ = w.Write([]byte(`{"code": 412, "errno": 114, "error": "Precondition Failed", "message": "Resource was modified meanwhile"}`))
+				return
+			}
+			current++
+		}
+		if match := r.Header.Get("If-None-Match"); match != "" {
+			if match != "*" {
+				t.Errorf("unexpected If-None-Match %s", match)
+			}
+			if r.Method != http.MethodPut {
+				t.Errorf("expected a PUT for a record with an ID, got %s", r.Method)
+			}
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		switch r.Method {
+		case http.MethodDelete:
+			_, _ = w.Write([]byte(`{"data": {"id": "` + id + `", "deleted": true}}`))
+		default:
+			_, _ = w.Write([]byte(`{"data": {"id": "` + id + `", "last_modified": 11}}`))
+		}
+	})
+}
+
+func TestUpdateRecordIfUnmodified(t *testing.T) {
+	c := testClient(t, conditional(t, "abc", 10))
+	record := &OneCRLRecord{Record: &api.Record{Id: "abc", LastModified: 10}}
+	if err := c.UpdateRecordIfUnmodified(NewOneCRL(), record); err != nil {
+		t.Fatal(err)
+	}
+	if record.LastModified != 11 {
+		t.Errorf("expected the record's timestamp to be updated, got %d", record.LastModified)
+	}
+}
+
+func TestUpdateRecordIfUnmodifiedConflict(t *testing.T) {
+	c := testClient(t, conditional(t, "abc", 12))
+	record := &OneCRLRecord{Record: &api.Record{Id: "abc", LastModified: 10}}
+	err := c.UpdateRecordIfUnmodified(NewOneCRL(), record)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+}
+
+func TestUpdateRecordIfUnmodifiedRequiresVersion(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no request should have been sent")
+	}))
+	record := &OneCRLRecord{Record: &api.Record{Id: "abc"}}
+	if err := c.UpdateRecordIfUnmodified(NewOneCRL(), record); err == nil {
+		t.Fatal("expected an error for a record without a timestamp")
+	}
+}
+
+func TestDeleteIfUnmodified(t *testing.T) {
+	c := testClient(t, conditional(t, "abc", 10))
+	resp, err := c.DeleteIfUnmodified(NewOneCRL(), &api.Record{Id: "abc", LastModified: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Data.Deleted {
+		t.Error("expected the record to be deleted")
+	}
+}
+
+func TestDeleteIfUnmodifiedConflict(t *testing.T) {
+	c := testClient(t, conditional(t, "abc", 12))
+	_, err := c.DeleteIfUnmodified(NewOneCRL(), &api.Record{Id: "abc", LastModified: 10})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+}
+
+func TestNewRecordIfAbsentConflict(t *testing.T) {
+	c := testClient(t, conditional(t, "abc", 10))
+	record := &OneCRLRecord{Record: &api.Record{Id: "abc"}}
+	err := c.NewRecordIfAbsent(NewOneCRL(), record)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+}
+
+func TestNewRecordIfAbsentWithoutID(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected a POST for a record without an ID, got %s", r.Method)
+		}
+		if r.Header.Get("If-None-Match") != "*" {
+			t.Errorf("expected If-None-Match: *, got %s", r.Header.Get("If-None-Match"))
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"data": {"id": "generated", "last_modified": 1}}`))
+	}))
+	record := &OneCRLRecord{}
+	if err := c.NewRecordIfAbsent(NewOneCRL(), record); err != nil {
+		t.Fatal(err)
+	}
+	if record.ID() != "generated" {
+		t.Errorf("expected the generated ID to be populated, got %s", record.ID())
+	}
+}
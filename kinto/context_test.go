@@ -0,0 +1,72 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	start := time.Now()
+	err := c.AllRecordsContext(ctx, NewOneCRL())
+	if err == nil {
+		t.Fatal("expected the deadline to be exceeded")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline exceeded error, got %v", err)
+	}
+	if time.Since(start) > time.Second*5 {
+		t.Errorf("the call was not cancelled promptly")
+	}
+}
+
+func TestContextCancelsBackoff(t *testing.T) {
+	requests := 0
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Backoff", "3600")
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}))
+	if err := c.AllRecords(NewOneCRL()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := c.AllRecordsContext(ctx, NewOneCRL())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error while backing off, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected the second request to never be sent, got %d requests", requests)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})).WithTimeout(time.Millisecond * 50).WithRetryPolicy(NoRetries())
+	if _, err := c.TryAuth(); err == nil {
+		t.Fatal("expected the client timeout to be exceeded")
+	}
+}
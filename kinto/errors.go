@@ -0,0 +1,206 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/batch"
+)
+
+// Kinto's errno values, which refine the HTTP status code of an error response.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/errors.html#error-responses
+const (
+	ErrnoMissingAuthToken      = 104
+	ErrnoInvalidAuthToken      = 105
+	ErrnoBadJSON               = 106
+	ErrnoInvalidParameters     = 107
+	ErrnoMissingParameters     = 108
+	ErrnoInvalidPostedData     = 109
+	ErrnoInvalidResourceID     = 110
+	ErrnoMissingResource       = 111
+	ErrnoMissingContentLength  = 112
+	ErrnoRequestTooLarge       = 113
+	ErrnoModifiedMeanwhile     = 114
+	ErrnoMethodNotAllowed      = 115
+	ErrnoVersionNotAvailable   = 116
+	ErrnoClientReachedCapacity = 117
+	ErrnoForbidden             = 121
+	ErrnoConstraintViolated    = 122
+	ErrnoBackend               = 201
+	ErrnoServiceDeprecated     = 202
+	ErrnoUndefined             = 999
+)
+
+// An Error is Kinto's standard error envelope, which is returned whenever Kinto
+// responds with a status code that the call in question did not expect.
+//
+// Callers may retrieve an Error from any error returned by this package via errors.As,
+// or use the Is* family of helpers (E.G. IsNotFound) for the most common cases.
+//
+//	err := client.UpdateRecord(collection, record)
+//	var kintoErr *kinto.Error
+//	if errors.As(err, &kintoErr) && kintoErr.Errno == kinto.ErrnoInvalidParameters {
+//		log.Println(kintoErr.Message, string(kintoErr.Details))
+//	}
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/errors.html
+type Error struct {
+	// The HTTP status code.
+	Code int `json:"code"`
+	// Kinto's internal error number, which refines the HTTP status code (see the Errno* constants).
+	Errno int `json:"errno"`
+	// The HTTP status text (E.G. "Not Found").
+	ErrorName string `json:"error"`
+	// A human readable description of the error.
+	Message string `json:"message,omitempty"`
+	// A link to more information about the error, if any.
+	Info string `json:"info,omitempty"`
+	// Structured context for the error, such as the location and description of
+	// each invalid field of a rejected record. The shape of this field depends on the error.
+	Details json.RawMessage `json:"details,omitempty"`
+	// The raw response body, which is retained in case the response
+	// was not a Kinto error envelope (E.G. an HTML page from a proxy).
+	Body string `json:"-"`
+}
+
+// newError constructs an Error from the given response status and body. If the body is not
+// a Kinto error envelope, then the status code is used and the body is kept as the message.
+func newError(status int, body []byte) *Error {
+	e := new(Error)
+	if err := json.Unmarshal(body, e); err != nil || e.Code == 0 {
+		e = &Error{Message: strings.TrimSpace(string(body))}
+	}
+	e.Code = status
+	if e.ErrorName == "" {
+		e.ErrorName = http.StatusText(status)
+	}
+	e.Body = string(body)
+	return e
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("kinto: %d %s", e.Code, e.ErrorName)
+	if e.Errno != 0 {
+		msg += fmt.Sprintf(" (errno %d)", e.Errno)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if len(e.Details) > 0 {
+		msg += " " + string(e.Details)
+	}
+	return msg
+}
+
+// Is reports a 412 Precondition Failed as ErrConflict, so that
+// errors.Is(err, ErrConflict) holds for such errors.
+func (e *Error) Is(target error) bool {
+	return target == ErrConflict && e.Code == http.StatusPreconditionFailed
+}
+
+// AsError returns the Error within the given error's chain, if there is one.
+func AsError(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// IsNotFound reports whether the given error is a Kinto 404, which is
+// returned for resources that do not exist (or which you may not read).
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether the given error is a Kinto 401, which is
+// returned for missing or invalid credentials.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden reports whether the given error is a Kinto 403, which is returned when
+// valid credentials were provided but lack the permissions for the operation.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsConflict reports whether the given error is a Kinto 412 (see ErrConflict).
+func IsConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+// IsInvalidRecord reports whether the given error is a Kinto 400 that rejected the
+// submitted data, such as a record failing the collection's JSON schema.
+// The Details of the Error describes which fields were invalid.
+func IsInvalidRecord(err error) bool {
+	e, ok := AsError(err)
+	if !ok || e.Code != http.StatusBadRequest {
+		return false
+	}
+	switch e.Errno {
+	case ErrnoBadJSON, ErrnoInvalidParameters, ErrnoMissingParameters, ErrnoInvalidPostedData:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsBackendError reports whether the given error is a Kinto 5xx.
+func IsBackendError(err error) bool {
+	e, ok := AsError(err)
+	return ok && e.Code >= 500
+}
+
+// A BatchError is returned by Client.BatchAll when any of the batched requests failed. As Kinto does
+// not apply a batch atomically, every request that is not within Failed was successfully applied.
+type BatchError struct {
+	// The result of every batched request, in the order of the requests of the batch.
+	Response *batch.BatchResponse
+	// The index (within the batch) of every failed request, mapped to the error that it received.
+	Failed map[int]*Error
+}
+
+// newBatchError returns a *BatchError if any of the given responses failed, otherwise nil.
+func newBatchError(resp *batch.BatchResponse) error {
+	failed := resp.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	e := &BatchError{Response: resp, Failed: make(map[int]*Error, len(failed))}
+	for _, i := range failed {
+		e.Failed[i] = newError(resp.Responses[i].Status, resp.Responses[i].Body)
+	}
+	return e
+}
+
+// Indices returns the index of every failed request, in ascending order.
+func (e *BatchError) Indices() []int {
+	indices := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+func (e *BatchError) Error() string {
+	indices := e.Indices()
+	first := indices[0]
+	return fmt.Sprintf("kinto: %d of %d batched requests failed, the first being request %d (%s): %v",
+		len(indices), len(e.Response.Responses), first, e.Response.Responses[first].Path, e.Failed[first])
+}
+
+func hasStatus(err error, status int) bool {
+	e, ok := AsError(err)
+	return ok && e.Code == status
+}
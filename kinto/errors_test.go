@@ -0,0 +1,129 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// failing responds to every request with the given status and body.
+func failing(status int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	body := `{
+		"code": 400,
+		"errno": 107,
+		"error": "Invalid parameters",
+		"message": "data.serial_number in body: 'serial_number' is a required property",
+		"info": "https://docs.kinto-storage.org/",
+		"details": [{"location": "body", "name": "data.serial_number", "description": "required"}]
+	}`
+	c := testClient(t, failing(http.StatusBadRequest, body))
+	err := c.NewRecord(NewOneCRL(), &OneCRLRecord{})
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected a *kinto.Error, got %T %v", err, err)
+	}
+	if e.Code != 400 || e.Errno != ErrnoInvalidParameters || e.ErrorName != "Invalid parameters" {
+		t.Errorf("unexpected envelope %+v", e)
+	}
+	if e.Info != "https://docs.kinto-storage.org/" {
+		t.Errorf("unexpected info %s", e.Info)
+	}
+	var details []map[string]string
+	if err := json.Unmarshal(e.Details, &details); err != nil {
+		t.Fatal(err)
+	}
+	if len(details) != 1 || details[0]["name"] != "data.serial_number" {
+		t.Errorf("unexpected details %s", string(e.Details))
+	}
+	if !IsInvalidRecord(err) {
+		t.Error("expected IsInvalidRecord")
+	}
+	if IsNotFound(err) || IsConflict(err) {
+		t.Error("a 400 is neither a 404 nor a 412")
+	}
+}
+
+func TestErrorHelpers(t *testing.T) {
+	tests := []struct {
+		status int
+		errno  int
+		is     func(error) bool
+	}{
+		{http.StatusNotFound, ErrnoInvalidResourceID, IsNotFound},
+		{http.StatusUnauthorized, ErrnoMissingAuthToken, IsUnauthorized},
+		{http.StatusForbidden, ErrnoForbidden, IsForbidden},
+		{http.StatusPreconditionFailed, ErrnoModifiedMeanwhile, IsConflict},
+		{http.StatusServiceUnavailable, ErrnoBackend, IsBackendError},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			body := fmt.Sprintf(`{"code": %d, "errno": %d, "error": "%s"}`,
+				test.status, test.errno, http.StatusText(test.status))
+			c := testClient(t, failing(test.status, body))
+			err := c.AllRecords(NewOneCRL())
+			if !test.is(err) {
+				t.Fatalf("helper did not match %v", err)
+			}
+			if IsInvalidRecord(err) {
+				t.Errorf("%d is not an invalid record", test.status)
+			}
+			// Wrapping must not hide the error from any of the helpers.
+			if !test.is(fmt.Errorf("wrapped: %w", err)) {
+				t.Errorf("helper did not match a wrapped error")
+			}
+		})
+	}
+}
+
+func TestErrorIsConflict(t *testing.T) {
+	body := `{"code": 412, "errno": 114, "error": "Precondition Failed", "message": "Resource was modified meanwhile"}`
+	c := testClient(t, failing(http.StatusPreconditionFailed, body))
+	err := c.AllRecords(NewOneCRL())
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+}
+
+func TestErrorNotAnEnvelope(t *testing.T) {
+	c := testClient(t, failing(http.StatusBadGateway, "<html>Bad Gateway</html>"))
+	err := c.AllRecords(NewOneCRL())
+	e, ok := AsError(err)
+	if !ok {
+		t.Fatalf("expected a *kinto.Error, got %T %v", err, err)
+	}
+	if e.Code != http.StatusBadGateway || e.ErrorName != "Bad Gateway" || e.Errno != 0 {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if e.Body != "<html>Bad Gateway</html>" {
+		t.Errorf("expected the raw body to be retained, got %s", e.Body)
+	}
+	if !IsBackendError(err) {
+		t.Error("expected IsBackendError")
+	}
+}
+
+func TestTryAuthUnauthorized(t *testing.T) {
+	body := `{"code": 401, "errno": 104, "error": "Unauthorized", "message": "Please authenticate yourself to use this endpoint."}`
+	c := testClient(t, failing(http.StatusUnauthorized, body))
+	ok, err := c.TryAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected a rejected authentication")
+	}
+}
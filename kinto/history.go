@@ -0,0 +1,33 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintohistory"
+)
+
+// History lists every entry of the audit trail of a bucket that matches the given filter,
+// newest first unless the filter says otherwise. The server must have the Kinto History
+// plugin enabled, otherwise an error matching IsNotFound is returned.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/history.html
+func (c *Client) History(filter *kintohistory.Filter) ([]*kintohistory.Entry, error) {
+	return c.HistoryContext(context.Background(), filter)
+}
+
+// HistoryContext is the same as History, however the requests are bound to the given context.
+func (c *Client) HistoryContext(ctx context.Context, filter *kintohistory.Filter) ([]*kintohistory.Entry, error) {
+	entries := make([]*kintohistory.Entry, 0)
+	err := c.StreamRecordsContext(ctx, filter, func(b json.RawMessage) error {
+		entry := new(kintohistory.Entry)
+		entries = append(entries, entry)
+		return json.Unmarshal(b, entry)
+	})
+	return entries, err
+}
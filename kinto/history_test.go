@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintohistory"
+)
+
+func TestHistory(t *testing.T) {
+	since := time.Unix(1603376223, 283000000)
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/buckets/security-state-staging/history" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		want := map[string]string{
+			"collection_id": "onecrl",
+			"resource_name": "record",
+			"in_action":     "create,delete",
+			"user_id":       "account:alice",
+			"_since":        "1603376223283",
+		}
+		for key, value := range want {
+			if got := query.Get(key); got != value {
+				t.Errorf("expected %s=%s, got %q", key, value, got)
+			}
+		}
+		if r.URL.Query().Get("_token") == "" {
+			w.Header().Set("Next-Page", "http://"+r.Host+r.URL.Path+"?"+r.URL.RawQuery+"&_token=next")
+			_, _ = w.Write([]byte(`{"data": [{
+				"id": "2", "last_modified": 1603376223400, "action": "delete", "resource_name": "record",
+				"uri": "/buckets/security-state-staging/collections/onecrl/records/a", "user_id": "account:alice",
+				"bucket_id": "security-state-staging", "collection_id": "onecrl", "record_id": "a",
+				"target": {"data": {"id": "a", "deleted": true}}
+			}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": [{
+			"id": "1", "last_modified": 1603376223300, "action": "create", "resource_name": "record",
+			"uri": "/buckets/security-state-staging/collections/onecrl/records/a", "user_id": "account:alice",
+			"bucket_id": "security-state-staging", "collection_id": "onecrl", "record_id": "a",
+			"target": {"data": {"id": "a", "serialNumber": "AQ=="}, "permissions": {"write": ["account:alice"]}}
+		}]}`))
+	}))
+	filter := kintohistory.New(buckets.NewBucket("security-state-staging")).
+		Collection("onecrl").
+		ResourceName(kintohistory.Record).
+		Action(kintohistory.Create, kintohistory.Delete).
+		User("account:alice").
+		Since(since)
+	entries, err := c.History(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != kintohistory.Delete || entries[1].Action != kintohistory.Create {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if !entries[1].Time().Equal(time.Unix(1603376223, 300000000)) {
+		t.Errorf("unexpected time %s", entries[1].Time())
+	}
+	record := new(OneCRLRecord)
+	if err := entries[1].Unmarshal(record); err != nil {
+		t.Fatal(err)
+	}
+	if record.SerialNumber != "AQ==" || entries[1].Target.Permissions.Write[0] != "account:alice" {
+		t.Errorf("unexpected target %v", entries[1].Target)
+	}
+}
+
+func TestHistoryRejectsCommas(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected no request to be sent, got %s", r.URL)
+	}))
+	bucket := buckets.NewBucket("security-state-staging")
+	if err := kintohistory.New(bucket).User("account:alice,bob").Err(); err != nil {
+		t.Errorf("expected a single value to be sent as-is, got %v", err)
+	}
+	filter := kintohistory.New(bucket).User("account:alice,bob", "account:carol")
+	if filter.Err() == nil {
+		t.Fatalf("expected %s to be rejected", filter.Get())
+	}
+	if _, err := c.History(filter); err == nil {
+		t.Error("expected History to refuse the filter")
+	}
+}
+
+func TestHistoryNotEnabled(t *testing.T) {
+	c := testClient(t, failing(http.StatusNotFound, `{"code": 404, "errno": 111, "error": "Not Found"}`))
+	_, err := c.History(kintohistory.New(buckets.NewBucket("security-state-staging")))
+	if !IsNotFound(err) {
+		t.Errorf("expected a 404, got %v", err)
+	}
+}
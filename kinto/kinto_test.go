@@ -8,12 +8,11 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/mozilla/OneCRL-Tools/kinto/api"
 
@@ -23,6 +22,8 @@ import (
 	"github.com/mozilla/OneCRL-Tools/kinto/api/batch"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
 	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+	kintolocal "github.com/mozilla/OneCRL-Tools/kinto/local"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
 )
 
 func NewOneCRL() *OneCRLCollection {
@@ -66,45 +67,38 @@ var admin = &auth.User{
 	Username: "admin",
 	Password: "password",
 }
-var local = NewClient("http", "localhost:8888", "/v1").WithAuthenticator(dev)
+
+// local is a client of the SQLite backed Kinto served for the duration of the tests (see TestMain).
+var local *Client
 
 var devRW = &authz.Permissions{
 	Read:  []string{"account:superDev"},
 	Write: []string{"account:superDev"},
 }
 
+// liveEnv is the environment variable which, if set, opts into the tests that talk to the real
+// Kinto production (rather than to the local Kinto, or to a cassette) and so require the network.
+const liveEnv = "LIVE_TESTS"
+
+// localHost is the host of the SQLite backed Kinto (see the local package) that local talks to.
+var localHost string
+
 func TestMain(m *testing.M) {
 	flag.Parse()
-	if testing.Short() {
-		os.Exit(0)
-		return
-	}
-
-	cwd, err := os.Getwd()
+	config := kintolocal.DefaultConfig()
+	// Sign every collection of the to_sign bucket (rather than only to_sign/onecrl, as with
+	// the Docker backed Kinto) so that TestKintoSigner exercises the signer's workflow.
+	config.Signer.Resources = []*kintosigner.Resource{{
+		Source:      kintosigner.Location{Bucket: "to_sign"},
+		Destination: kintosigner.Location{Bucket: "signed"},
+	}}
+	server, err := kintolocal.NewServer(":memory:", config)
 	if err != nil {
 		panic(err)
 	}
-	dir := filepath.Join(cwd, "local")
-	down := exec.Command("docker-compose", "down")
-	down.Dir = dir
-	out, err := down.CombinedOutput()
-	if err != nil {
-		panic(fmt.Sprintf("KINTO_TESTDIR: '%s', Output: '%s', Error:'%v'", dir, string(out), err))
-	}
-	up := exec.Command("docker-compose", "up")
-	up.Dir = dir
-	err = up.Start()
-	if err != nil {
-		panic(err)
-	}
-	start := time.Now()
-	for !local.Alive() {
-		time.Sleep(time.Millisecond * 200)
-		if time.Now().Sub(start) > time.Minute {
-			panic("took more than ten seconds to docker-compose up")
-		}
-	}
-	local.WithAuthenticator(&auth.Unauthenticated{})
+	s := httptest.NewServer(server)
+	localHost = strings.TrimPrefix(s.URL, "http://")
+	local = NewClient("http", localHost, "/v1")
 	err = local.NewAdmin(admin.Password)
 	if err != nil {
 		panic(err)
@@ -123,7 +117,10 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		panic(err)
 	}
-	CopyProd()
+	if os.Getenv(liveEnv) != "" {
+		// Copying production requires the network.
+		CopyProd()
+	}
 
 	signer := buckets.NewBucket("to_sign")
 	err = local.NewBucketWithPermissions(signer, devRW)
@@ -146,7 +143,10 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		panic(err)
 	}
-	os.Exit(m.Run())
+	code := m.Run()
+	s.Close()
+	_ = server.Close()
+	os.Exit(code)
 }
 
 func CopyProd() {
@@ -286,7 +286,7 @@ func TestGetOneCRL(t *testing.T) {
 }
 
 func TestTryAuth(t *testing.T) {
-	c := NewClient("http", "localhost:8888", "/v1").WithAuthenticator(admin)
+	c := NewClient("http", localHost, "/v1").WithAuthenticator(admin)
 	authed, err := c.TryAuth()
 	if err != nil {
 		t.Fatal(err)
@@ -297,7 +297,7 @@ func TestTryAuth(t *testing.T) {
 }
 
 func TestTryAuthFail(t *testing.T) {
-	c := NewClient("http", "localhost:8888", "/v1").WithAuthenticator(&auth.User{
+	c := NewClient("http", localHost, "/v1").WithAuthenticator(&auth.User{
 		Username: "chris",
 		Password: "nyope",
 	})
@@ -311,7 +311,7 @@ func TestTryAuthFail(t *testing.T) {
 }
 
 func TestNewAccount(t *testing.T) {
-	c := NewClient("http", "localhost:8888", "/v1").WithAuthenticator(admin)
+	c := NewClient("http", localHost, "/v1").WithAuthenticator(admin)
 	err := c.NewAccount(&auth.User{Username: "chris", Password: "password1234"})
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,115 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type batched struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+type batchedResponse struct {
+	Status  int               `json:"status"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    interface{}       `json:"body"`
+}
+
+// batch serves each request of the batch in turn, on behalf of whoever made the batch. As with Kinto,
+// the batch itself succeeds even if some of its requests fail, and paths may omit the "/v1" prefix.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/batch.html
+func (s *Server) batch(r *request) (*response, error) {
+	if r.Method != http.MethodPost {
+		return nil, methodNotAllowed(r)
+	}
+	body := struct {
+		Defaults *batched  `json:"defaults"`
+		Requests []batched `json:"requests"`
+	}{}
+	if err := json.Unmarshal(r.raw, &body); err != nil {
+		return nil, newError(http.StatusBadRequest, errnoBadJSON, "Invalid JSON: %v", err)
+	}
+	if len(body.Requests) == 0 {
+		return nil, newError(http.StatusBadRequest, errnoInvalidPostedData, "requests in body: Shorter than minimum length 1")
+	}
+	if s.config.BatchMaxRequests > 0 && len(body.Requests) > s.config.BatchMaxRequests {
+		return nil, newError(http.StatusBadRequest, errnoInvalidPostedData, "requests in body: Number of requests is limited to %d", s.config.BatchMaxRequests)
+	}
+	responses := make([]batchedResponse, len(body.Requests))
+	for i, b := range body.Requests {
+		if body.Defaults != nil {
+			b.defaults(body.Defaults)
+		}
+		if b.Method == "" {
+			b.Method = http.MethodGet
+		}
+		path := b.Path
+		if !strings.HasPrefix(path, Base+"/") {
+			path = Base + path
+		}
+		resp, err := s.batched(r, b, path)
+		if err != nil {
+			resp = errorResponse(err)
+		}
+		headers := make(map[string]string, len(resp.header))
+		for key := range resp.header {
+			headers[key] = resp.header.Get(key)
+		}
+		responses[i] = batchedResponse{Status: resp.status, Path: path, Headers: headers, Body: resp.body}
+	}
+	return respond(http.StatusOK, map[string]interface{}{"responses": responses}), nil
+}
+
+func (s *Server) batched(r *request, b batched, path string) (*response, error) {
+	inner, err := http.NewRequest(b.Method, path, bytes.NewReader(b.Body))
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, errnoInvalidParameters, "%v", err)
+	}
+	inner.Host, inner.TLS = r.Host, r.TLS
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		inner.Header.Set("Authorization", auth)
+	}
+	for key, value := range b.Headers {
+		inner.Header.Set(key, value)
+	}
+	req, err := s.newRequest(inner)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Path == Base+"/batch" {
+		return nil, newError(http.StatusBadRequest, errnoInvalidPostedData, "Recursive call on /batch endpoint is forbidden.")
+	}
+	return s.route(req)
+}
+
+func (b *batched) defaults(defaults *batched) {
+	if b.Method == "" {
+		b.Method = defaults.Method
+	}
+	if b.Path == "" {
+		b.Path = defaults.Path
+	}
+	if len(b.Body) == 0 {
+		b.Body = defaults.Body
+	}
+	for key, value := range defaults.Headers {
+		if _, ok := b.Headers[key]; !ok {
+			if b.Headers == nil {
+				b.Headers = make(map[string]string)
+			}
+			b.Headers[key] = value
+		}
+	}
+}
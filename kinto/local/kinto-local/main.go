@@ -0,0 +1,30 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Command kinto-local serves the SQLite backed Kinto of the local package. It is a drop-in
+// replacement for the Docker based Kinto described by kinto/local/docker-compose.yml.
+//
+//	go run ./kinto/local/kinto-local -addr localhost:8888 -db kinto.sqlite
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/local"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8888", "the address to listen on")
+	db := flag.String("db", "kinto.sqlite", `the SQLite database to persist to (":memory:" to persist nothing)`)
+	flag.Parse()
+	server, err := local.NewServer(*db, local.DefaultConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer server.Close()
+	log.Printf("serving Kinto at http://%s%s/", *addr, local.Base)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -0,0 +1,367 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package local
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// list serves the listing of every object of the given kind within the given parent that the request may read.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/filtering.html
+// https://docs.kinto-storage.org/en/stable/api/1.x/sorting.html
+// https://docs.kinto-storage.org/en/stable/api/1.x/pagination.html
+func (s *Server) list(r *request, chain []*object, parent, kind string) (*response, error) {
+	query := r.URL.Query()
+	filters, err := parseFilters(query)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := s.store.timestamp(parent, kind)
+	if err != nil {
+		return nil, err
+	}
+	resp := respond(http.StatusOK, nil)
+	resp.header.Set("ETag", etag(timestamp))
+	resp.header.Set("Last-Modified", time.Unix(0, int64(timestamp)*int64(time.Millisecond)).UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == etag(timestamp) {
+		resp.status = http.StatusNotModified
+		return resp, nil
+	}
+	all := s.allowed(r, "read", chain)
+	if len(chain) > 0 && !all && !s.allowed(r, kind+":create", chain) {
+		return nil, forbidden(r)
+	}
+	objects, err := s.store.list(parent, kind, query.Get("_since") != "")
+	if err != nil {
+		return nil, err
+	}
+	bodies := make([]map[string]interface{}, 0, len(objects))
+	for _, o := range objects {
+		if !all && !s.allowed(r, "read", append(append([]*object{}, chain...), o)) {
+			continue
+		}
+		body := o.body()
+		if filters.match(body) {
+			bodies = append(bodies, body)
+		}
+	}
+	if err := sortBodies(bodies, query.Get("_sort")); err != nil {
+		return nil, err
+	}
+	total := strconv.Itoa(len(bodies))
+	resp.header.Set("Total-Records", total)
+	resp.header.Set("Total-Objects", total)
+	offset, err := parseToken(query.Get("_token"))
+	if err != nil {
+		return nil, err
+	}
+	limit, err := s.limit(query.Get("_limit"))
+	if err != nil {
+		return nil, err
+	}
+	if offset > len(bodies) {
+		offset = len(bodies)
+	}
+	bodies = bodies[offset:]
+	if limit > 0 && len(bodies) > limit {
+		bodies = bodies[:limit]
+		next := *r.URL
+		q := next.Query()
+		q.Set("_token", base64.URLEncoding.EncodeToString([]byte(strconv.Itoa(offset+limit))))
+		next.RawQuery = q.Encode()
+		next.Scheme, next.Host = scheme(r), r.Host
+		resp.header.Set("Next-Page", next.String())
+	}
+	if fields := query.Get("_fields"); fields != "" {
+		for i, body := range bodies {
+			bodies[i] = project(body, strings.Split(fields, ","))
+		}
+	}
+	resp.body = map[string]interface{}{"data": bodies}
+	return resp, nil
+}
+
+// limit returns the page size of a listing, which is the lesser of _limit and Config.PaginateBy. Zero means no limit.
+func (s *Server) limit(param string) (int, error) {
+	limit := s.config.PaginateBy
+	if param == "" {
+		return limit, nil
+	}
+	requested, err := strconv.Atoi(param)
+	if err != nil || requested < 0 {
+		return 0, newError(http.StatusBadRequest, errnoInvalidParameters, "_limit must be a non-negative integer, got %q", param)
+	}
+	if limit == 0 || requested < limit {
+		limit = requested
+	}
+	return limit, nil
+}
+
+// The _token of a page is simply the offset of its first object. Unlike Kinto's, it is
+// therefore not stable across changes made while paginating.
+func parseToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	b, err := base64.URLEncoding.DecodeString(token)
+	if err == nil {
+		var offset int
+		if offset, err = strconv.Atoi(string(b)); err == nil && offset >= 0 {
+			return offset, nil
+		}
+	}
+	return 0, newError(http.StatusBadRequest, errnoInvalidParameters, "_token is invalid: %q", token)
+}
+
+// project reduces the given body to its ID, last_modified, and the given fields.
+func project(body map[string]interface{}, fields []string) map[string]interface{} {
+	projected := map[string]interface{}{"id": body["id"], "last_modified": body["last_modified"]}
+	for _, field := range fields {
+		root := strings.SplitN(field, ".", 2)[0]
+		if value, ok := body[root]; ok {
+			projected[root] = value
+		}
+	}
+	return projected
+}
+
+type operator string
+
+const (
+	eq      operator = ""
+	not     operator = "not_"
+	in      operator = "in_"
+	exclude operator = "exclude_"
+	gt      operator = "gt_"
+	lt      operator = "lt_"
+	min     operator = "min_"
+	max     operator = "max_"
+	like    operator = "like_"
+	has     operator = "has_"
+)
+
+// The operators with prefixes, in the order in which they are matched (exclude_ before eq, and so on).
+var operators = []operator{not, in, exclude, gt, lt, min, max, like, has}
+
+type filter struct {
+	field    string
+	operator operator
+	values   []interface{}
+}
+
+type filters []*filter
+
+func parseFilters(query url.Values) (filters, error) {
+	parsed := make(filters, 0)
+	for key, values := range query {
+		value := values[len(values)-1]
+		switch key {
+		case "_since":
+			parsed = append(parsed, &filter{field: "last_modified", operator: gt, values: []interface{}{literal(strings.Trim(value, `"`))}})
+			continue
+		case "_before":
+			parsed = append(parsed, &filter{field: "last_modified", operator: lt, values: []interface{}{literal(strings.Trim(value, `"`))}})
+			continue
+		}
+		if strings.HasPrefix(key, "_") {
+			// _sort, _limit, _token, _fields, and anything else that is not a filter (E.G. _expected).
+			continue
+		}
+		f := &filter{field: key, operator: eq}
+		for _, op := range operators {
+			if strings.HasPrefix(key, string(op)) {
+				f.field, f.operator = strings.TrimPrefix(key, string(op)), op
+				break
+			}
+		}
+		switch f.operator {
+		case in, exclude:
+			for _, v := range strings.Split(value, ",") {
+				f.values = append(f.values, literal(v))
+			}
+		case has:
+			present, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, newError(http.StatusBadRequest, errnoInvalidParameters, "%s must be a boolean, got %q", key, value)
+			}
+			f.values = []interface{}{present}
+		default:
+			f.values = []interface{}{literal(value)}
+		}
+		parsed = append(parsed, f)
+	}
+	return parsed, nil
+}
+
+func (fs filters) match(body map[string]interface{}) bool {
+	for _, f := range fs {
+		if !f.match(body) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *filter) match(body map[string]interface{}) bool {
+	value, ok := lookup(body, f.field)
+	switch f.operator {
+	case has:
+		return ok == f.values[0].(bool)
+	case not:
+		return !ok || !equal(value, f.values[0])
+	case exclude:
+		for _, v := range f.values {
+			if ok && equal(value, v) {
+				return false
+			}
+		}
+		return true
+	}
+	if !ok {
+		return false
+	}
+	switch f.operator {
+	case eq:
+		return equal(value, f.values[0])
+	case in:
+		for _, v := range f.values {
+			if equal(value, v) {
+				return true
+			}
+		}
+		return false
+	case gt:
+		return compare(value, f.values[0]) > 0
+	case lt:
+		return compare(value, f.values[0]) < 0
+	case min:
+		return compare(value, f.values[0]) >= 0
+	case max:
+		return compare(value, f.values[0]) <= 0
+	case like:
+		return likePattern(fmt.Sprint(f.values[0])).MatchString(fmt.Sprint(value))
+	}
+	return false
+}
+
+// literal parses the value of a query parameter as JSON (E.G. 42, true, or null), and failing that as a string.
+func literal(value string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return value
+	}
+	return v
+}
+
+// lookup returns the value of the given field, which may be a dotted path (E.G. "details.bug").
+func lookup(body map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = body
+	for _, segment := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[segment]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// normalize converts every kind of number to a float64, so that numbers may be compared regardless of their origin.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case uint64:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+	return value
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// compare orders numbers numerically, and everything else as strings.
+func compare(a, b interface{}) int {
+	a, b = normalize(a), normalize(b)
+	x, xok := a.(float64)
+	y, yok := b.(float64)
+	if xok && yok {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// likePattern matches (case insensitively) any string containing the given pattern, wherein * is a wildcard.
+func likePattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("(?is)" + strings.Join(parts, ".*"))
+}
+
+// sortBodies sorts by the given comma separated fields, each of which is descending if prefixed
+// with a "-". By default, the newest objects are first. Objects lacking a field sort last.
+func sortBodies(bodies []map[string]interface{}, param string) error {
+	if param == "" {
+		param = "-last_modified"
+	}
+	fields := strings.Split(param, ",")
+	for _, field := range fields {
+		if strings.TrimPrefix(field, "-") == "" {
+			return newError(http.StatusBadRequest, errnoInvalidParameters, "_sort is invalid: %q", param)
+		}
+	}
+	sort.SliceStable(bodies, func(i, j int) bool {
+		for _, field := range fields {
+			descending := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			a, aok := lookup(bodies[i], field)
+			b, bok := lookup(bodies[j], field)
+			switch {
+			case !aok && !bok:
+				continue
+			case !aok || !bok:
+				return aok
+			}
+			c := compare(a, b)
+			if descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
@@ -0,0 +1,658 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package local is a Kinto compatible server, backed by SQLite, for the purposes of development and testing.
+// It implements the parts of the Kinto API that kinto.Client uses: the root resource (and therefore
+// try-auth), accounts, buckets, collections, records (including filtering, sorting, pagination, and
+// concurrency control), batches, the Backoff header, and the status transitions of Kinto Signer.
+//
+//	server, err := local.NewServer(":memory:", local.DefaultConfig())
+//	...
+//	s := httptest.NewServer(server)
+//	client, err := kinto.NewClientFromStr(s.URL + local.Base)
+//
+// This server is NOT a substitute for Kinto itself. Amongst other things, it does not sign anything
+// (the status of a collection moves through the Kinto Signer workflow, and records are copied between
+// the source, preview, and destination, but no signature is ever produced), nor does it validate
+// records against the JSON schema of their collection.
+//
+// For details on the Kinto API, please see:
+// https://docs.kinto-storage.org/en/stable/api/
+package local // import "github.com/mozilla/OneCRL-Tools/kinto/local"
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+// Base is the path under which the API is served.
+const Base = "/v1"
+
+// The version of the Kinto API that this server mimics.
+const httpAPIVersion = "1.22"
+
+// Config is the equivalent of Kinto's .ini settings.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/configuration/settings.html
+type Config struct {
+	// The maximum number of requests within a single batch.
+	BatchMaxRequests int
+	// The maximum number of objects returned within a single page. Zero means that listings are never paginated.
+	PaginateBy int
+	// The principals that may create accounts.
+	AccountCreatePrincipals []string
+	// The principals that may modify any account (as opposed to only their own).
+	AccountWritePrincipals []string
+	// The principals that may create buckets.
+	BucketCreatePrincipals []string
+	// The resources of Kinto Signer, and whether reviews are enabled. Nil disables the plugin.
+	Signer *kintosigner.Capability
+}
+
+// DefaultConfig returns the same configuration as that of the Docker based Kinto found within kinto/local/config.
+func DefaultConfig() *Config {
+	return &Config{
+		BatchMaxRequests:        25,
+		AccountCreatePrincipals: []string{everyone},
+		AccountWritePrincipals:  []string{"account:admin"},
+		BucketCreatePrincipals:  []string{"account:admin"},
+		Signer: &kintosigner.Capability{
+			Resources: []*kintosigner.Resource{{
+				Source:      kintosigner.Location{Bucket: "to_sign"},
+				Destination: kintosigner.Location{Bucket: "signed"},
+			}},
+		},
+	}
+}
+
+const (
+	everyone      = "system.Everyone"
+	authenticated = "system.Authenticated"
+)
+
+// Server is a Kinto compatible http.Handler. Requests are served one at a time.
+type Server struct {
+	config  *Config
+	store   *storage
+	backoff time.Duration
+	lock    sync.Mutex
+}
+
+// NewServer opens (or creates) the SQLite database at the given path, which may
+// be ":memory:" for a database that lasts only as long as the server.
+func NewServer(path string, config *Config) (*Server, error) {
+	store, err := openStorage(path)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Server{config: config, store: store}, nil
+}
+
+// Close closes the server's database.
+func (s *Server) Close() error {
+	return s.store.close()
+}
+
+// SetBackoff asks clients to back off for the given duration (rounded to seconds) via
+// the Backoff header of every response. A duration of zero stops asking them to.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/backoff.html
+func (s *Server) SetBackoff(backoff time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.backoff = backoff
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	resp, err := s.serve(r)
+	if err != nil {
+		resp = errorResponse(err)
+	}
+	if s.backoff > 0 {
+		resp.header.Set("Backoff", strconv.Itoa(int(s.backoff.Seconds())))
+	}
+	for key, values := range resp.header {
+		w.Header()[key] = values
+	}
+	if resp.body == nil {
+		w.WriteHeader(resp.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	_ = json.NewEncoder(w).Encode(resp.body)
+}
+
+// A request is an incoming request along with who made it and its decoded body.
+type request struct {
+	*http.Request
+	// The principal of the authenticated account, if any (E.G. "account:admin").
+	user       string
+	principals []string
+	// The body, and its "data" and "permissions" (if any).
+	raw         []byte
+	data        map[string]interface{}
+	permissions map[string][]string
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   interface{}
+}
+
+func respond(status int, body interface{}) *response {
+	return &response{status: status, header: http.Header{}, body: body}
+}
+
+// kintoError is an error response of the same shape as those of Kinto.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/errors.html
+type kintoError struct {
+	Code    int    `json:"code"`
+	Errno   int    `json:"errno"`
+	Err     string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *kintoError) Error() string {
+	return e.Message
+}
+
+// Kinto's errno values (see the Errno constants of the kinto package).
+const (
+	errnoMissingAuthToken  = 104
+	errnoBadJSON           = 106
+	errnoInvalidParameters = 107
+	errnoInvalidPostedData = 109
+	errnoMissingResource   = 111
+	errnoModifiedMeanwhile = 114
+	errnoMethodNotAllowed  = 115
+	errnoForbidden         = 121
+	errnoUndefined         = 999
+)
+
+func newError(code, errno int, format string, args ...interface{}) *kintoError {
+	return &kintoError{Code: code, Errno: errno, Err: http.StatusText(code), Message: fmt.Sprintf(format, args...)}
+}
+
+func errorResponse(err error) *response {
+	e, ok := err.(*kintoError)
+	if !ok {
+		e = newError(http.StatusInternalServerError, errnoUndefined, "%v", err)
+	}
+	return respond(e.Code, e)
+}
+
+func (s *Server) serve(r *http.Request) (*response, error) {
+	if r.URL.Path != Base && !strings.HasPrefix(r.URL.Path, Base+"/") {
+		return nil, newError(http.StatusNotFound, errnoMissingResource, "%s is not served", r.URL.Path)
+	}
+	req, err := s.newRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.route(req)
+}
+
+func (s *Server) newRequest(r *http.Request) (*request, error) {
+	req := &request{Request: r, principals: []string{everyone}}
+	if username, password, ok := r.BasicAuth(); ok {
+		// As with Kinto, bad credentials make for an anonymous request rather than a rejected one.
+		a, err := s.store.get("", account, username)
+		if err != nil {
+			return nil, err
+		}
+		if a != nil && a.data["password"] == hash(password) {
+			req.user = "account:" + username
+			req.principals = append(req.principals, authenticated, req.user)
+		}
+	}
+	if r.Body == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodDelete {
+		return req, nil
+	}
+	body := struct {
+		Data        map[string]interface{} `json:"data"`
+		Permissions map[string][]string    `json:"permissions"`
+	}{}
+	b := new(bytes.Buffer)
+	if _, err := b.ReadFrom(r.Body); err != nil {
+		return nil, err
+	}
+	req.raw = b.Bytes()
+	if b.Len() > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(req.raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			return nil, newError(http.StatusBadRequest, errnoBadJSON, "Invalid JSON: %v", err)
+		}
+	}
+	req.data, req.permissions = body.Data, body.Permissions
+	return req, nil
+}
+
+// route dispatches the request according to its path, which is one of...
+//
+//	/
+//	/batch
+//	/accounts/{id}
+//	/buckets[/{id}]
+//	/buckets/{id}/collections[/{id}]
+//	/buckets/{id}/collections/{id}/records[/{id}]
+func (s *Server) route(r *request) (*response, error) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, Base), "/")
+	segments := make([]string, 0)
+	if path != "" {
+		segments = strings.Split(path, "/")
+	}
+	switch {
+	case len(segments) == 0:
+		return s.root(r)
+	case len(segments) == 1 && segments[0] == "batch":
+		return s.batch(r)
+	case len(segments) == 2 && segments[0] == "accounts":
+		return s.account(r, segments[1])
+	case segments[0] != "buckets":
+		break
+	case len(segments) == 1:
+		return s.plural(r, nil, bucket)
+	case len(segments) == 2:
+		return s.single(r, nil, bucket, segments[1])
+	case segments[2] != "collections":
+		break
+	case len(segments) == 3 || len(segments) == 4:
+		chain, err := s.chain(segments[1])
+		if err != nil {
+			return nil, err
+		}
+		if len(segments) == 3 {
+			return s.plural(r, chain, collection)
+		}
+		return s.single(r, chain, collection, segments[3])
+	case segments[4] != "records":
+		break
+	case len(segments) == 5 || len(segments) == 6:
+		chain, err := s.chain(segments[1], segments[3])
+		if err != nil {
+			return nil, err
+		}
+		if len(segments) == 5 {
+			return s.plural(r, chain, record)
+		}
+		return s.single(r, chain, record, segments[5])
+	}
+	return nil, newError(http.StatusNotFound, errnoMissingResource, "%s is not served", r.URL.Path)
+}
+
+// chain loads the bucket of the given ID and, if given, the collection of the given ID within it.
+func (s *Server) chain(bucketID string, collectionID ...string) ([]*object, error) {
+	b, err := s.store.get("", bucket, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, newError(http.StatusNotFound, errnoMissingResource, "bucket %q does not exist", bucketID)
+	}
+	chain := []*object{b}
+	for _, id := range collectionID {
+		c, err := s.store.get(b.uri(), collection, id)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			return nil, newError(http.StatusNotFound, errnoMissingResource, "collection %q does not exist within bucket %q", id, bucketID)
+		}
+		chain = append(chain, c)
+	}
+	return chain, nil
+}
+
+func (s *Server) root(r *request) (*response, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return nil, methodNotAllowed(r)
+	}
+	capabilities := map[string]interface{}{
+		"accounts": map[string]interface{}{
+			"description": "Manage user accounts.",
+			"url":         "https://kinto.readthedocs.io/en/latest/api/1.x/accounts.html",
+		},
+	}
+	if s.config.Signer != nil {
+		capabilities["signer"] = s.config.Signer
+	}
+	root := map[string]interface{}{
+		"project_name":     "kinto-local",
+		"project_version":  "0.0.0",
+		"project_docs":     "https://docs.kinto-storage.org/",
+		"http_api_version": httpAPIVersion,
+		"url":              fmt.Sprintf("%s://%s%s/", scheme(r), r.Host, Base),
+		"settings": map[string]interface{}{
+			"batch_max_requests":      s.config.BatchMaxRequests,
+			"readonly":                false,
+			"explicit_permissions":    true,
+			"trailing_slash_redirect": false,
+		},
+		"capabilities": capabilities,
+	}
+	if r.user != "" {
+		root["user"] = map[string]interface{}{"id": r.user, "principals": r.principals}
+	}
+	return respond(http.StatusOK, root), nil
+}
+
+// account creates (or changes the password of) the account of the given ID.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/accounts.html
+func (s *Server) account(r *request, id string) (*response, error) {
+	existing, err := s.store.get("", account, id)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+		if existing == nil || !(r.user == "account:"+id || intersects(r.principals, s.config.AccountWritePrincipals)) {
+			return nil, forbidden(r)
+		}
+		if r.Method == http.MethodDelete {
+			if err := s.store.delete(existing); err != nil {
+				return nil, err
+			}
+		}
+		return respond(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"id": id, "last_modified": existing.lastModified}}), nil
+	case http.MethodPut:
+	default:
+		return nil, methodNotAllowed(r)
+	}
+	password, _ := r.data["password"].(string)
+	if password == "" {
+		return nil, newError(http.StatusBadRequest, errnoInvalidPostedData, "data.password is required")
+	}
+	status := http.StatusOK
+	switch {
+	case existing == nil && intersects(r.principals, s.config.AccountCreatePrincipals):
+		status = http.StatusCreated
+		existing = &object{kind: account, id: id, permissions: map[string][]string{"write": {"account:" + id}}}
+	case existing == nil:
+		return nil, forbidden(r)
+	case r.user != "account:"+id && !intersects(r.principals, s.config.AccountWritePrincipals):
+		return nil, forbidden(r)
+	}
+	existing.data = map[string]interface{}{"password": hash(password)}
+	if err := s.store.put(existing); err != nil {
+		return nil, err
+	}
+	// Unlike Kinto, the (hashed) password is not echoed back.
+	return respond(status, map[string]interface{}{"data": map[string]interface{}{"id": id, "last_modified": existing.lastModified}}), nil
+}
+
+// plural serves the listing of (GET and HEAD), and creation of (POST), objects of the given kind
+// within the last object of the given chain (which is nil for buckets).
+func (s *Server) plural(r *request, chain []*object, kind string) (*response, error) {
+	parent := ""
+	if len(chain) > 0 {
+		parent = chain[len(chain)-1].uri()
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return s.list(r, chain, parent, kind)
+	case http.MethodPost:
+		id, _ := r.data["id"].(string)
+		if id == "" {
+			id = uuid()
+		}
+		return s.create(r, chain, parent, kind, id)
+	default:
+		return nil, methodNotAllowed(r)
+	}
+}
+
+// single serves the retrieval (GET), replacement (PUT), modification (PATCH), and
+// deletion (DELETE) of the object of the given kind and ID.
+func (s *Server) single(r *request, chain []*object, kind, id string) (*response, error) {
+	parent := ""
+	if len(chain) > 0 {
+		parent = chain[len(chain)-1].uri()
+	}
+	existing, err := s.store.get(parent, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := precondition(r, existing); err != nil {
+		return nil, err
+	}
+	if r.Method == http.MethodPut && existing == nil {
+		return s.create(r, chain, parent, kind, id)
+	}
+	if existing == nil {
+		if !s.allowed(r, "read", chain) {
+			return nil, forbidden(r)
+		}
+		return nil, newError(http.StatusNotFound, errnoMissingResource, "%s %q does not exist", kind, id)
+	}
+	full := append(append([]*object{}, chain...), existing)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !s.allowed(r, "read", full) {
+			return nil, forbidden(r)
+		}
+		resp := objectResponse(http.StatusOK, existing)
+		if r.Header.Get("If-None-Match") == etag(existing.lastModified) {
+			resp.status, resp.body = http.StatusNotModified, nil
+		}
+		return resp, nil
+	case http.MethodPut, http.MethodPatch:
+		if !s.allowed(r, "write", full) {
+			return nil, forbidden(r)
+		}
+		if id, ok := r.data["id"].(string); ok && id != existing.id {
+			return nil, newError(http.StatusBadRequest, errnoInvalidPostedData, "data.id does not match %q", existing.id)
+		}
+		if kind == collection {
+			if err := s.review(r, chain[0], existing); err != nil {
+				return nil, err
+			}
+		}
+		if r.Method == http.MethodPut {
+			existing.data = make(map[string]interface{})
+		}
+		for k, v := range r.data {
+			existing.data[k] = v
+		}
+		for perm, principals := range r.permissions {
+			existing.permissions[perm] = principals
+		}
+		if err := s.store.put(existing); err != nil {
+			return nil, err
+		}
+		if kind == record {
+			if err := s.edited(r, chain[0].id, chain[1]); err != nil {
+				return nil, err
+			}
+		}
+		return objectResponse(http.StatusOK, existing), nil
+	case http.MethodDelete:
+		if !s.allowed(r, "write", full) {
+			return nil, forbidden(r)
+		}
+		if err := s.store.delete(existing); err != nil {
+			return nil, err
+		}
+		if kind == record {
+			if err := s.edited(r, chain[0].id, chain[1]); err != nil {
+				return nil, err
+			}
+		}
+		return respond(http.StatusOK, map[string]interface{}{"data": existing.body()}), nil
+	default:
+		return nil, methodNotAllowed(r)
+	}
+}
+
+// create creates the object of the given kind and ID. As with Kinto, the creation of an object
+// that already exists is answered with the existing object, so long as it was not conditioned
+// (via If-None-Match: *) upon the object not existing.
+func (s *Server) create(r *request, chain []*object, parent, kind, id string) (*response, error) {
+	existing, err := s.store.get(parent, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if err := precondition(r, existing); err != nil {
+			return nil, err
+		}
+		if r.Method == http.MethodPut {
+			return s.single(r, chain, kind, id)
+		}
+		if !s.allowed(r, "read", append(append([]*object{}, chain...), existing)) {
+			return nil, forbidden(r)
+		}
+		return objectResponse(http.StatusOK, existing), nil
+	}
+	if r.Header.Get("If-Match") != "" {
+		return nil, newError(http.StatusPreconditionFailed, errnoModifiedMeanwhile, "Resource was modified meanwhile")
+	}
+	var permitted bool
+	if kind == bucket {
+		permitted = intersects(r.principals, s.config.BucketCreatePrincipals)
+	} else {
+		permitted = s.allowed(r, kind+":create", chain)
+	}
+	if !permitted {
+		return nil, forbidden(r)
+	}
+	o := &object{parent: parent, kind: kind, id: id, data: r.data, permissions: r.permissions}
+	if o.permissions == nil {
+		o.permissions = make(map[string][]string)
+	}
+	if r.user != "" && !contains(o.permissions["write"], r.user) {
+		// As with Kinto, the creator of an object may always write to it.
+		o.permissions["write"] = append(o.permissions["write"], r.user)
+	}
+	if err := s.store.put(o); err != nil {
+		return nil, err
+	}
+	if kind == collection {
+		// The listing of an empty collection has the timestamp of its creation.
+		if err := s.store.touch(o.uri(), record, o.lastModified); err != nil {
+			return nil, err
+		}
+	}
+	if kind == record {
+		if err := s.edited(r, chain[0].id, chain[1]); err != nil {
+			return nil, err
+		}
+	}
+	return objectResponse(http.StatusCreated, o), nil
+}
+
+// allowed returns whether the request may exercise the given permission upon the last object of
+// the given chain. Write permission upon any object of the chain implies every permission upon
+// every object beneath it, as does read permission for reading.
+func (s *Server) allowed(r *request, permission string, chain []*object) bool {
+	for _, o := range chain {
+		if intersects(r.principals, o.permissions["write"]) || intersects(r.principals, o.permissions[permission]) {
+			return true
+		}
+	}
+	return false
+}
+
+// precondition checks the If-Match and If-None-Match headers of a write against the existing object (if any).
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/records.html#concurrency-control
+func precondition(r *request, existing *object) error {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return nil
+	}
+	match, noneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	switch {
+	case match != "" && (existing == nil || match != etag(existing.lastModified)):
+		return newError(http.StatusPreconditionFailed, errnoModifiedMeanwhile, "Resource was modified meanwhile")
+	case noneMatch == "*" && existing != nil:
+		return newError(http.StatusPreconditionFailed, errnoModifiedMeanwhile, "Resource was modified meanwhile")
+	}
+	return nil
+}
+
+func objectResponse(status int, o *object) *response {
+	resp := respond(status, map[string]interface{}{"data": o.body(), "permissions": o.permissions})
+	resp.header.Set("ETag", etag(o.lastModified))
+	return resp
+}
+
+func forbidden(r *request) error {
+	if r.user == "" {
+		return newError(http.StatusUnauthorized, errnoMissingAuthToken, "Please authenticate yourself to use this endpoint.")
+	}
+	return newError(http.StatusForbidden, errnoForbidden, "This user cannot access this resource.")
+}
+
+func methodNotAllowed(r *request) error {
+	return newError(http.StatusMethodNotAllowed, errnoMethodNotAllowed, "Method not allowed on this endpoint: %s", r.Method)
+}
+
+func etag(timestamp uint64) string {
+	return fmt.Sprintf(`"%d"`, timestamp)
+}
+
+func scheme(r *request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// hash is how passwords are stored. This is a development server, so they are not salted.
+func hash(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func uuid() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		if contains(b, x) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,333 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package local_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto"
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/auth"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/authz"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/batch"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/query"
+	"github.com/mozilla/OneCRL-Tools/kinto/local"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+type Lego struct {
+	Name   string `json:"name"`
+	Pieces int    `json:"pieces,omitempty"`
+	*api.Record
+}
+
+type LegoSets struct {
+	*collections.Collection `json:"-"`
+	Data                    []Lego `json:"data"`
+}
+
+func legos(bucket, collection string) *LegoSets {
+	return &LegoSets{Collection: collections.NewCollection(buckets.NewBucket(bucket), collection)}
+}
+
+var (
+	admin  = &auth.User{Username: "admin", Password: "password"}
+	editor = &auth.User{Username: "editor", Password: "password"}
+	rw     = &authz.Permissions{
+		Read:  []string{"account:editor"},
+		Write: []string{"account:editor"},
+	}
+)
+
+// serve serves a fresh server with the given configuration, with an admin account and an editor account
+// that may write to the "legos" bucket. The server's URL is returned, along with a client authenticated as the admin.
+func serve(t *testing.T, config *local.Config) (*local.Server, string, *kinto.Client) {
+	t.Helper()
+	server, err := local.NewServer(":memory:", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(server)
+	t.Cleanup(func() {
+		s.Close()
+		_ = server.Close()
+	})
+	client := as(s.URL+local.Base, nil)
+	if err := client.NewAdmin(admin.Password); err != nil {
+		t.Fatal(err)
+	}
+	client.WithAuthenticator(admin)
+	if err := client.NewAccount(editor); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.NewBucketWithPermissions(buckets.NewBucket("legos"), rw); err != nil {
+		t.Fatal(err)
+	}
+	return server, s.URL + local.Base, client
+}
+
+// as returns a client of the given server that is authenticated as the given user (or anonymous, if nil).
+func as(url string, user auth.Authenticator) *kinto.Client {
+	client, _ := kinto.NewClientFromStr(url)
+	if user == nil {
+		user = &auth.Unauthenticated{}
+	}
+	return client.WithRetryPolicy(kinto.NoRetries()).WithAuthenticator(user)
+}
+
+func TestTryAuth(t *testing.T) {
+	_, url, _ := serve(t, nil)
+	for _, test := range []struct {
+		user   auth.Authenticator
+		authed bool
+	}{
+		{admin, true},
+		{editor, true},
+		{&auth.User{Username: "editor", Password: "nope"}, false},
+		{&auth.Unauthenticated{}, false},
+	} {
+		authed, err := as(url, test.user).TryAuth()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authed != test.authed {
+			t.Errorf("expected authenticated to be %v for %v, got %v", test.authed, test.user, authed)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	_, url, _ := serve(t, nil)
+	sets := legos("legos", "sets")
+	if err := as(url, editor).NewBucket(buckets.NewBucket("mine")); !kinto.IsForbidden(err) {
+		t.Errorf("expected the editor to be forbidden from creating buckets, got %v", err)
+	}
+	if err := as(url, &auth.Unauthenticated{}).NewCollection(sets.Collection); !kinto.IsUnauthorized(err) {
+		t.Errorf("expected anonymous users to be unauthorized, got %v", err)
+	}
+	if err := as(url, editor).NewCollection(sets.Collection); err != nil {
+		t.Fatal(err)
+	}
+	if err := as(url, editor).NewRecord(sets, &Lego{Name: "Millennium Falcon"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	config := local.DefaultConfig()
+	config.PaginateBy = 2
+	_, _, client := serve(t, config)
+	sets := legos("legos", "sets")
+	if err := client.NewCollection(sets.Collection); err != nil {
+		t.Fatal(err)
+	}
+	all := []*Lego{{Name: "Millennium Falcon", Pieces: 7541}, {Name: "Death Star", Pieces: 4016}, {Name: "Ewok Village", Pieces: 1990}}
+	for _, lego := range all {
+		if err := client.NewRecord(sets, lego); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.AllRecords(sets); err != nil {
+		t.Fatal(err)
+	}
+	if len(sets.Data) != 3 || sets.Data[0].Name != "Ewok Village" {
+		t.Fatalf("expected every record across pages, newest first, got %v", sets.Data)
+	}
+	big := legos("legos", "sets")
+	if err := client.AllRecords(query.New(big).Gt("pieces", 2000).Sort("name")); err != nil {
+		t.Fatal(err)
+	}
+	if len(big.Data) != 2 || big.Data[0].Name != "Death Star" {
+		t.Errorf("expected the two big sets sorted by name, got %v", big.Data)
+	}
+	count, err := client.CountRecords(query.New(sets).Like("name", "*star*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected one record to be like star, got %d", count)
+	}
+
+	stale := *all[0].Record
+	all[0].Pieces = 7500
+	if err := client.UpdateRecordIfUnmodified(sets, all[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteIfUnmodified(sets, &Lego{Record: &stale}); !errors.Is(err, kinto.ErrConflict) {
+		t.Errorf("expected deleting a stale record to conflict, got %v", err)
+	}
+	if err := client.NewRecordIfAbsent(sets, &Lego{Name: "again", Record: &api.Record{Id: all[1].ID()}}); !errors.Is(err, kinto.ErrConflict) {
+		t.Errorf("expected creating an existing record to conflict, got %v", err)
+	}
+	if _, err := client.Delete(sets, all[2]); err != nil {
+		t.Fatal(err)
+	}
+	changeset, err := client.SyncRecords(sets, all[0].LastModified-1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changeset.Changed) != 1 || len(changeset.Deleted) != 1 || changeset.Deleted[0] != all[2].ID() {
+		t.Errorf("expected one change and one deletion, got %v", changeset)
+	}
+	changeset, err = client.SyncRecords(sets, changeset.Timestamp, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changeset.NotModified {
+		t.Errorf("expected nothing to have changed, got %v", changeset)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	config := local.DefaultConfig()
+	config.BatchMaxRequests = 2
+	_, _, client := serve(t, config)
+	sets := legos("legos", "sets")
+	if err := client.NewCollection(sets.Collection); err != nil {
+		t.Fatal(err)
+	}
+	b := batch.NewBuilder().
+		Create(sets, &Lego{Name: "Death Star"}, nil).
+		Create(sets, &Lego{Name: "Ewok Village"}, nil).
+		Update(sets, &Lego{Name: "nope", Record: &api.Record{Id: "missing"}}, nil)
+	resp, err := client.BatchAll(b)
+	var batchErr *kinto.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected the update of a missing record to fail, got %v", err)
+	}
+	if len(resp.Responses) != 3 || len(resp.Succeeded()) != 2 || resp.Responses[2].Status != http.StatusNotFound {
+		t.Errorf("expected two creations and a 404, got %v", resp.Responses)
+	}
+	if err := client.Batch(&batch.Batch{Requests: make([]batch.BatchedRequest, 3)}); err == nil {
+		t.Error("expected a batch larger than batch_max_requests to be rejected")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	config := local.DefaultConfig()
+	config.Signer = &kintosigner.Capability{
+		ToReviewEnabled: true,
+		Resources: []*kintosigner.Resource{{
+			Source:      kintosigner.Location{Bucket: "legos"},
+			Preview:     &kintosigner.Location{Bucket: "legos-preview"},
+			Destination: kintosigner.Location{Bucket: "legos-published"},
+		}},
+	}
+	_, url, client := serve(t, config)
+	sets := legos("legos", "sets")
+	if err := client.NewCollection(sets.Collection); err != nil {
+		t.Fatal(err)
+	}
+	e := as(url, editor)
+	if err := e.NewRecord(sets, &Lego{Name: "Death Star"}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := e.SignerStatusFor(sets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Data.Status != kintosigner.StatusWorkInProgress || status.Data.LastEditBy != "account:editor" {
+		t.Fatalf("expected the edit to put the collection into work-in-progress, got %v", status.Data)
+	}
+	if err := e.ToSign(sets); err == nil {
+		t.Fatal("expected signing a collection that is not in review to fail")
+	}
+	if err := e.ToReviewWithComment(sets, "please"); err != nil {
+		t.Fatal(err)
+	}
+	preview := legos("legos-preview", "sets")
+	if err := e.AllRecords(preview); err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Data) != 1 {
+		t.Errorf("expected the preview to hold the change under review, got %v", preview.Data)
+	}
+	if err := e.ToSign(sets); !kinto.IsForbidden(err) {
+		t.Fatalf("expected the editor to be forbidden from approving their own review, got %v", err)
+	}
+	if err := client.ToSign(sets); err != nil {
+		t.Fatal(err)
+	}
+	published := legos("legos-published", "sets")
+	if err := as(url, &auth.Unauthenticated{}).AllRecords(published); err != nil {
+		t.Fatal(err)
+	}
+	if len(published.Data) != 1 || published.Data[0].Name != "Death Star" {
+		t.Errorf("expected the destination to be published, got %v", published.Data)
+	}
+	status, err = e.SignerStatusFor(sets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Data.Status != kintosigner.StatusSigned || status.Data.LastReviewBy != "account:admin" || status.Data.LastEditorComment != "please" {
+		t.Errorf("expected the collection to be signed by the admin, got %v", status.Data)
+	}
+
+	if err := e.NewRecord(sets, &Lego{Name: "Ewok Village"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ToRollBack(sets); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AllRecords(sets); err != nil {
+		t.Fatal(err)
+	}
+	if len(sets.Data) != 1 {
+		t.Errorf("expected the rollback to discard the unreviewed change, got %v", sets.Data)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	server, url, _ := serve(t, nil)
+	server.SetBackoff(time.Second * 30)
+	resp, err := http.Get(url + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if backoff := resp.Header.Get("Backoff"); backoff != "30" {
+		t.Errorf("expected a Backoff of 30, got %q", backoff)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kinto-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kinto.sqlite")
+	for i := 0; i < 2; i++ {
+		server, err := local.NewServer(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(server)
+		client, _ := kinto.NewClientFromStr(s.URL + local.Base)
+		if i == 0 {
+			err = client.NewAdmin(admin.Password)
+		} else {
+			var authed bool
+			authed, err = client.WithAuthenticator(admin).TryAuth()
+			if err == nil && !authed {
+				t.Error("expected the admin account to survive a restart")
+			}
+		}
+		s.Close()
+		_ = server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package local
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+// source returns the signer resource of the given collection if, and only if, it is the source of that resource.
+func (s *Server) source(bucketID, collectionID string) (*kintosigner.Resource, bool) {
+	if s.config.Signer == nil {
+		return nil, false
+	}
+	resource, ok := s.config.Signer.Resource(bucketID, collectionID)
+	if !ok || resource.Source != (kintosigner.Location{Bucket: bucketID, Collection: collectionID}) {
+		return nil, false
+	}
+	return resource, true
+}
+
+// review performs the Kinto Signer transition requested by a change to the status of a source collection,
+// and records who requested it and when within the (not yet stored) changes of the request.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-signer#workflows
+func (s *Server) review(r *request, b *object, c *object) error {
+	resource, ok := s.source(b.id, c.id)
+	if !ok {
+		return nil
+	}
+	status, ok := r.data["status"].(string)
+	if !ok {
+		return nil
+	}
+	reviews := s.config.Signer.ToReviewEnabled
+	now := date(time.Now())
+	switch status {
+	case kintosigner.StatusWorkInProgress, kintosigner.StatusSigned:
+	case kintosigner.StatusToReview:
+		if resource.Preview != nil {
+			if err := s.copy(resource.Source, *resource.Preview); err != nil {
+				return err
+			}
+		}
+		r.data["last_review_request_by"] = r.user
+		r.data["last_review_request_date"] = now
+	case kintosigner.StatusToSign:
+		if reviews {
+			if c.data["status"] != kintosigner.StatusToReview {
+				return newError(http.StatusBadRequest, errnoInvalidPostedData, "Collection not under review")
+			}
+			if c.data["last_review_request_by"] == r.user {
+				return newError(http.StatusForbidden, errnoForbidden, "Editor cannot review")
+			}
+			r.data["last_review_by"] = r.user
+			r.data["last_review_date"] = now
+		}
+		if err := s.publish(resource, resource.Source); err != nil {
+			return err
+		}
+		r.data["status"] = kintosigner.StatusSigned
+		r.data["last_signature_by"] = r.user
+		r.data["last_signature_date"] = now
+	case kintosigner.StatusToRollback:
+		if err := s.copy(resource.Destination, resource.Source); err != nil {
+			return err
+		}
+		if resource.Preview != nil {
+			if err := s.copy(resource.Destination, *resource.Preview); err != nil {
+				return err
+			}
+		}
+		r.data["status"] = kintosigner.StatusSigned
+	case kintosigner.StatusToResign:
+		r.data["status"] = kintosigner.StatusSigned
+		r.data["last_signature_by"] = r.user
+		r.data["last_signature_date"] = now
+	default:
+		return newError(http.StatusBadRequest, errnoInvalidPostedData, "Invalid status %q", status)
+	}
+	return nil
+}
+
+// edited marks the given collection as a work in progress if it is the source of a signer
+// resource, as Kinto Signer does upon any change to the records of a source.
+func (s *Server) edited(r *request, bucketID string, c *object) error {
+	if _, ok := s.source(bucketID, c.id); !ok {
+		return nil
+	}
+	c.data["status"] = kintosigner.StatusWorkInProgress
+	c.data["last_edit_by"] = r.user
+	c.data["last_edit_date"] = date(time.Now())
+	return s.store.put(c)
+}
+
+// publish copies the given location to the preview (if any) and destination of the given resource.
+func (s *Server) publish(resource *kintosigner.Resource, from kintosigner.Location) error {
+	if resource.Preview != nil {
+		if err := s.copy(from, *resource.Preview); err != nil {
+			return err
+		}
+	}
+	return s.copy(from, resource.Destination)
+}
+
+// copy makes the records of the destination the same as those of the source, creating the destination
+// (and its bucket) if need be. As with Kinto Signer, the destination is readable by everyone.
+func (s *Server) copy(from, to kintosigner.Location) error {
+	parent := ""
+	for _, o := range []*object{{kind: bucket, id: to.Bucket}, {parent: "/buckets/" + to.Bucket, kind: collection, id: to.Collection}} {
+		existing, err := s.store.get(o.parent, o.kind, o.id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			o.permissions = map[string][]string{"read": {everyone}}
+			if err := s.store.put(o); err != nil {
+				return err
+			}
+			existing = o
+		}
+		parent = existing.uri()
+	}
+	source, err := s.store.list("/buckets/"+from.Bucket+"/collections/"+from.Collection, record, false)
+	if err != nil {
+		return err
+	}
+	destination, err := s.store.list(parent, record, false)
+	if err != nil {
+		return err
+	}
+	stale := make(map[string]*object, len(destination))
+	for _, o := range destination {
+		stale[o.id] = o
+	}
+	for _, o := range source {
+		existing, ok := stale[o.id]
+		delete(stale, o.id)
+		if ok && reflect.DeepEqual(existing.data, o.data) {
+			continue
+		}
+		if err := s.store.put(&object{parent: parent, kind: record, id: o.id, data: o.data, permissions: o.permissions}); err != nil {
+			return err
+		}
+	}
+	for _, o := range stale {
+		if err := s.store.delete(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// date formats the given time as Kinto Signer does (E.G. "2020-11-04T17:53:36.781932+00:00").
+func date(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000+00:00")
+}
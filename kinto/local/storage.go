@@ -0,0 +1,245 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package local
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The kinds of objects that are stored.
+const (
+	account    = "account"
+	bucket     = "bucket"
+	collection = "collection"
+	record     = "record"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS objects (
+	parent        TEXT    NOT NULL,
+	kind          TEXT    NOT NULL,
+	id            TEXT    NOT NULL,
+	last_modified INTEGER NOT NULL,
+	deleted       INTEGER NOT NULL DEFAULT 0,
+	data          TEXT    NOT NULL,
+	permissions   TEXT    NOT NULL DEFAULT '{}',
+	PRIMARY KEY (parent, kind, id)
+);
+CREATE TABLE IF NOT EXISTS timestamps (
+	parent        TEXT    NOT NULL,
+	kind          TEXT    NOT NULL,
+	last_modified INTEGER NOT NULL,
+	PRIMARY KEY (parent, kind)
+);`
+
+// An object is any stored resource (E.G. a bucket, or a record). Its parent is the URI of the
+// resource that it belongs to (E.G. "/buckets/security-state/collections/onecrl" for a record
+// of OneCRL), which is empty for buckets and accounts.
+type object struct {
+	parent       string
+	kind         string
+	id           string
+	lastModified uint64
+	deleted      bool
+	data         map[string]interface{}
+	permissions  map[string][]string
+}
+
+// uri returns the URI of the object (E.G. "/buckets/security-state").
+func (o *object) uri() string {
+	switch o.kind {
+	case account:
+		return "/accounts/" + o.id
+	case bucket:
+		return "/buckets/" + o.id
+	case collection:
+		return o.parent + "/collections/" + o.id
+	default:
+		return o.parent + "/records/" + o.id
+	}
+}
+
+// body returns the object's data as Kinto serves it, which is with its ID and last_modified.
+func (o *object) body() map[string]interface{} {
+	if o.deleted {
+		return map[string]interface{}{"id": o.id, "last_modified": o.lastModified, "deleted": true}
+	}
+	body := make(map[string]interface{}, len(o.data)+2)
+	for k, v := range o.data {
+		body[k] = v
+	}
+	body["id"] = o.id
+	body["last_modified"] = o.lastModified
+	return body
+}
+
+// storage persists objects to SQLite. It is not safe for concurrent use, as Server serializes every request.
+type storage struct {
+	db *sql.DB
+	// Returns the current time, for the assignment of timestamps.
+	now func() time.Time
+}
+
+func openStorage(path string) (*storage, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to an in-memory database is a database of its own.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &storage{db: db, now: time.Now}, nil
+}
+
+func (s *storage) close() error {
+	return s.db.Close()
+}
+
+// get returns the object of the given ID, or nil if it does not exist (or was deleted).
+func (s *storage) get(parent, kind, id string) (*object, error) {
+	row := s.db.QueryRow(`SELECT last_modified, deleted, data, permissions FROM objects WHERE parent = ? AND kind = ? AND id = ?`, parent, kind, id)
+	o, err := scan(parent, kind, id, row)
+	if err == sql.ErrNoRows || (err == nil && o.deleted) {
+		return nil, nil
+	}
+	return o, err
+}
+
+// list returns every object of the given kind within the given parent, including tombstones if asked for.
+func (s *storage) list(parent, kind string, tombstones bool) ([]*object, error) {
+	rows, err := s.db.Query(`SELECT id, last_modified, deleted, data, permissions FROM objects WHERE parent = ? AND kind = ? AND (deleted = 0 OR ?) ORDER BY last_modified DESC`, parent, kind, tombstones)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	objects := make([]*object, 0)
+	for rows.Next() {
+		var id string
+		var lastModified uint64
+		var deleted bool
+		var data, permissions []byte
+		if err := rows.Scan(&id, &lastModified, &deleted, &data, &permissions); err != nil {
+			return nil, err
+		}
+		o, err := decode(parent, kind, id, lastModified, deleted, data, permissions)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+// put stores the given object, assigning it a new last_modified.
+func (s *storage) put(o *object) error {
+	timestamp, err := s.bump(o.parent, o.kind)
+	if err != nil {
+		return err
+	}
+	o.lastModified = timestamp
+	if o.data == nil {
+		o.data = make(map[string]interface{})
+	}
+	if o.permissions == nil {
+		o.permissions = make(map[string][]string)
+	}
+	delete(o.data, "id")
+	delete(o.data, "last_modified")
+	data, err := json.Marshal(o.data)
+	if err != nil {
+		return err
+	}
+	permissions, err := json.Marshal(o.permissions)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO objects (parent, kind, id, last_modified, deleted, data, permissions) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		o.parent, o.kind, o.id, o.lastModified, o.deleted, data, permissions)
+	return err
+}
+
+// delete replaces the given object with a tombstone, and removes everything within it.
+func (s *storage) delete(o *object) error {
+	o.deleted = true
+	o.data = map[string]interface{}{}
+	o.permissions = map[string][]string{}
+	if err := s.put(o); err != nil {
+		return err
+	}
+	return s.purge(o.uri())
+}
+
+// purge removes everything within the given URI (E.G. every collection and record within a bucket).
+func (s *storage) purge(uri string) error {
+	if _, err := s.db.Exec(`DELETE FROM objects WHERE parent = ? OR parent LIKE ?`, uri, uri+"/%"); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`DELETE FROM timestamps WHERE parent = ? OR parent LIKE ?`, uri, uri+"/%")
+	return err
+}
+
+// timestamp returns the latest last_modified of every object (tombstones included) of the given kind within the given parent.
+func (s *storage) timestamp(parent, kind string) (uint64, error) {
+	var timestamp uint64
+	err := s.db.QueryRow(`SELECT last_modified FROM timestamps WHERE parent = ? AND kind = ?`, parent, kind).Scan(&timestamp)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return timestamp, err
+}
+
+// touch moves the timestamp of the given kind within the given parent forward to the given timestamp.
+func (s *storage) touch(parent, kind string, timestamp uint64) error {
+	_, err := s.db.Exec(`INSERT INTO timestamps (parent, kind, last_modified) VALUES (?, ?, ?)
+		ON CONFLICT (parent, kind) DO UPDATE SET last_modified = MAX(last_modified, excluded.last_modified)`, parent, kind, timestamp)
+	return err
+}
+
+// bump assigns a new timestamp to the given kind within the given parent. As with Kinto, timestamps
+// are in milliseconds and strictly increase, even if two changes are made within the same millisecond.
+func (s *storage) bump(parent, kind string) (uint64, error) {
+	previous, err := s.timestamp(parent, kind)
+	if err != nil {
+		return 0, err
+	}
+	timestamp := uint64(s.now().UnixNano() / int64(time.Millisecond))
+	if timestamp <= previous {
+		timestamp = previous + 1
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO timestamps (parent, kind, last_modified) VALUES (?, ?, ?)`, parent, kind, timestamp)
+	return timestamp, err
+}
+
+func scan(parent, kind, id string, row *sql.Row) (*object, error) {
+	var lastModified uint64
+	var deleted bool
+	var data, permissions []byte
+	if err := row.Scan(&lastModified, &deleted, &data, &permissions); err != nil {
+		return nil, err
+	}
+	return decode(parent, kind, id, lastModified, deleted, data, permissions)
+}
+
+func decode(parent, kind, id string, lastModified uint64, deleted bool, data, permissions []byte) (*object, error) {
+	o := &object{parent: parent, kind: kind, id: id, lastModified: lastModified, deleted: deleted}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Numbers are kept as they were given, rather than rounded to float64s.
+	decoder.UseNumber()
+	if err := decoder.Decode(&o.data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(permissions, &o.permissions); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
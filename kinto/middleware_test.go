@@ -0,0 +1,72 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/middleware"
+)
+
+func TestMiddlewareSeesRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"settings": {"batch_max_requests": 25}}`))
+	}))
+	defer server.Close()
+	seen := make([]string, 0)
+	c, err := NewClientFromStr(server.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay, policy.MaxDelay = time.Millisecond, time.Millisecond
+	c.WithRetryPolicy(policy).
+		WithHTTPClient(&http.Client{Timeout: time.Second}).
+		WithMiddleware(middleware.Observe(func(r *http.Request, resp *http.Response, err error, _ time.Duration) {
+			seen = append(seen, fmt.Sprintf("%s %d %s", r.URL.Path, resp.StatusCode, r.Header.Get("X-Automated-Tool")))
+		}))
+	max, err := c.BatchMaxRequests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max != 25 {
+		t.Errorf("expected 25, got %d", max)
+	}
+	tool := "https://github.com/mozilla/OneCRL-Tools/kinto"
+	want := []string{"/v1/ 503 " + tool, "/v1/ 200 " + tool}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("expected %v, got %v", want, seen)
+	}
+}
+
+func TestReconfigureWhileInFlight(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"settings": {"batch_max_requests": 25}}`))
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			c.WithTimeout(time.Second).WithMiddleware()
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := c.BatchMaxRequests(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
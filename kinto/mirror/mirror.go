@@ -0,0 +1,206 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package mirror maintains an on-disk copy of a Kinto collection.
+//
+// The first sync of a mirror downloads the entire collection, while every sync thereafter
+// only asks Kinto for what has changed since (which is nothing more than a single 304 if
+// nothing has). The file itself is Kinto's own list envelope, with the addition of the
+// collection's timestamp, so it may be read back into the very same types that are used with
+// kinto.Client.AllRecords (E.G. via Mirror.Unmarshal) or simply inspected by hand.
+//
+//	{
+//	  "timestamp": 1603376223283,
+//	  "data": [...]
+//	}
+package mirror // import "github.com/mozilla/OneCRL-Tools/kinto/mirror"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/mozilla/OneCRL-Tools/kinto"
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+)
+
+// Mirror is an on-disk copy of a single Kinto collection. A Mirror is safe for use by
+// multiple goroutines, however no two Mirrors (nor processes) should share the same file.
+type Mirror struct {
+	client     *kinto.Client
+	collection api.Getter
+	path       string
+	lock       sync.Mutex
+}
+
+// snapshot is the on-disk representation of a mirror.
+type snapshot struct {
+	Timestamp uint64            `json:"timestamp"`
+	Data      []json.RawMessage `json:"data"`
+}
+
+// New constructs a mirror of the given collection, which is stored at the given path.
+//
+// Nothing is read nor written until the first call to either Sync or Unmarshal. If no file
+// exists at the given path, then the first sync creates it.
+func New(client *kinto.Client, collection api.Getter, path string) *Mirror {
+	return &Mirror{
+		client:     client,
+		collection: collection,
+		path:       path,
+	}
+}
+
+// Path returns the location of this mirror on disk.
+func (m *Mirror) Path() string {
+	return m.path
+}
+
+// Sync brings the mirror up to date with Kinto, returning the changes which were applied.
+//
+// The file on disk is atomically replaced, so a failed sync leaves the previous copy intact.
+func (m *Mirror) Sync() (*kinto.Changeset, error) {
+	return m.SyncContext(context.Background())
+}
+
+// SyncContext is the same as Sync, however the requests are bound to the given context.
+func (m *Mirror) SyncContext(ctx context.Context) (*kinto.Changeset, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	local, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := m.client.SyncRecordsContext(ctx, m.collection, local.Timestamp, 0)
+	if err != nil {
+		return nil, err
+	}
+	if changes.NotModified {
+		return changes, nil
+	}
+	if err := apply(local, changes); err != nil {
+		return nil, err
+	}
+	return changes, m.store(local)
+}
+
+// Timestamp returns the timestamp of the collection as of the last sync. Zero is
+// returned if the mirror has never been synced.
+func (m *Mirror) Timestamp() (uint64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	local, err := m.load()
+	if err != nil {
+		return 0, err
+	}
+	return local.Timestamp, nil
+}
+
+// Unmarshal reads the mirrored records into the given target, which is expected to be
+// the same type of collection as would be given to kinto.Client.AllRecords (that is,
+// something with a "data" field). No request is made to Kinto.
+func (m *Mirror) Unmarshal(target interface{}) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	local, err := m.load()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(local)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, target)
+}
+
+// load reads the mirror from disk. A mirror that does not exist yet is empty.
+func (m *Mirror) load() (*snapshot, error) {
+	local := &snapshot{Data: make([]json.RawMessage, 0)}
+	b, err := ioutil.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return local, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, local); err != nil {
+		return nil, fmt.Errorf("the mirror at %s appears to be corrupt, err: %v", m.path, err)
+	}
+	return local, nil
+}
+
+// store atomically replaces the mirror on disk with the given snapshot.
+func (m *Mirror) store(local *snapshot) error {
+	b, err := json.MarshalIndent(local, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(m.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(m.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
+
+// apply merges the given changes into the snapshot. Records are kept sorted by their
+// ID so that the file on disk is stable (and therefore diffable) between syncs.
+func apply(local *snapshot, changes *kinto.Changeset) error {
+	records := make(map[string]json.RawMessage, len(local.Data))
+	for _, record := range local.Data {
+		id, err := idOf(record)
+		if err != nil {
+			return err
+		}
+		records[id] = record
+	}
+	for _, id := range changes.Deleted {
+		delete(records, id)
+	}
+	for _, record := range changes.Changed {
+		id, err := idOf(record)
+		if err != nil {
+			return err
+		}
+		records[id] = record
+	}
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	local.Data = make([]json.RawMessage, 0, len(ids))
+	for _, id := range ids {
+		local.Data = append(local.Data, records[id])
+	}
+	local.Timestamp = changes.Timestamp
+	return nil
+}
+
+func idOf(record json.RawMessage) (string, error) {
+	r := new(api.Record)
+	if err := json.Unmarshal(record, r); err != nil {
+		return "", err
+	}
+	if r.ID() == "" {
+		return "", fmt.Errorf("record has no ID: %s", string(record))
+	}
+	return r.ID(), nil
+}
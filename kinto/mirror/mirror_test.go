@@ -0,0 +1,215 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto"
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+)
+
+type records struct {
+	Data []record `json:"data"`
+	*api.Record
+}
+
+func (r *records) Get() string {
+	return "/buckets/security-state/collections/onecrl/records"
+}
+
+type record struct {
+	Serial string `json:"serial"`
+	*api.Record
+}
+
+type entry struct {
+	serial       string
+	lastModified uint64
+	deleted      bool
+}
+
+// collection is a tiny stand-in for a Kinto collection that
+// understands _since, tombstones and If-None-Match.
+type collection struct {
+	entries   map[string]*entry
+	timestamp uint64
+	requests  int
+	lock      sync.Mutex
+}
+
+func (c *collection) put(id, serial string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.timestamp++
+	c.entries[id] = &entry{serial: serial, lastModified: c.timestamp}
+}
+
+func (c *collection) delete(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.timestamp++
+	c.entries[id].deleted = true
+	c.entries[id].lastModified = c.timestamp
+}
+
+func (c *collection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.requests++
+	etag := fmt.Sprintf(`"%d"`, c.timestamp)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	var since uint64
+	_, sinced := r.URL.Query()["_since"]
+	if sinced {
+		since, _ = strconv.ParseUint(strings.Trim(r.URL.Query().Get("_since"), `"`), 10, 64)
+	}
+	data := make([]map[string]interface{}, 0)
+	for id, e := range c.entries {
+		if e.lastModified <= since || (e.deleted && !sinced) {
+			continue
+		}
+		if e.deleted {
+			data = append(data, map[string]interface{}{"id": id, "last_modified": e.lastModified, "deleted": true})
+		} else {
+			data = append(data, map[string]interface{}{"id": id, "last_modified": e.lastModified, "serial": e.serial})
+		}
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i]["last_modified"].(uint64) > data[j]["last_modified"].(uint64)
+	})
+	w.Header().Set("ETag", etag)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func newMirror(t *testing.T) (*Mirror, *collection) {
+	t.Helper()
+	c := &collection{entries: make(map[string]*entry)}
+	server := httptest.NewServer(c)
+	t.Cleanup(server.Close)
+	client, err := kinto.NewClientFromStr(server.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.WithRetryPolicy(kinto.NoRetries())
+	path := filepath.Join(t.TempDir(), "onecrl.json")
+	return New(client, new(records), path), c
+}
+
+func serials(t *testing.T, m *Mirror) string {
+	t.Helper()
+	r := new(records)
+	if err := m.Unmarshal(r); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, record := range r.Data {
+		got = append(got, record.ID()+"="+record.Serial)
+	}
+	return strings.Join(got, ",")
+}
+
+func TestMirror(t *testing.T) {
+	m, c := newMirror(t)
+	c.put("a", "1")
+	c.put("b", "2")
+	changes, err := m.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Changed) != 2 {
+		t.Errorf("expected the first sync to fetch everything, got %d records", len(changes.Changed))
+	}
+	if got := serials(t, m); got != "a=1,b=2" {
+		t.Errorf("unexpected mirror %s", got)
+	}
+	// Update one, delete one, add one.
+	c.put("b", "3")
+	c.delete("a")
+	c.put("c", "4")
+	changes, err = m.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Changed) != 2 || len(changes.Deleted) != 1 {
+		t.Errorf("expected only what changed, got %d changes and %d deletions",
+			len(changes.Changed), len(changes.Deleted))
+	}
+	if got := serials(t, m); got != "b=3,c=4" {
+		t.Errorf("unexpected mirror %s", got)
+	}
+	timestamp, err := m.Timestamp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestamp != c.timestamp {
+		t.Errorf("expected timestamp %d, got %d", c.timestamp, timestamp)
+	}
+}
+
+func TestMirrorNotModified(t *testing.T) {
+	m, c := newMirror(t)
+	c.put("a", "1")
+	if _, err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := m.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changes.NotModified {
+		t.Error("expected an unchanged collection to be reported as unmodified")
+	}
+	if got := serials(t, m); got != "a=1" {
+		t.Errorf("unexpected mirror %s", got)
+	}
+}
+
+func TestMirrorSurvivesRestart(t *testing.T) {
+	m, c := newMirror(t)
+	c.put("a", "1")
+	if _, err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	// A fresh mirror over the same file picks up where the last one left off.
+	again := New(m.client, new(records), m.Path())
+	c.put("b", "2")
+	changes, err := again.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Changed) != 1 {
+		t.Errorf("expected only the new record to be fetched, got %d", len(changes.Changed))
+	}
+	if got := serials(t, again); got != "a=1,b=2" {
+		t.Errorf("unexpected mirror %s", got)
+	}
+}
+
+func TestMirrorEmpty(t *testing.T) {
+	m, _ := newMirror(t)
+	if got := serials(t, m); got != "" {
+		t.Errorf("expected a mirror that was never synced to be empty, got %s", got)
+	}
+	timestamp, err := m.Timestamp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestamp != 0 {
+		t.Errorf("expected no timestamp, got %d", timestamp)
+	}
+}
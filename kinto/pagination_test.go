@@ -0,0 +1,188 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+)
+
+// testClient returns a client which targets an in-process HTTP server
+// that is backed by the provided handler. The server is closed
+// when the test completes.
+//
+// Retries are disabled so that failures surface immediately.
+func testClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c, err := NewClientFromStr(server.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.WithRetryPolicy(NoRetries())
+}
+
+// paginated serves the given number of OneCRL records from the
+// OneCRL records endpoint, pageSize records at a time.
+func paginated(t *testing.T, records, pageSize int) (http.Handler, *int) {
+	requests := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1"+NewOneCRL().Get() {
+			t.Errorf("unexpected path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		offset := 0
+		if token := r.URL.Query().Get("_token"); token != "" {
+			var err error
+			offset, err = strconv.Atoi(token)
+			if err != nil {
+				t.Errorf("bad token %s", token)
+			}
+		}
+		end := min(offset+pageSize, records)
+		page := make([]OneCRLRecord, 0)
+		for i := offset; i < end; i++ {
+			page = append(page, OneCRLRecord{
+				SerialNumber: strconv.Itoa(i),
+				Record:       &api.Record{Id: fmt.Sprintf("record-%d", i), LastModified: uint64(i)},
+			})
+		}
+		if end < records {
+			// Kinto advertises an absolute URL, which may very well be for
+			// a host other than the one that we are talking to.
+			w.Header().Set("Next-Page",
+				fmt.Sprintf("https://internal.example.org%s?_limit=%d&_token=%d", r.URL.Path, pageSize, end))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": page})
+	}), &requests
+}
+
+func TestAllRecordsFollowsPagination(t *testing.T) {
+	handler, requests := paginated(t, 25, 10)
+	c := testClient(t, handler)
+	o := NewOneCRL()
+	if err := c.AllRecords(o); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Data) != 25 {
+		t.Fatalf("expected 25 records, got %d", len(o.Data))
+	}
+	for i, record := range o.Data {
+		if record.SerialNumber != strconv.Itoa(i) {
+			t.Errorf("record %d is out of order, got serial %s", i, record.SerialNumber)
+		}
+		if record.ID() != fmt.Sprintf("record-%d", i) {
+			t.Errorf("record %d has an unexpected ID %s", i, record.ID())
+		}
+	}
+	if *requests != 3 {
+		t.Errorf("expected 3 requests, got %d", *requests)
+	}
+}
+
+func TestAllRecordsSinglePage(t *testing.T) {
+	handler, requests := paginated(t, 5, 10)
+	c := testClient(t, handler)
+	o := NewOneCRL()
+	if err := c.AllRecords(o); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Data) != 5 {
+		t.Fatalf("expected 5 records, got %d", len(o.Data))
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestAllRecordsEmpty(t *testing.T) {
+	handler, _ := paginated(t, 0, 10)
+	c := testClient(t, handler)
+	o := NewOneCRL()
+	if err := c.AllRecords(o); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Data) != 0 {
+		t.Fatalf("expected no records, got %d", len(o.Data))
+	}
+}
+
+func TestAllRecordsFailedPageLeavesTargetUntouched(t *testing.T) {
+	handler, _ := paginated(t, 25, 10)
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("_token") == "20" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	o := NewOneCRL()
+	if err := c.AllRecords(o); err == nil {
+		t.Fatal("expected an error when a page fails")
+	}
+	if len(o.Data) != 0 {
+		t.Fatalf("expected the target to be untouched, got %d records", len(o.Data))
+	}
+}
+
+func TestStreamRecords(t *testing.T) {
+	handler, _ := paginated(t, 25, 10)
+	c := testClient(t, handler)
+	got := 0
+	err := c.StreamRecords(NewOneCRL(), func(record json.RawMessage) error {
+		r := new(OneCRLRecord)
+		if err := json.Unmarshal(record, r); err != nil {
+			return err
+		}
+		if r.SerialNumber != strconv.Itoa(got) {
+			t.Errorf("record %d is out of order, got serial %s", got, r.SerialNumber)
+		}
+		got++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 25 {
+		t.Fatalf("expected 25 records, got %d", got)
+	}
+}
+
+func TestStreamRecordsStopsOnConsumerError(t *testing.T) {
+	handler, requests := paginated(t, 25, 10)
+	c := testClient(t, handler)
+	stop := errors.New("stop")
+	got := 0
+	err := c.StreamRecords(NewOneCRL(), func(record json.RawMessage) error {
+		got++
+		if got == 12 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected the consumer's error, got %v", err)
+	}
+	if *requests != 2 {
+		t.Errorf("expected 2 requests, got %d", *requests)
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
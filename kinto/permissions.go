@@ -0,0 +1,235 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/authz"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/groups"
+)
+
+// Permissions retrieves the permissions of the given resource (E.G. a bucket, a collection,
+// a group, or a record via api.RecordResource). Only the principals that were granted
+// permissions upon the resource itself are listed, rather than those it inherits from its parents.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/permissions.html
+func (c *Client) Permissions(resource api.Resourcer) (*authz.Permissions, error) {
+	return c.PermissionsContext(context.Background(), resource)
+}
+
+// PermissionsContext is the same as Permissions, however the request is bound to the given context.
+func (c *Client) PermissionsContext(ctx context.Context, resource api.Resourcer) (*authz.Permissions, error) {
+	return c.getResource(ctx, resource, nil)
+}
+
+// UpdatePermissions applies the given grants and revocations (see authz.Grant and authz.Revoke) to
+// the given resource, returning the resource's permissions as they are afterwards. Principals that
+// are not mentioned by the operations are left untouched.
+//
+//	perms, err := client.UpdatePermissions(collection,
+//		authz.Grant(authz.Write, authz.Account("alice")),
+//		authz.Revoke(authz.Write, authz.Account("bob")))
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/records.html#json-patch-operations
+func (c *Client) UpdatePermissions(resource api.Resourcer, operations ...authz.Operation) (*authz.Permissions, error) {
+	return c.UpdatePermissionsContext(context.Background(), resource, operations...)
+}
+
+// UpdatePermissionsContext is the same as UpdatePermissions, however the request is bound to the given context.
+func (c *Client) UpdatePermissionsContext(ctx context.Context, resource api.Resourcer, operations ...authz.Operation) (*authz.Permissions, error) {
+	req, err := c.newRequest(ctx, http.MethodPatch, resource.Resource(), operations)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	perms := new(authz.Permissions)
+	return perms, c.do(req, api.NewPayload(nil, perms), ok)
+}
+
+// EffectivePermissions lists every resource upon which the current user holds any permission,
+// whether granted directly, via a group, or inherited from a parent resource.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/permissions.html#list-every-permissions
+func (c *Client) EffectivePermissions() ([]*authz.Effective, error) {
+	return c.EffectivePermissionsContext(context.Background())
+}
+
+// EffectivePermissionsContext is the same as EffectivePermissions, however the request is bound to the given context.
+func (c *Client) EffectivePermissionsContext(ctx context.Context) ([]*authz.Effective, error) {
+	list := make([]*authz.Effective, 0)
+	err := c.StreamRecordsContext(ctx, endpoint("/permissions"), func(b json.RawMessage) error {
+		effective := new(authz.Effective)
+		list = append(list, effective)
+		return json.Unmarshal(b, effective)
+	})
+	return list, err
+}
+
+// Groups lists every group within the given bucket.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/groups.html#retrieving-all-groups
+func (c *Client) Groups(bucket *buckets.Bucket) ([]*groups.Group, error) {
+	return c.GroupsContext(context.Background(), bucket)
+}
+
+// GroupsContext is the same as Groups, however the request is bound to the given context.
+func (c *Client) GroupsContext(ctx context.Context, bucket *buckets.Bucket) ([]*groups.Group, error) {
+	list := make([]*groups.Group, 0)
+	err := c.StreamRecordsContext(ctx, endpoint(bucket.Get()+"/groups"), func(b json.RawMessage) error {
+		group := groups.NewGroup(bucket, "")
+		list = append(list, group)
+		return json.Unmarshal(b, group)
+	})
+	return list, err
+}
+
+// GetGroup retrieves the members (and last_modified) of the given group.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/groups.html#retrieving-an-existing-group
+func (c *Client) GetGroup(group *groups.Group) error {
+	return c.GetGroupContext(context.Background(), group)
+}
+
+// GetGroupContext is the same as GetGroup, however the request is bound to the given context.
+func (c *Client) GetGroupContext(ctx context.Context, group *groups.Group) error {
+	_, err := c.getResource(ctx, group, group)
+	return err
+}
+
+// PutGroup creates the given group, or replaces the members of the group if it already exists.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/groups.html#replacing-a-group
+func (c *Client) PutGroup(group *groups.Group) error {
+	return c.PutGroupContext(context.Background(), group)
+}
+
+// PutGroupContext is the same as PutGroup, however the request is bound to the given context.
+func (c *Client) PutGroupContext(ctx context.Context, group *groups.Group) error {
+	payload := api.NewPayload(group, nil)
+	req, err := c.newRequest(ctx, http.MethodPut, group.Put(), payload)
+	if err != nil {
+		return err
+	}
+	return c.do(req, payload, okOrCreated)
+}
+
+// DeleteGroup deletes the given group.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/groups.html#deleting-a-group
+func (c *Client) DeleteGroup(group *groups.Group) error {
+	return c.DeleteGroupContext(context.Background(), group)
+}
+
+// DeleteGroupContext is the same as DeleteGroup, however the request is bound to the given context.
+func (c *Client) DeleteGroupContext(ctx context.Context, group *groups.Group) error {
+	return c.deleteResource(ctx, group)
+}
+
+// AddGroupMembers adds the given principals to the given (existing) group. Principals that
+// are already members are ignored. On success, the group holds its members in full.
+//
+// The group is read and then only its members are PATCHed, on the condition that the group was
+// not modified in the meantime (via If-Match), so that concurrent edits are never lost. If it was, then an error matching
+// ErrConflict is returned and the call may simply be retried.
+func (c *Client) AddGroupMembers(group *groups.Group, principals ...string) error {
+	return c.AddGroupMembersContext(context.Background(), group, principals...)
+}
+
+// AddGroupMembersContext is the same as AddGroupMembers, however the requests are bound to the given context.
+func (c *Client) AddGroupMembersContext(ctx context.Context, group *groups.Group, principals ...string) error {
+	return c.editGroup(ctx, group, func() {
+		for _, principal := range principals {
+			if !group.Has(principal) {
+				group.Members = append(group.Members, principal)
+			}
+		}
+	})
+}
+
+// RemoveGroupMembers removes the given principals from the given (existing) group. Principals
+// that are not members are ignored. On success, the group holds its members in full.
+//
+// See AddGroupMembers for how concurrent edits are handled.
+func (c *Client) RemoveGroupMembers(group *groups.Group, principals ...string) error {
+	return c.RemoveGroupMembersContext(context.Background(), group, principals...)
+}
+
+// RemoveGroupMembersContext is the same as RemoveGroupMembers, however the requests are bound to the given context.
+func (c *Client) RemoveGroupMembersContext(ctx context.Context, group *groups.Group, principals ...string) error {
+	return c.editGroup(ctx, group, func() {
+		remove := make(map[string]bool, len(principals))
+		for _, principal := range principals {
+			remove[principal] = true
+		}
+		members := make([]string, 0, len(group.Members))
+		for _, member := range group.Members {
+			if !remove[member] {
+				members = append(members, member)
+			}
+		}
+		group.Members = members
+	})
+}
+
+// editGroup reads the given group, applies the given edit to it, and PATCHes its members
+// on the condition that nobody else has modified it in the meantime. Any other attribute
+// of the group is left as Kinto has it.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/groups.html
+func (c *Client) editGroup(ctx context.Context, group *groups.Group, edit func()) error {
+	if err := c.GetGroupContext(ctx, group); err != nil {
+		return err
+	}
+	edit()
+	members := api.NewPayload(&struct {
+		Members []string `json:"members"`
+	}{group.Members}, nil)
+	req, err := c.newRequest(ctx, http.MethodPatch, group.Patch(), members)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-Match", etag(group.LastModified))
+	return c.do(req, api.NewPayload(group, nil), ok)
+}
+
+// getResource retrieves the given resource into the given target (which may be nil),
+// returning the resource's permissions.
+func (c *Client) getResource(ctx context.Context, resource api.Resourcer, target interface{}) (*authz.Permissions, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, resource.Resource(), nil)
+	if err != nil {
+		return nil, err
+	}
+	perms := new(authz.Permissions)
+	return perms, c.do(req, api.NewPayload(target, perms), ok)
+}
+
+func (c *Client) deleteResource(ctx context.Context, resource api.Deleter) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, resource.Delete(), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil, ok)
+}
+
+// endpoint is an arbitrary listing endpoint (E.G. "/buckets"), for
+// walking listings other than records via StreamRecords.
+type endpoint string
+
+func (e endpoint) Get() string {
+	return string(e)
+}
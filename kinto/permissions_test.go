@@ -0,0 +1,230 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/authz"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/groups"
+)
+
+func TestUpdatePermissions(t *testing.T) {
+	reviewers := groups.NewGroup(buckets.NewBucket("main-workspace"), "onecrl-reviewers")
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/v1"+NewOneCRL().Resource() {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json-patch+json" {
+			t.Errorf("expected a JSON-Patch, got %s", got)
+		}
+		var operations []authz.Operation
+		if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+			t.Error(err)
+			return
+		}
+		want := []authz.Operation{
+			{Op: "add", Path: "/permissions/write/account:alice"},
+			{Op: "remove", Path: "/permissions/read/~1buckets~1main-workspace~1groups~1onecrl-reviewers"},
+		}
+		if !reflect.DeepEqual(operations, want) {
+			t.Errorf("unexpected operations %v", operations)
+		}
+		_, _ = w.Write([]byte(`{"data": {"id": "onecrl"}, "permissions": {"write": ["account:alice"], "record:create": ["system.Authenticated"]}}`))
+	}))
+	perms, err := c.UpdatePermissions(NewOneCRL(),
+		authz.Grant(authz.Write, authz.Account("alice")),
+		authz.Revoke(authz.Read, reviewers.Principal()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(perms.Write) != 1 || perms.Write[0] != "account:alice" {
+		t.Errorf("unexpected write permissions %v", perms.Write)
+	}
+	if len(perms.RecordCreate) != 1 || perms.RecordCreate[0] != authz.Authenticated {
+		t.Errorf("unexpected record:create permissions %v", perms.RecordCreate)
+	}
+}
+
+func TestPermissionsOfRecord(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1"+NewOneCRL().Get()+"/a" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"data": {"id": "a"}, "permissions": {"read": ["system.Everyone"]}}`))
+	}))
+	perms, err := c.Permissions(&api.RecordResource{Collection: NewOneCRL(), ID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(perms.Read) != 1 || perms.Read[0] != authz.Everyone {
+		t.Errorf("unexpected read permissions %v", perms.Read)
+	}
+}
+
+func TestEffectivePermissions(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/permissions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"data": [{
+			"uri": "/buckets/security-state-staging/collections/onecrl",
+			"resource_name": "collection",
+			"id": "onecrl",
+			"bucket_id": "security-state-staging",
+			"permissions": ["read", "write"]
+		}]}`))
+	}))
+	effective, err := c.EffectivePermissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(effective) != 1 || !effective[0].Has(authz.Write) || effective[0].Has(authz.RecordCreate) {
+		t.Errorf("unexpected permissions %v", effective)
+	}
+}
+
+func TestBucketsAndCollections(t *testing.T) {
+	deleted := make([]string, 0)
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v1"))
+			_, _ = w.Write([]byte(`{"data": {"deleted": true}}`))
+		case r.URL.Path == "/v1/buckets":
+			_, _ = w.Write([]byte(`{"data": [{"id": "main", "last_modified": 1}, {"id": "security-state", "last_modified": 2}]}`))
+		case r.URL.Path == "/v1/buckets/security-state":
+			_, _ = w.Write([]byte(`{"data": {"id": "security-state", "last_modified": 2}, "permissions": {"collection:create": ["account:admin"]}}`))
+		case r.URL.Path == "/v1/buckets/security-state/collections":
+			_, _ = w.Write([]byte(`{"data": [{"id": "onecrl"}, {"id": "intermediates"}]}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	all, err := c.Buckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[1].ID != "security-state" {
+		t.Errorf("unexpected buckets %v", all)
+	}
+	bucket, perms, err := c.GetBucket("security-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket.LastModified != 2 || len(perms.CollectionCreate) != 1 {
+		t.Errorf("unexpected bucket %v with permissions %v", bucket, perms)
+	}
+	colls, err := c.Collections(bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(colls) != 2 || colls[0].ID != "onecrl" || colls[0].Get() != "/buckets/security-state/collections/onecrl/records" {
+		t.Errorf("unexpected collections %v", colls)
+	}
+	if err := c.DeleteCollection(colls[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteBucket(bucket); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/buckets/security-state/collections/intermediates", "/buckets/security-state"}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("expected %v to be deleted, got %v", want, deleted)
+	}
+}
+
+// groupServer serves a single group, honoring If-Match upon patching its members.
+type groupServer struct {
+	t            *testing.T
+	members      []string
+	lastModified uint64
+	// Called between the read and write of an edit, to simulate a concurrent edit.
+	meddle func()
+	lock   sync.Mutex
+}
+
+func (g *groupServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"id": "onecrl-reviewers", "members": g.members, "last_modified": g.lastModified},
+		})
+		if g.meddle != nil {
+			g.meddle()
+			g.meddle = nil
+		}
+	case http.MethodPatch:
+		if r.Header.Get("If-Match") != fmt.Sprintf(`"%d"`, g.lastModified) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = w.Write([]byte(`{"code": 412, "errno": 114, "error": "Precondition Failed"}`))
+			return
+		}
+		payload := struct {
+			Data map[string]json.RawMessage `json:"data"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			g.t.Error(err)
+			return
+		}
+		if len(payload.Data) != 1 {
+			g.t.Errorf("expected only the members to be patched, got %v", payload.Data)
+		}
+		if err := json.Unmarshal(payload.Data["members"], &g.members); err != nil {
+			g.t.Error(err)
+			return
+		}
+		g.lastModified++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"id": "onecrl-reviewers", "members": g.members, "last_modified": g.lastModified},
+		})
+	default:
+		g.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestGroupMembers(t *testing.T) {
+	server := &groupServer{t: t, members: []string{"account:alice"}, lastModified: 10}
+	c := testClient(t, server)
+	group := groups.NewGroup(buckets.NewBucket("main-workspace"), "onecrl-reviewers")
+	if err := c.AddGroupMembers(group, "account:bob", "account:alice"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(server.members, []string{"account:alice", "account:bob"}) {
+		t.Errorf("unexpected members %v", server.members)
+	}
+	if err := c.RemoveGroupMembers(group, "account:alice"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(group.Members, []string{"account:bob"}) || group.LastModified != 12 {
+		t.Errorf("unexpected group %v", group)
+	}
+}
+
+func TestGroupMembersConflict(t *testing.T) {
+	server := &groupServer{t: t, members: []string{"account:alice"}, lastModified: 10}
+	server.meddle = func() { server.lastModified++ }
+	c := testClient(t, server)
+	group := groups.NewGroup(buckets.NewBucket("main-workspace"), "onecrl-reviewers")
+	err := c.AddGroupMembers(group, "account:bob")
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if !reflect.DeepEqual(server.members, []string{"account:alice"}) {
+		t.Errorf("expected the group to be untouched, got %v", server.members)
+	}
+}
@@ -0,0 +1,78 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package kintoattachment describes the records and server capabilities of the Kinto Attachment plugin.
+//
+// For details on the Kinto Attachment plugin, please see:
+// https://github.com/Kinto/kinto-attachment
+package kintoattachment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+)
+
+// Attachment is the metadata that the plugin stores under the "attachment" field of a record.
+// The file itself is served from Location, relative to the server's attachments base URL
+// (see Capability).
+type Attachment struct {
+	Filename string `json:"filename"`
+	// The hex encoded SHA-256 of the file.
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+	Location string `json:"location"`
+	Mimetype string `json:"mimetype"`
+	// If the plugin gzipped the file, then this is the metadata of the original (uncompressed) file.
+	Original *Attachment `json:"original,omitempty"`
+}
+
+// Attached may be embedded within a record schema in order to receive the record's attachment (if any).
+//
+//	type Intermediate struct {
+//		Subject string `json:"subject"`
+//		kintoattachment.Attached
+//		*api.Record
+//	}
+type Attached struct {
+	Attachment *Attachment `json:"attachment,omitempty"`
+}
+
+// Capability is the plugin's entry within the "capabilities" of the server's root resource.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/utilities.html#api-utilities
+type Capability struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Version     string `json:"version"`
+	// The URL from which every attachment of the server is served (typically a CDN).
+	BaseURL string `json:"base_url"`
+}
+
+// Endpoint returns the attachment resource of the given record.
+func Endpoint(collection api.Getter, id string) string {
+	return fmt.Sprintf("%s/%s/attachment", collection.Get(), id)
+}
+
+// URL returns the location of this attachment relative to the given base URL.
+func (a *Attachment) URL(base string) string {
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(a.Location, "/")
+}
+
+// Verify returns an error if the given content is not of the size,
+// and does not have the hash, that this attachment declares.
+func (a *Attachment) Verify(content []byte) error {
+	if int64(len(content)) != a.Size {
+		return fmt.Errorf("attachment %s was expected to be %d bytes, got %d", a.Location, a.Size, len(content))
+	}
+	sum := sha256.Sum256(content)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, a.Hash) {
+		return fmt.Errorf("attachment %s was expected to have the SHA-256 %s, got %s", a.Location, a.Hash, got)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package kintochanges describes the monitor/changes endpoint of Remote Settings, which lists
+// the current timestamp of every collection of the server. Firefox polls this endpoint in order
+// to learn which collections have changed, so a collection's change is live (that is, it has
+// reached the CDN) once its timestamp within monitor/changes has moved past that of the change.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-changes
+package kintochanges
+
+import (
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+)
+
+// Monitor is the (read only) collection which lists a Change for every collection of the server.
+var Monitor = collections.NewCollection(buckets.NewBucket("monitor"), "changes")
+
+// A Change is the latest timestamp of a single collection.
+type Change struct {
+	ID string `json:"id"`
+	// The timestamp of the latest change made within the collection.
+	LastModified uint64 `json:"last_modified"`
+	Bucket       string `json:"bucket"`
+	Collection   string `json:"collection"`
+	// The host of the server (E.G. "firefox.settings.services.mozilla.com").
+	Host string `json:"host"`
+}
+
+// Is returns whether the change is that of the given collection.
+func (c *Change) Is(collection *collections.Collection) bool {
+	return c.Bucket == collection.Bucket.ID && c.Collection == collection.ID
+}
+
+// Time returns the timestamp of the change.
+func (c *Change) Time() time.Time {
+	return time.Unix(0, int64(c.LastModified)*int64(time.Millisecond)).UTC()
+}
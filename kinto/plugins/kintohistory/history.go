@@ -0,0 +1,205 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package kintohistory describes the audit trail that the Kinto History plugin keeps of every
+// change made within a bucket, and builds filtered views of that trail.
+//
+//	filter := kintohistory.New(buckets.NewBucket("security-state-staging")).
+//		Collection("onecrl").
+//		ResourceName(kintohistory.Record).
+//		Action(kintohistory.Delete).
+//		Since(time.Now().AddDate(0, -1, 0))
+//	entries, err := client.History(filter)
+//
+// For details on the Kinto History plugin, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/history.html
+package kintohistory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/authz"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+)
+
+// The actions that are recorded by the plugin.
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// The kinds of resources whose changes are recorded by the plugin.
+const (
+	Bucket     = "bucket"
+	Collection = "collection"
+	Group      = "group"
+	Record     = "record"
+)
+
+// Capability is the plugin's entry within the "capabilities" of the server's root resource.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/history.html
+type Capability struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Version     string `json:"version,omitempty"`
+}
+
+// An Entry is a single change made to a single resource.
+type Entry struct {
+	ID string `json:"id"`
+	// The timestamp of the entry itself, which is also when the change was made.
+	LastModified uint64 `json:"last_modified"`
+	// One of Create, Update, or Delete.
+	Action string `json:"action"`
+	// The resource that was changed (E.G. "/buckets/security-state-staging/collections/onecrl/records/<id>").
+	URI string `json:"uri"`
+	// When the change was made, as an ISO 8601 timestamp (in UTC).
+	Date string `json:"date"`
+	// The principal of the user that made the change (E.G. "account:alice").
+	UserID string `json:"user_id"`
+	// One of Bucket, Collection, Group, or Record.
+	ResourceName string `json:"resource_name"`
+	BucketID     string `json:"bucket_id"`
+	CollectionID string `json:"collection_id,omitempty"`
+	GroupID      string `json:"group_id,omitempty"`
+	RecordID     string `json:"record_id,omitempty"`
+	// The resource as it was immediately after the change (or, for deletions, its tombstone).
+	Target Target `json:"target"`
+}
+
+// Target is the state of a resource as it was recorded within an Entry.
+type Target struct {
+	Data        json.RawMessage    `json:"data"`
+	Permissions *authz.Permissions `json:"permissions,omitempty"`
+}
+
+// Time returns when the change was made.
+func (e *Entry) Time() time.Time {
+	return time.Unix(0, int64(e.LastModified)*int64(time.Millisecond)).UTC()
+}
+
+// Unmarshal unmarshals the changed resource (E.G. a OneCRL record) into the given target.
+func (e *Entry) Unmarshal(target interface{}) error {
+	return json.Unmarshal(e.Target.Data, target)
+}
+
+// A Filter is a view over the history of a bucket. Every method of a Filter modifies it in place and
+// returns it, so that calls may be chained. A Filter is an api.Getter, so it may be given to
+// Client.StreamRecords as well as Client.History.
+type Filter struct {
+	bucket *buckets.Bucket
+	params url.Values
+	err    error
+}
+
+// New constructs a filter which matches the entire history of the given bucket.
+func New(bucket *buckets.Bucket) *Filter {
+	return &Filter{bucket: bucket, params: url.Values{}}
+}
+
+// Get returns the history endpoint of the bucket along with this filter's parameters.
+func (f *Filter) Get() string {
+	endpoint := f.bucket.Get() + "/history"
+	if len(f.params) == 0 {
+		return endpoint
+	}
+	return endpoint + "?" + f.params.Encode()
+}
+
+// Err returns the reason why the filter cannot be sent, if any. Kinto splits a list of values
+// on commas (without any means of escaping them), so where more than one value is given to
+// ResourceName, Action, or User, none may contain a comma. The Kinto client refuses to send a
+// filter which has an error.
+func (f *Filter) Err() error {
+	return f.err
+}
+
+// Values returns a copy of the filter's parameters.
+func (f *Filter) Values() url.Values {
+	values := url.Values{}
+	for key, value := range f.params {
+		values[key] = append([]string{}, value...)
+	}
+	return values
+}
+
+// Collection matches changes made to the given collection, or to any record within it.
+func (f *Filter) Collection(id string) *Filter {
+	f.params.Set("collection_id", id)
+	return f
+}
+
+// Record matches changes made to the given record.
+func (f *Filter) Record(id string) *Filter {
+	f.params.Set("record_id", id)
+	return f
+}
+
+// ResourceName matches changes made to resources of any of the given kinds (E.G. Record).
+func (f *Filter) ResourceName(names ...string) *Filter {
+	return f.oneOf("resource_name", names)
+}
+
+// Action matches changes of any of the given kinds (E.G. Create or Delete).
+func (f *Filter) Action(actions ...string) *Filter {
+	return f.oneOf("action", actions)
+}
+
+// User matches changes made by any of the given principals (E.G. "account:alice").
+func (f *Filter) User(principals ...string) *Filter {
+	return f.oneOf("user_id", principals)
+}
+
+// Since matches changes made after the given time.
+func (f *Filter) Since(t time.Time) *Filter {
+	f.params.Set("_since", millis(t))
+	return f
+}
+
+// Before matches changes made before the given time.
+func (f *Filter) Before(t time.Time) *Filter {
+	f.params.Set("_before", millis(t))
+	return f
+}
+
+// Sort orders the entries by the given fields, in order of precedence. A field prefixed with
+// "-" is sorted in descending order. By default, the newest entries are listed first.
+func (f *Filter) Sort(fields ...string) *Filter {
+	f.params.Set("_sort", strings.Join(fields, ","))
+	return f
+}
+
+// Limit sets the number of entries returned per page.
+func (f *Filter) Limit(limit int) *Filter {
+	f.params.Set("_limit", strconv.Itoa(limit))
+	return f
+}
+
+func (f *Filter) oneOf(field string, values []string) *Filter {
+	switch len(values) {
+	case 0:
+	case 1:
+		f.params.Set(field, values[0])
+	default:
+		for _, value := range values {
+			if strings.Contains(value, ",") && f.err == nil {
+				f.err = fmt.Errorf("the value %q of %s contains a comma, which Kinto would split into separate values", value, field)
+			}
+		}
+		f.params.Set("in_"+field, strings.Join(values, ","))
+	}
+	return f
+}
+
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
@@ -0,0 +1,146 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kintosigner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// CanonicalJSON serializes the given records and collection timestamp exactly as Kinto Signer
+// does prior to signing them. That is, the equivalent of the following Python:
+//
+//	records = sorted((r for r in records if not r.get("deleted")), key=lambda r: r["id"])
+//	json.dumps({"data": records, "last_modified": str(last_modified)}, sort_keys=True, separators=(",", ":"))
+//
+// Which is to say that keys are sorted, there is no insignificant whitespace, and every character
+// outside of printable ASCII is escaped (Python's ensure_ascii). Numbers are reproduced exactly as
+// they were given, as they are the product of that same Python serializer in the first place.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-signer/blob/master/kinto_signer/serializer.py
+func CanonicalJSON(records []json.RawMessage, lastModified uint64) ([]byte, error) {
+	type identified struct {
+		id    string
+		value interface{}
+	}
+	live := make([]identified, 0, len(records))
+	for _, record := range records {
+		value, err := decode(record)
+		if err != nil {
+			return nil, err
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("kintosigner: expected a record to be an object, got %s", string(record))
+		}
+		if deleted, ok := object["deleted"].(bool); ok && deleted {
+			continue
+		}
+		id, _ := object["id"].(string)
+		live = append(live, identified{id: id, value: object})
+	}
+	sort.SliceStable(live, func(i, j int) bool {
+		return live[i].id < live[j].id
+	})
+	data := make([]interface{}, len(live))
+	for i, record := range live {
+		data[i] = record.value
+	}
+	buf := new(bytes.Buffer)
+	write(buf, map[string]interface{}{
+		"data":          data,
+		"last_modified": strconv.FormatUint(lastModified, 10),
+	})
+	return buf.Bytes(), nil
+}
+
+func decode(b []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func write(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		buf.WriteString(v.String())
+	case string:
+		writeString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			write(buf, item)
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		// Go compares strings bytewise, which for UTF-8 is the
+		// same as comparing by code point (as Python does).
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeString(buf, key)
+			buf.WriteByte(':')
+			write(buf, v[key])
+		}
+		buf.WriteByte('}')
+	}
+}
+
+// writeString writes the given string as Python's json module does with ensure_ascii.
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		default:
+			switch {
+			case r >= ' ' && r <= '~':
+				buf.WriteRune(r)
+			case r > 0xFFFF:
+				high, low := utf16.EncodeRune(r)
+				fmt.Fprintf(buf, `\u%04x\u%04x`, high, low)
+			default:
+				fmt.Fprintf(buf, `\u%04x`, r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,87 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kintosigner
+
+// Capability is the plugin's entry within the "capabilities" of the server's root resource.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-signer#configuration
+type Capability struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Version     string `json:"version"`
+	// Whether changes must be reviewed before they are signed.
+	ToReviewEnabled bool `json:"to_review_enabled"`
+	// Whether editors and reviewers must belong to the editors and reviewers groups.
+	GroupCheckEnabled bool `json:"group_check_enabled"`
+	// The names of the editors and reviewers groups, wherein "{collection_id}" is a placeholder.
+	EditorsGroup   string `json:"editors_group,omitempty"`
+	ReviewersGroup string `json:"reviewers_group,omitempty"`
+	// Every resource that the signer publishes.
+	Resources []*Resource `json:"resources"`
+}
+
+// A Resource is a source collection (in which changes are made), the collection to which its changes are copied
+// while they are in review (the preview), and the collection to which they are published once approved (the destination).
+type Resource struct {
+	Source Location `json:"source"`
+	// Nil if reviews are not enabled for this resource.
+	Preview     *Location `json:"preview,omitempty"`
+	Destination Location  `json:"destination"`
+}
+
+// A Location is a collection within a bucket. If the collection is empty then the location
+// is the entire bucket, which is to say that every collection within it is signed.
+type Location struct {
+	Bucket     string `json:"bucket"`
+	Collection string `json:"collection,omitempty"`
+}
+
+func (l Location) matches(bucket, collection string) bool {
+	return l.Bucket == bucket && (l.Collection == "" || l.Collection == collection)
+}
+
+func (l Location) resolve(collection string) Location {
+	if l.Collection == "" {
+		l.Collection = collection
+	}
+	return l
+}
+
+// Resource returns the signer resource that the given collection belongs to (as either the source, preview, or
+// destination), with any bucket-wide locations resolved to the given collection. False is returned if the
+// collection is not signed.
+//
+//	resource, ok := capability.Resource("security-state", "onecrl")
+//	resource.Source  // {security-state-staging onecrl}
+func (c *Capability) Resource(bucket, collection string) (*Resource, bool) {
+	// Resources naming the collection explicitly take precedence over bucket-wide resources.
+	for _, explicit := range []bool{true, false} {
+		for _, r := range c.Resources {
+			locations := []Location{r.Source, r.Destination}
+			if r.Preview != nil {
+				locations = append(locations, *r.Preview)
+			}
+			for _, l := range locations {
+				if (l.Collection != "") == explicit && l.matches(bucket, collection) {
+					return r.resolve(collection), true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+func (r *Resource) resolve(collection string) *Resource {
+	resolved := &Resource{
+		Source:      r.Source.resolve(collection),
+		Destination: r.Destination.resolve(collection),
+	}
+	if r.Preview != nil {
+		preview := r.Preview.resolve(collection)
+		resolved.Preview = &preview
+	}
+	return resolved
+}
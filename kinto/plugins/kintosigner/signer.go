@@ -4,38 +4,128 @@
 
 package kintosigner
 
+import (
+	"time"
+)
+
+// The states of the Kinto Signer review workflow.
+//
+// For details, please see:
+// https://remote-settings.readthedocs.io/en/latest/getting-started.html#workflow
+const (
+	StatusWorkInProgress = "work-in-progress"
+	StatusToReview       = "to-review"
+	StatusToSign         = "to-sign"
+	StatusSigned         = "signed"
+	StatusToRollback     = "to-rollback"
+	StatusToResign       = "to-resign"
+)
+
 type Status struct {
 	Data KintoStatus `json:"data"`
 }
 
+// KintoStatus is the review workflow metadata that Kinto Signer maintains upon a collection.
+// Kinto Signer refuses any attempt to set these fields other than Status and the comments,
+// which is why they are omitted when empty.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-signer#workflows
 type KintoStatus struct {
 	Status string `json:"status"`
+	// The last user to edit the collection and when. Set upon any change to its records.
+	LastEditBy   string `json:"last_edit_by,omitempty"`
+	LastEditDate string `json:"last_edit_date,omitempty"`
+	// The last user to request a review and when. Set upon moving to StatusToReview.
+	LastReviewRequestBy   string `json:"last_review_request_by,omitempty"`
+	LastReviewRequestDate string `json:"last_review_request_date,omitempty"`
+	// The last user to approve (or decline) a review and when.
+	LastReviewBy   string `json:"last_review_by,omitempty"`
+	LastReviewDate string `json:"last_review_date,omitempty"`
+	// The last user to sign the collection and when.
+	LastSignatureBy   string `json:"last_signature_by,omitempty"`
+	LastSignatureDate string `json:"last_signature_date,omitempty"`
+	// The editor's note to reviewers, attached when requesting a review.
+	LastEditorComment string `json:"last_editor_comment,omitempty"`
+	// The reviewer's note to editors, typically attached when declining a review.
+	LastReviewerComment string `json:"last_reviewer_comment,omitempty"`
 }
 
 func (s *Status) InReview() bool {
-	return s.Data.Status == "to-review"
+	return s.Data.Status == StatusToReview
+}
+
+// PendingSince returns when the review currently pending was requested. False is returned if
+// the collection is not in review or Kinto Signer did not record when the review was requested.
+func (s *Status) PendingSince() (time.Time, bool) {
+	if !s.InReview() {
+		return time.Time{}, false
+	}
+	requested, err := ParseDate(s.Data.LastReviewRequestDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return requested, true
+}
+
+// PendingFor returns how long the review currently pending has been waiting as of the given
+// time. Zero is returned if there is no review pending (see PendingSince).
+func (s *Status) PendingFor(now time.Time) time.Duration {
+	since, ok := s.PendingSince()
+	if !ok {
+		return 0
+	}
+	return now.Sub(since)
+}
+
+// ParseDate parses the dates that Kinto Signer records (E.G. LastReviewRequestDate), which
+// are ISO 8601 timestamps. Those without a timezone are in UTC.
+func ParseDate(date string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, date)
+	if err == nil {
+		return t, nil
+	}
+	if t, e := time.Parse("2006-01-02T15:04:05.999999999", date); e == nil {
+		return t, nil
+	}
+	return time.Time{}, err
 }
 
 func WIP() Status {
-	return Status{Data: KintoStatus{Status: "work-in-progress"}}
+	return Status{Data: KintoStatus{Status: StatusWorkInProgress}}
+}
+
+// WIPWithComment returns the collection to work-in-progress with the given note to its
+// editors. This is how a reviewer declines a review, with the comment being the reason.
+func WIPWithComment(comment string) Status {
+	status := WIP()
+	status.Data.LastReviewerComment = comment
+	return status
 }
 
 func ToReview() Status {
-	return Status{Data: KintoStatus{Status: "to-review"}}
+	return Status{Data: KintoStatus{Status: StatusToReview}}
+}
+
+// ToReviewWithComment requests a review with the given note to reviewers (E.G. the bug that motivated the changes).
+func ToReviewWithComment(comment string) Status {
+	status := ToReview()
+	status.Data.LastEditorComment = comment
+	return status
 }
 
 func ToSign() Status {
-	return Status{Data: KintoStatus{Status: "to-sign"}}
+	return Status{Data: KintoStatus{Status: StatusToSign}}
 }
 
 func Signed() Status {
-	return Status{Data: KintoStatus{Status: "signed"}}
+	return Status{Data: KintoStatus{Status: StatusSigned}}
 }
 
 func ToRollback() Status {
-	return Status{Data: KintoStatus{Status: "to-rollback"}}
+	return Status{Data: KintoStatus{Status: StatusToRollback}}
 }
 
 func ToResign() Status {
-	return Status{Data: KintoStatus{Status: "to-resign"}}
+	return Status{Data: KintoStatus{Status: StatusToResign}}
 }
@@ -0,0 +1,69 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kintosigner_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+func TestStatusMetadata(t *testing.T) {
+	body := `{"data": {
+		"id": "onecrl",
+		"status": "to-review",
+		"last_edit_by": "account:alice",
+		"last_edit_date": "2021-02-26T00:05:00.000000+00:00",
+		"last_review_request_by": "account:alice",
+		"last_review_request_date": "2021-02-26T00:06:02.123456+00:00",
+		"last_review_by": "account:bob",
+		"last_review_date": "2021-02-20T10:00:00",
+		"last_editor_comment": "Bug 1234",
+		"last_reviewer_comment": "Wrong serial"
+	}}`
+	status := new(kintosigner.Status)
+	if err := json.Unmarshal([]byte(body), status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Data.LastReviewRequestBy != "account:alice" || status.Data.LastEditorComment != "Bug 1234" || status.Data.LastReviewerComment != "Wrong serial" {
+		t.Errorf("unexpected metadata %v", status.Data)
+	}
+	since, ok := status.PendingSince()
+	if !ok || !since.Equal(time.Date(2021, 2, 26, 0, 6, 2, 123456000, time.UTC)) {
+		t.Fatalf("unexpected pending since %s", since)
+	}
+	if got := status.PendingFor(since.Add(time.Hour * 72)); got != time.Hour*72 {
+		t.Errorf("expected to be pending for 72h, got %s", got)
+	}
+	reviewed, err := kintosigner.ParseDate(status.Data.LastReviewDate)
+	if err != nil || !reviewed.Equal(time.Date(2021, 2, 20, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a date without a timezone to be UTC, got %s (%v)", reviewed, err)
+	}
+	status.Data.Status = kintosigner.StatusSigned
+	if _, ok := status.PendingSince(); ok || status.PendingFor(time.Now()) != 0 {
+		t.Error("expected nothing to be pending once signed")
+	}
+}
+
+func TestStatusPatches(t *testing.T) {
+	for _, test := range []struct {
+		status kintosigner.Status
+		want   string
+	}{
+		{kintosigner.ToReview(), `{"data":{"status":"to-review"}}`},
+		{kintosigner.ToReviewWithComment("Bug 1234"), `{"data":{"status":"to-review","last_editor_comment":"Bug 1234"}}`},
+		{kintosigner.WIPWithComment("Wrong serial"), `{"data":{"status":"work-in-progress","last_reviewer_comment":"Wrong serial"}}`},
+	} {
+		b, err := json.Marshal(test.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.want {
+			t.Errorf("expected %s, got %s", test.want, b)
+		}
+	}
+}
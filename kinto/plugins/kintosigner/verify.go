@@ -0,0 +1,185 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kintosigner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Signature is the "signature" that Kinto Signer attaches to the metadata of a signed collection.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-signer#signature-verification
+type Signature struct {
+	// The location of the PEM encoded certificate chain (leaf first) of the signing key.
+	X5U string `json:"x5u"`
+	// The base64 (URL safe) encoded r||s of an ECDSA P-384 signature over SHA-384.
+	Signature string `json:"signature"`
+	Mode      string `json:"mode,omitempty"`
+	Ref       string `json:"ref,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// contentSignaturePrefix is prepended to the canonical JSON of a collection before it is signed.
+const contentSignaturePrefix = "Content-Signature:\x00"
+
+// ErrBadSignature is returned (wrapped) when a collection's signature does not match its records.
+var ErrBadSignature = errors.New("kintosigner: the signature does not match the collection")
+
+// A Verifier checks that a collection is exactly what Kinto Signer signed, and that it
+// was signed by a key which chains up to a trusted root. That is, the very checks that
+// Firefox performs before it accepts a collection (such as OneCRL).
+type Verifier struct {
+	// The trust anchors that signing chains must lead to. This is required.
+	Roots *x509.CertPool
+	// If set, the leaf certificate of the signing chain must be valid for this name.
+	// E.G. "onecrl.content-signature.mozilla.org".
+	Subject string
+	// The extended key usages that the signing chain must permit. If empty, then any usage is accepted.
+	KeyUsages []x509.ExtKeyUsage
+	// The time at which the chain must be valid. If zero, then the current time is used.
+	CurrentTime time.Time
+	// The client used to download signing chains (see Signature.X5U). If nil, then a client with a
+	// 30 second timeout is used.
+	HTTPClient *http.Client
+}
+
+// NewVerifier constructs a verifier which trusts the given roots and expects
+// the signing certificate to be issued for the given subject (which may be empty).
+func NewVerifier(roots *x509.CertPool, subject string) *Verifier {
+	return &Verifier{Roots: roots, Subject: subject}
+}
+
+// Verify checks that the given signature is valid for the given records, as of the given collection timestamp.
+func (v *Verifier) Verify(ctx context.Context, signature *Signature, records []json.RawMessage, lastModified uint64) error {
+	if signature == nil {
+		return errors.New("kintosigner: the collection is not signed")
+	}
+	payload, err := CanonicalJSON(records, lastModified)
+	if err != nil {
+		return err
+	}
+	chain, err := v.download(ctx, signature.X5U)
+	if err != nil {
+		return err
+	}
+	leaf, err := v.VerifyChain(chain)
+	if err != nil {
+		return err
+	}
+	return VerifyPayload(leaf, signature.Signature, payload)
+}
+
+// VerifyChain parses the given PEM encoded certificate chain (leaf first) and checks that the
+// leaf chains up to one of the verifier's roots. The leaf is returned if it does.
+func (v *Verifier) VerifyChain(chain []byte) (*x509.Certificate, error) {
+	if v.Roots == nil {
+		return nil, errors.New("kintosigner: the verifier has no trust anchors")
+	}
+	certs := make([]*x509.Certificate, 0)
+	for block, rest := pem.Decode(chain); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("kintosigner: the signing chain contains no certificates")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	usages := v.KeyUsages
+	if len(usages) == 0 {
+		usages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       v.Subject,
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   v.CurrentTime,
+		KeyUsages:     usages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kintosigner: the signing chain is not trusted: %w", err)
+	}
+	return certs[0], nil
+}
+
+// VerifyPayload checks the given content signature of the given canonical payload
+// (see CanonicalJSON) against the public key of the given certificate.
+func VerifyPayload(leaf *x509.Certificate, signature string, payload []byte) error {
+	key, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P384() {
+		return errors.New("kintosigner: the signing key is not an ECDSA P-384 key")
+	}
+	raw, err := decodeSignature(signature)
+	if err != nil {
+		return err
+	}
+	if len(raw) != 96 {
+		return fmt.Errorf("kintosigner: expected a 96 byte signature, got %d bytes", len(raw))
+	}
+	r := new(big.Int).SetBytes(raw[:48])
+	s := new(big.Int).SetBytes(raw[48:])
+	digest := sha512.Sum384(append([]byte(contentSignaturePrefix), payload...))
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// decodeSignature decodes the signature, which is URL safe base64 although
+// not consistently so with regard to padding.
+func decodeSignature(signature string) ([]byte, error) {
+	trimmed := strings.TrimRight(signature, "=")
+	if raw, err := base64.RawURLEncoding.DecodeString(trimmed); err == nil {
+		return raw, nil
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("kintosigner: the signature is not base64: %v", err)
+	}
+	return raw, nil
+}
+
+func (v *Verifier) download(ctx context.Context, x5u string) ([]byte, error) {
+	client := v.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 30}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, x5u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kintosigner: expected status code 200 while downloading %s, got %d", x5u, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,252 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kintosigner_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+	"github.com/mozilla/OneCRL-Tools/middleware"
+)
+
+const subject = "onecrl.content-signature.mozilla.org"
+
+func TestCanonicalJSON(t *testing.T) {
+	records := []json.RawMessage{
+		json.RawMessage(`{"id": "b", "last_modified": 2, "details": {"why": "café 😀", "who": "a\"b\\c\nd"}}`),
+		json.RawMessage(`{"id": "c", "last_modified": 3, "deleted": true}`),
+		json.RawMessage(`{"last_modified": 1, "id": "a", "enabled": false, "weight": 1.5, "nothing": null, "list": [2, 1]}`),
+	}
+	got, err := kintosigner.CanonicalJSON(records, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"data":[` +
+		`{"enabled":false,"id":"a","last_modified":1,"list":[2,1],"nothing":null,"weight":1.5},` +
+		`{"details":{"who":"a\"b\\c\nd","why":"caf\u00e9 \ud83d\ude00"},"id":"b","last_modified":2}` +
+		`],"last_modified":"3"}`
+	if string(got) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestCanonicalJSONEmpty(t *testing.T) {
+	got, err := kintosigner.CanonicalJSON(nil, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"data":[],"last_modified":"42"}` {
+		t.Errorf("unexpected canonical JSON %s", got)
+	}
+}
+
+// pki is a throwaway root, intermediate, and content signing leaf, much like those of Autograph.
+type pki struct {
+	roots *x509.CertPool
+	chain []byte
+	key   *ecdsa.PrivateKey
+}
+
+func newPKI(t *testing.T, name string) *pki {
+	rootKey, root := issue(t, nil, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	intermediateKey, intermediate := issue(t, root, rootKey, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	leafKey, leaf := issue(t, intermediate, intermediateKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{name},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	chain := new(bytes.Buffer)
+	for _, cert := range []*x509.Certificate{leaf, intermediate, root} {
+		_ = pem.Encode(chain, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return &pki{roots: roots, chain: chain.Bytes(), key: leafKey}
+}
+
+// issue issues the given template, self signed if the parent is nil.
+func issue(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, template *x509.Certificate) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// sign signs the given records as Kinto Signer (via Autograph) does.
+func (p *pki) sign(t *testing.T, records []json.RawMessage, lastModified uint64) string {
+	payload, err := kintosigner.CanonicalJSON(records, lastModified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha512.Sum384(append([]byte("Content-Signature:\x00"), payload...))
+	r, s, err := ecdsa.Sign(rand.Reader, p.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// r and s are each left padded to 48 bytes.
+	raw := make([]byte, 96)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(raw[48-len(rb):48], rb)
+	copy(raw[96-len(sb):], sb)
+	return base64.URLEncoding.EncodeToString(raw)
+}
+
+func (p *pki) serve(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(p.chain)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+var signed = []json.RawMessage{
+	json.RawMessage(`{"id": "a", "last_modified": 1, "issuerName": "MBIxEDAOBgNVBAMMB1Rlc3QgQ0E=", "serialNumber": "AQ=="}`),
+	json.RawMessage(`{"id": "b", "last_modified": 2, "issuerName": "MBIxEDAOBgNVBAMMB1Rlc3QgQ0E=", "serialNumber": "Ag=="}`),
+}
+
+func TestVerify(t *testing.T) {
+	p := newPKI(t, subject)
+	server := p.serve(t)
+	signature := &kintosigner.Signature{X5U: server.URL, Signature: p.sign(t, signed, 2)}
+	verifier := kintosigner.NewVerifier(p.roots, subject)
+	if err := verifier.Verify(context.Background(), signature, signed, 2); err != nil {
+		t.Fatal(err)
+	}
+	// The order in which records are given, and their tombstones, are irrelevant.
+	reordered := []json.RawMessage{signed[1], json.RawMessage(`{"id": "c", "last_modified": 2, "deleted": true}`), signed[0]}
+	if err := verifier.Verify(context.Background(), signature, reordered, 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	p := newPKI(t, subject)
+	server := p.serve(t)
+	signature := &kintosigner.Signature{X5U: server.URL, Signature: p.sign(t, signed, 2)}
+	verifier := kintosigner.NewVerifier(p.roots, subject)
+	tampered := []json.RawMessage{signed[0], json.RawMessage(strings.Replace(string(signed[1]), "Ag==", "Aw==", 1))}
+	if err := verifier.Verify(context.Background(), signature, tampered, 2); !errors.Is(err, kintosigner.ErrBadSignature) {
+		t.Errorf("expected a bad signature for tampered records, got %v", err)
+	}
+	if err := verifier.Verify(context.Background(), signature, signed[:1], 2); !errors.Is(err, kintosigner.ErrBadSignature) {
+		t.Errorf("expected a bad signature for a missing record, got %v", err)
+	}
+	if err := verifier.Verify(context.Background(), signature, signed, 3); !errors.Is(err, kintosigner.ErrBadSignature) {
+		t.Errorf("expected a bad signature for the wrong timestamp, got %v", err)
+	}
+}
+
+func TestVerifyUntrusted(t *testing.T) {
+	p := newPKI(t, subject)
+	server := p.serve(t)
+	signature := &kintosigner.Signature{X5U: server.URL, Signature: p.sign(t, signed, 2)}
+	other := newPKI(t, subject)
+	err := kintosigner.NewVerifier(other.roots, subject).Verify(context.Background(), signature, signed, 2)
+	if err == nil || errors.Is(err, kintosigner.ErrBadSignature) {
+		t.Errorf("expected an untrusted chain, got %v", err)
+	}
+	err = kintosigner.NewVerifier(p.roots, "intermediates.content-signature.mozilla.org").Verify(context.Background(), signature, signed, 2)
+	if err == nil {
+		t.Error("expected a chain for the wrong subject to be rejected")
+	}
+	verifier := kintosigner.NewVerifier(p.roots, subject)
+	verifier.CurrentTime = time.Now().Add(time.Hour * 24)
+	if err := verifier.Verify(context.Background(), signature, signed, 2); err == nil {
+		t.Error("expected an expired chain to be rejected")
+	}
+}
+
+func TestClientVerifySignature(t *testing.T) {
+	p := newPKI(t, subject)
+	x5u := p.serve(t)
+	signature := &kintosigner.Signature{X5U: x5u.URL, Signature: p.sign(t, signed, 2), Mode: "p384ecdsa"}
+	onecrl := collections.NewCollection(buckets.NewBucket("security-state"), "onecrl")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1" + onecrl.Patch():
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"id": "onecrl", "last_modified": 2, "signature": signature},
+			})
+		case "/v1" + onecrl.Get():
+			w.Header().Set("ETag", `"2"`)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": []json.RawMessage{signed[1], signed[0]}})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client, err := kinto.NewClientFromStr(server.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains := 0
+	client.WithMiddleware(middleware.Observe(func(r *http.Request, _ *http.Response, _ error, _ time.Duration) {
+		if strings.HasPrefix(x5u.URL, "http://"+r.URL.Host) {
+			chains++
+		}
+	}))
+	verifier := kintosigner.NewVerifier(p.roots, subject)
+	if err := client.VerifySignature(onecrl, verifier); err != nil {
+		t.Fatal(err)
+	}
+	if chains != 1 {
+		t.Errorf("expected the signing chain to be downloaded by the client's own HTTP client, saw %d downloads", chains)
+	}
+	if verifier.HTTPClient != nil {
+		t.Error("expected the given verifier to be left unmodified")
+	}
+}
@@ -0,0 +1,161 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/query"
+)
+
+func TestQueryParameters(t *testing.T) {
+	q := query.New(NewOneCRL()).
+		Eq("details.bug", "1234").
+		NotEq("enabled", false).
+		In("id", "a", "b").
+		NotIn("serialNumber", "c").
+		Gt("last_modified", 10).
+		Lt("schema", 20).
+		Min("a", 1).
+		Max("b", 2).
+		Like("issuerName", "*Let's Encrypt*").
+		Has("subject").
+		HasNot("pubKeyHash").
+		Sort("-last_modified", "id").
+		Fields("issuerName", "serialNumber").
+		Limit(50)
+	want := map[string]string{
+		"details.bug":          `"1234"`,
+		"not_enabled":          `false`,
+		"in_id":                `"a","b"`,
+		"exclude_serialNumber": `"c"`,
+		"gt_last_modified":     `10`,
+		"lt_schema":            `20`,
+		"min_a":                `1`,
+		"max_b":                `2`,
+		"like_issuerName":      `*Let's Encrypt*`,
+		"has_subject":          `true`,
+		"has_pubKeyHash":       `false`,
+		"_sort":                `-last_modified,id`,
+		"_fields":              `issuerName,serialNumber`,
+		"_limit":               `50`,
+	}
+	got := q.Values()
+	if len(got) != len(want) {
+		t.Errorf("expected %d parameters, got %d: %v", len(want), len(got), got)
+	}
+	for key, value := range want {
+		if got.Get(key) != value {
+			t.Errorf("expected %s=%s, got %s", key, value, got.Get(key))
+		}
+	}
+	u, err := url.Parse(q.Get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != NewOneCRL().Get() {
+		t.Errorf("expected the collection's path, got %s", u.Path)
+	}
+}
+
+func TestAllRecordsWithQuery(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("serialNumber"); got != `"42"` {
+			t.Errorf(`expected serialNumber="42", got %s`, got)
+		}
+		_, _ = w.Write([]byte(`{"data": [{"id": "a", "last_modified": 1, "serialNumber": "42"}]}`))
+	}))
+	collection := NewOneCRL()
+	if err := c.AllRecords(query.New(collection).Eq("serialNumber", "42")); err != nil {
+		t.Fatal(err)
+	}
+	if len(collection.Data) != 1 || collection.Data[0].SerialNumber != "42" {
+		t.Fatalf("expected the wrapped collection to be filled, got %v", collection.Data)
+	}
+}
+
+func TestQueryRejectsCommas(t *testing.T) {
+	requests := 0
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}))
+	if err := query.New(NewOneCRL()).In("id", "a", "b").Err(); err != nil {
+		t.Errorf("expected values without commas to be accepted, got %v", err)
+	}
+	for _, q := range []*query.Query{
+		query.New(NewOneCRL()).In("details.name", "Acme, Inc.", "Tribute"),
+		query.New(NewOneCRL()).NotIn("details.bug", []int{1, 2}),
+	} {
+		if q.Err() == nil {
+			t.Errorf("expected %s to be rejected", q.Get())
+		}
+		if err := c.AllRecords(q); err == nil {
+			t.Errorf("expected AllRecords to refuse %s", q.Get())
+		}
+		if _, err := c.CountRecords(q); err == nil {
+			t.Errorf("expected CountRecords to refuse %s", q.Get())
+		}
+	}
+	if requests != 0 {
+		t.Errorf("expected no requests to be sent, got %d", requests)
+	}
+}
+
+func TestGetRecord(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1"+NewOneCRL().Get()+"/a" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("_fields"); got != "serialNumber" {
+			t.Errorf("expected the field selection to be kept, got %s", got)
+		}
+		if got := r.URL.Query().Get("enabled"); got != "" {
+			t.Errorf("expected filters to be dropped, got %s", got)
+		}
+		_, _ = w.Write([]byte(`{"data": {"id": "a", "last_modified": 1, "serialNumber": "42"}}`))
+	}))
+	record := new(OneCRLRecord)
+	q := query.New(NewOneCRL()).Eq("enabled", true).Fields("serialNumber")
+	if err := c.GetRecord(q, "a", record); err != nil {
+		t.Fatal(err)
+	}
+	if record.ID() != "a" || record.SerialNumber != "42" {
+		t.Errorf("unexpected record %v", record)
+	}
+}
+
+func TestGetRecordNotFound(t *testing.T) {
+	c := testClient(t, failing(http.StatusNotFound, `{"code": 404, "errno": 110, "error": "Not Found"}`))
+	err := c.GetRecord(NewOneCRL(), "a", new(OneCRLRecord))
+	if !IsNotFound(err) {
+		t.Fatalf("expected a 404, got %v", err)
+	}
+}
+
+func TestCountRecords(t *testing.T) {
+	for _, header := range []string{"Total-Objects", "Total-Records"} {
+		t.Run(header, func(t *testing.T) {
+			c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead {
+					t.Errorf("expected a HEAD, got %s", r.Method)
+				}
+				if got := r.URL.Query().Get("gt_last_modified"); got != "10" {
+					t.Errorf("expected the query to be sent, got %s", got)
+				}
+				w.Header().Set(header, "17")
+			}))
+			count, err := c.CountRecords(query.New(NewOneCRL()).Gt("last_modified", 10))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 17 {
+				t.Errorf("expected 17 records, got %d", count)
+			}
+		})
+	}
+}
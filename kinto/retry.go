@@ -0,0 +1,183 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A RetryPolicy describes which failed requests may be safely retried, how many times,
+// and how long to wait between each attempt.
+//
+// Delays between attempts grow exponentially from BaseDelay (doubling on each attempt)
+// up to MaxDelay, with a random jitter applied so that many clients failing at once do
+// not all come back at once. If Kinto responds with a Retry-After header, then that value
+// is used instead whenever it is longer than the computed delay.
+//
+// For details on Kinto's retry semantics, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/backoff.html
+type RetryPolicy struct {
+	// The total number of attempts made for a single request, including the first.
+	// A value of one (or less) disables retries.
+	MaxAttempts int
+	// The delay before the first retry.
+	BaseDelay time.Duration
+	// The upper bound on any computed delay between attempts.
+	MaxDelay time.Duration
+	// The longest Retry-After that this policy is willing to wait out. Responses that ask
+	// us to come back later than this are not retried and are instead returned to the caller.
+	MaxRetryAfter time.Duration
+	// The HTTP methods which are safe to retry. Requests using any other
+	// method are never retried.
+	Methods map[string]bool
+	// The HTTP status codes which are considered transient.
+	Statuses map[int]bool
+}
+
+// DefaultRetryPolicy returns the policy that every newly constructed Client uses.
+//
+// Only idempotent methods are retried, as a POST (or PATCH) that timed out or
+// received a 503 may very well have been applied by Kinto anyways. DELETE is
+// left out as well, since a retried deletion that had in fact been applied
+// comes back as a 404 rather than as the success it was. Connection errors
+// (E.G. resets) are retried for these methods as well.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:   4,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Second * 30,
+		MaxRetryAfter: time.Minute * 2,
+		Methods: map[string]bool{
+			http.MethodGet:     true,
+			http.MethodHead:    true,
+			http.MethodOptions: true,
+			http.MethodPut:     true,
+		},
+		Statuses: map[int]bool{
+			http.StatusTooManyRequests:    true,
+			http.StatusBadGateway:         true,
+			http.StatusServiceUnavailable: true,
+			http.StatusGatewayTimeout:     true,
+		},
+	}
+}
+
+// NoRetries returns a policy which never retries a request.
+func NoRetries() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 1}
+}
+
+// next reports whether the given attempt may be retried and, if so, how long
+// to wait before doing so.
+//
+// An error that arrives alongside a response (E.G. a Backoff header that did not parse)
+// means that Kinto did answer, and so it is never retried.
+func (p *RetryPolicy) next(attempt int, r *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts || !p.Methods[r.Method] {
+		return 0, false
+	}
+	if r.Context().Err() != nil {
+		// Our own cancellation or deadline, which is never transient.
+		return 0, false
+	}
+	if r.Body != nil && r.GetBody == nil {
+		// The body has already been consumed and we have no way of rewinding it.
+		return 0, false
+	}
+	if err != nil && resp != nil {
+		return 0, false
+	}
+	delay := p.delay(attempt)
+	if err != nil {
+		return delay, true
+	}
+	if !p.Statuses[resp.StatusCode] {
+		return 0, false
+	}
+	if after, ok := retryAfter(resp); ok {
+		if after > p.MaxRetryAfter {
+			return 0, false
+		}
+		if after > delay {
+			delay = after
+		}
+	}
+	return delay, true
+}
+
+// delay returns the jittered, exponentially increasing, delay for the given attempt.
+//
+// The returned value lies within [d/2, d) where d = min(BaseDelay * 2^(attempt-1), MaxDelay).
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// retryAfter parses the Retry-After header, which may be either a number of
+// seconds or an HTTP date.
+//
+// See https://tools.ietf.org/html/rfc7231#section-7.1.3
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Second * time.Duration(seconds), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		after := time.Until(date)
+		if after < 0 {
+			after = 0
+		}
+		return after, true
+	}
+	return 0, false
+}
+
+// rewind returns a copy of the given request with a fresh body
+// so that it may be sent again.
+func rewind(r *http.Request) (*http.Request, error) {
+	again := r.Clone(r.Context())
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		again.Body = body
+	}
+	return again, nil
+}
+
+// sleep waits for the given duration, or until the context is done (whichever is first).
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
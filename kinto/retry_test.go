@@ -0,0 +1,231 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api"
+)
+
+// fastRetries is the default policy, but with delays short enough for tests.
+func fastRetries() *RetryPolicy {
+	p := DefaultRetryPolicy()
+	p.BaseDelay = time.Millisecond
+	p.MaxDelay = time.Millisecond * 10
+	return p
+}
+
+// flaky fails the first n requests with the given status
+// before responding with an empty records list.
+func flaky(n, status int, header http.Header) (http.Handler, *int) {
+	requests := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= n {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}), &requests
+}
+
+func TestRetryOn503(t *testing.T) {
+	handler, requests := flaky(2, http.StatusServiceUnavailable, nil)
+	c := testClient(t, handler).WithRetryPolicy(fastRetries())
+	if err := c.AllRecords(NewOneCRL()); err != nil {
+		t.Fatal(err)
+	}
+	if *requests != 3 {
+		t.Errorf("expected 3 requests, got %d", *requests)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	handler, requests := flaky(10, http.StatusServiceUnavailable, nil)
+	c := testClient(t, handler).WithRetryPolicy(fastRetries())
+	if err := c.AllRecords(NewOneCRL()); err == nil {
+		t.Fatal("expected an error after exhausting all attempts")
+	}
+	if *requests != 4 {
+		t.Errorf("expected 4 requests, got %d", *requests)
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	handler, requests := flaky(1, http.StatusBadRequest, nil)
+	c := testClient(t, handler).WithRetryPolicy(fastRetries())
+	if err := c.AllRecords(NewOneCRL()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestNoRetryOnUnsafeMethod(t *testing.T) {
+	handler, requests := flaky(1, http.StatusServiceUnavailable, nil)
+	c := testClient(t, handler).WithRetryPolicy(fastRetries())
+	if err := c.NewRecord(NewOneCRL(), &OneCRLRecord{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestNoRetryOnDelete(t *testing.T) {
+	handler, requests := flaky(1, http.StatusServiceUnavailable, nil)
+	c := testClient(t, handler).WithRetryPolicy(fastRetries())
+	if _, err := c.Delete(NewOneCRL(), &api.Record{Id: "id"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestNoRetryOnMalformedBackoff(t *testing.T) {
+	handler, requests := flaky(1, http.StatusServiceUnavailable, http.Header{"Backoff": []string{"soon"}})
+	c := testClient(t, handler).WithRetryPolicy(fastRetries())
+	if err := c.AllRecords(NewOneCRL()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	requests := 0
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(b) == 0 {
+			t.Errorf("request %d had an empty body", requests)
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {}}`))
+	}))
+	policy := fastRetries()
+	policy.Methods[http.MethodPost] = true
+	c.WithRetryPolicy(policy)
+	if err := c.NewRecord(NewOneCRL(), &OneCRLRecord{IssuerName: "issuer"}); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	handler, requests := flaky(1, http.StatusTooManyRequests, http.Header{"Retry-After": []string{"1"}})
+	c := testClient(t, handler).WithRetryPolicy(fastRetries())
+	start := time.Now()
+	if err := c.AllRecords(NewOneCRL()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected Retry-After to be honored, only waited %s", elapsed)
+	}
+	if *requests != 2 {
+		t.Errorf("expected 2 requests, got %d", *requests)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	handler, requests := flaky(1, http.StatusServiceUnavailable, http.Header{"Retry-After": []string{"3600"}})
+	c := testClient(t, handler).WithRetryPolicy(fastRetries())
+	if err := c.AllRecords(NewOneCRL()); err == nil {
+		t.Fatal("expected an error rather than waiting for an hour")
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestRetryOnConnectionError(t *testing.T) {
+	// Grab a port that nothing is listening on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	c := NewClient("http", addr, "/v1").WithRetryPolicy(fastRetries())
+	served := make(chan struct{})
+	go func() {
+		// Start listening after the first attempt has surely failed.
+		time.Sleep(time.Millisecond * 20)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			close(served)
+			return
+		}
+		defer l.Close()
+		handler, _ := flaky(0, 0, nil)
+		server := &http.Server{Handler: handler}
+		go func() { _ = server.Serve(l) }()
+		<-served
+		_ = server.Close()
+	}()
+	policy := fastRetries()
+	policy.BaseDelay = time.Millisecond * 20
+	policy.MaxAttempts = 10
+	c.WithRetryPolicy(policy)
+	err = c.AllRecords(NewOneCRL())
+	close(served)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackoffIsInSeconds(t *testing.T) {
+	requests := 0
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Backoff", "1")
+		}
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}))
+	if err := c.AllRecords(NewOneCRL()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := c.AllRecords(NewOneCRL()); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < time.Second || elapsed > time.Second*5 {
+		t.Errorf("expected to backoff for one second, backed off for %s", elapsed)
+	}
+}
+
+func TestRetryDelayIsBounded(t *testing.T) {
+	p := DefaultRetryPolicy()
+	for attempt := 1; attempt < 20; attempt++ {
+		d := p.delay(attempt)
+		if d > p.MaxDelay || d < 0 {
+			t.Errorf("attempt %d: delay %s is out of bounds", attempt, d)
+		}
+	}
+	if d := p.delay(1); d < p.BaseDelay/2 || d >= p.BaseDelay {
+		t.Errorf("the first delay %s should be within [%s, %s)", d, p.BaseDelay/2, p.BaseDelay)
+	}
+}
@@ -0,0 +1,162 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintoattachment"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintohistory"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+// The names under which plugins advertise themselves within the capabilities of the server.
+const (
+	AccountsCapability    = "accounts"
+	AttachmentsCapability = "attachments"
+	HistoryCapability     = "history"
+	SignerCapability      = "signer"
+)
+
+// ServerInfo is the server's root resource, which describes the server itself,
+// its settings, its plugins, and (if authenticated) the current user.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/utilities.html#api-utilities
+type ServerInfo struct {
+	ProjectName    string       `json:"project_name"`
+	ProjectVersion string       `json:"project_version"`
+	ProjectDocs    string       `json:"project_docs"`
+	HTTPAPIVersion string       `json:"http_api_version"`
+	URL            string       `json:"url"`
+	Settings       Settings     `json:"settings"`
+	Capabilities   Capabilities `json:"capabilities"`
+	// Nil if the request was not authenticated.
+	User *User `json:"user,omitempty"`
+}
+
+type Settings struct {
+	BatchMaxRequests      int  `json:"batch_max_requests"`
+	Readonly              bool `json:"readonly"`
+	ExplicitPermissions   bool `json:"explicit_permissions"`
+	TrailingSlashRedirect bool `json:"trailing_slash_redirect"`
+}
+
+// User is the account that the server authenticated the request as.
+type User struct {
+	// E.G. "account:admin"
+	ID string `json:"id"`
+	// The principals of the user, which are its ID, the groups it belongs to, and the
+	// "system.Authenticated" and "system.Everyone" principals.
+	Principals []string `json:"principals"`
+	// The ID of the user's personal bucket, if the default bucket plugin is enabled.
+	Bucket string `json:"bucket,omitempty"`
+}
+
+// Capability is the entry of any plugin within the capabilities of the server.
+type Capability struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Version     string `json:"version,omitempty"`
+}
+
+// Capabilities is every plugin that the server advertises. The plugins that this
+// client knows how to use are decoded into their own types, and every plugin
+// (including those) is also available by name via All.
+type Capabilities struct {
+	Accounts    *Capability
+	Attachments *kintoattachment.Capability
+	History     *kintohistory.Capability
+	Signer      *kintosigner.Capability
+	All         map[string]*Capability
+}
+
+func (c *Capabilities) UnmarshalJSON(b []byte) error {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	c.All = make(map[string]*Capability, len(raw))
+	for name, capability := range raw {
+		c.All[name] = new(Capability)
+		if err := json.Unmarshal(capability, c.All[name]); err != nil {
+			return fmt.Errorf("malformed %s capability: %v", name, err)
+		}
+	}
+	typed := map[string]interface{}{
+		AccountsCapability:    &c.Accounts,
+		AttachmentsCapability: &c.Attachments,
+		HistoryCapability:     &c.History,
+		SignerCapability:      &c.Signer,
+	}
+	for name, target := range typed {
+		if capability, ok := raw[name]; ok {
+			if err := json.Unmarshal(capability, target); err != nil {
+				return fmt.Errorf("malformed %s capability: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c Capabilities) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.All)
+}
+
+// Has returns whether the server advertises the given capability (E.G. SignerCapability).
+func (s *ServerInfo) Has(capability string) bool {
+	_, ok := s.Capabilities.All[capability]
+	return ok
+}
+
+// Require returns an error listing every one of the given capabilities that the server does not advertise, if any.
+// Tools may use this in order to bail out before starting a run, rather than failing halfway through it.
+func (s *ServerInfo) Require(capabilities ...string) error {
+	missing := make([]string, 0)
+	for _, capability := range capabilities {
+		if !s.Has(capability) {
+			missing = append(missing, capability)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("%s does not advertise the required capabilities: %s", s.URL, strings.Join(missing, ", "))
+}
+
+// Authenticated returns whether the server authenticated the request.
+func (s *ServerInfo) Authenticated() bool {
+	return s.User != nil
+}
+
+// ServerInfo retrieves the server's root resource.
+//
+// For details, please see:
+// https://docs.kinto-storage.org/en/stable/api/1.x/utilities.html#api-utilities
+func (c *Client) ServerInfo() (*ServerInfo, error) {
+	return c.ServerInfoContext(context.Background())
+}
+
+// ServerInfoContext is the same as ServerInfo, however the request is bound to the given context.
+func (c *Client) ServerInfoContext(ctx context.Context) (*ServerInfo, error) {
+	r, err := c.newRequest(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+	info := new(ServerInfo)
+	if err := c.do(r, info, ok); err != nil {
+		return nil, err
+	}
+	if info.URL == "" {
+		info.URL = fmt.Sprintf("%s://%s%s/", c.scheme, c.host, c.base)
+	}
+	return info, nil
+}
@@ -0,0 +1,101 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// remoteSettings is an abridged root resource of a Remote Settings server.
+const remoteSettings = `{
+	"project_name": "Remote Settings PROD",
+	"project_version": "13.6.5",
+	"http_api_version": "1.22",
+	"project_docs": "https://remote-settings.readthedocs.io",
+	"url": "https://remote-settings.mozilla.org/v1/",
+	"settings": {
+		"batch_max_requests": 25,
+		"readonly": false,
+		"explicit_permissions": false,
+		"trailing_slash_redirect": true
+	},
+	"capabilities": {
+		"accounts": {"description": "Manage user accounts.", "url": "https://kinto.readthedocs.io/en/latest/api/1.x/accounts.html"},
+		"attachments": {"description": "Add file attachments to records", "url": "https://github.com/Kinto/kinto-attachment/", "version": "6.1.0", "base_url": "https://firefox-settings-attachments.cdn.mozilla.net/"},
+		"history": {"description": "Track changes on data.", "url": "http://kinto.readthedocs.io/en/latest/api/1.x/history.html"},
+		"signer": {
+			"to_review_enabled": true,
+			"resources": [{
+				"source": {"bucket": "security-state-staging", "collection": "onecrl"},
+				"preview": {"bucket": "security-state-preview", "collection": "onecrl"},
+				"destination": {"bucket": "security-state", "collection": "onecrl"}
+			}]
+		},
+		"changes": {"description": "Track modifications of records in Kinto and store the collection timestamps into a specific bucket and collection.", "url": "http://kinto.readthedocs.io/en/latest/tutorials/synchronisation.html#polling-for-remote-changes", "version": "13.6.5"}
+	},
+	"user": {"id": "account:admin", "principals": ["account:admin", "system.Authenticated", "system.Everyone"]}
+}`
+
+func TestServerInfo(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/" {
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+		_, _ = w.Write([]byte(remoteSettings))
+	}))
+	info, err := c.ServerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ProjectVersion != "13.6.5" || info.Settings.BatchMaxRequests != 25 || !info.Authenticated() || len(info.User.Principals) != 3 {
+		t.Errorf("unexpected server info %+v", info)
+	}
+	if info.Capabilities.Attachments.BaseURL != "https://firefox-settings-attachments.cdn.mozilla.net/" {
+		t.Errorf("unexpected attachments capability %+v", info.Capabilities.Attachments)
+	}
+	if resource, ok := info.Capabilities.Signer.Resource("security-state", "onecrl"); !ok || resource.Preview.Bucket != "security-state-preview" {
+		t.Errorf("unexpected signer capability %+v", info.Capabilities.Signer)
+	}
+	if info.Capabilities.History == nil || info.Capabilities.Accounts == nil {
+		t.Error("expected the history and accounts capabilities")
+	}
+	// Plugins that this client has no type for are still listed.
+	if !info.Has("changes") || info.Capabilities.All["changes"].Version != "13.6.5" {
+		t.Errorf("expected the changes capability, got %v", info.Capabilities.All)
+	}
+	if err := info.Require(SignerCapability, HistoryCapability); err != nil {
+		t.Error(err)
+	}
+	err = info.Require("quotas", SignerCapability, "admin")
+	if err == nil || !strings.HasSuffix(err.Error(), "admin, quotas") {
+		t.Errorf("expected the missing capabilities to be listed, got %v", err)
+	}
+}
+
+func TestServerInfoAnonymous(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"project_name": "kinto", "settings": {"batch_max_requests": 25}, "capabilities": {}}`))
+	}))
+	info, err := c.ServerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Authenticated() || info.Has(SignerCapability) {
+		t.Errorf("unexpected server info %+v", info)
+	}
+	if !strings.HasSuffix(info.URL, "/v1/") {
+		t.Errorf("expected the URL to default to that of the client, got %s", info.URL)
+	}
+	authed, err := c.TryAuth()
+	if err != nil || authed {
+		t.Errorf("expected an anonymous session, got %v %v", authed, err)
+	}
+	max, err := c.BatchMaxRequests()
+	if err != nil || max != 25 {
+		t.Errorf("expected 25 batch requests, got %d %v", max, err)
+	}
+}
@@ -0,0 +1,220 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+// SignerTriplet is the collections through which changes flow in the Kinto Signer workflow. Changes are
+// made to the source, copied to the preview when a review is requested, and copied to the destination
+// (which is what Firefox downloads) once the review is approved.
+type SignerTriplet struct {
+	Source *collections.Collection
+	// Nil if reviews are not enabled for the collection.
+	Preview     *collections.Collection
+	Destination *collections.Collection
+}
+
+// SignerTriplet resolves the source, preview, and destination of the given collection (which may be any
+// one of the three) from the Kinto Signer capability of the server.
+//
+// For details, please see:
+// https://github.com/Kinto/kinto-signer#configuration
+func (c *Client) SignerTriplet(collection *collections.Collection) (*SignerTriplet, error) {
+	return c.SignerTripletContext(context.Background(), collection)
+}
+
+// SignerTripletContext is the same as SignerTriplet, however the request is bound to the given context.
+func (c *Client) SignerTripletContext(ctx context.Context, collection *collections.Collection) (*SignerTriplet, error) {
+	info, err := c.ServerInfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if info.Capabilities.Signer == nil {
+		return nil, fmt.Errorf("%s does not advertise the signer capability", info.URL)
+	}
+	resource, found := info.Capabilities.Signer.Resource(collection.Bucket.ID, collection.ID)
+	if !found {
+		return nil, fmt.Errorf("%s is not signed by %s", collection.Patch(), info.URL)
+	}
+	return newSignerTriplet(resource), nil
+}
+
+func newSignerTriplet(resource *kintosigner.Resource) *SignerTriplet {
+	location := func(l kintosigner.Location) *collections.Collection {
+		return collections.NewCollection(buckets.NewBucket(l.Bucket), l.Collection)
+	}
+	triplet := &SignerTriplet{Source: location(resource.Source), Destination: location(resource.Destination)}
+	if resource.Preview != nil {
+		triplet.Preview = location(*resource.Preview)
+	}
+	return triplet
+}
+
+// A RecordDiff is what would change downstream (E.G. in the destination) were upstream (E.G. the source) copied over it.
+type RecordDiff struct {
+	// Records that are upstream but not downstream.
+	Added []json.RawMessage
+	// Records that are downstream but not upstream.
+	Removed []json.RawMessage
+	// Records that are in both, but differ (beyond their last_modified).
+	Changed []*RecordChange
+}
+
+// RecordChange is a single record as it is upstream and downstream.
+type RecordChange struct {
+	ID         string
+	Upstream   json.RawMessage
+	Downstream json.RawMessage
+}
+
+// Empty returns whether upstream and downstream hold the same records.
+func (d *RecordDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffRecords compares the given records by ID. Each list of the diff is sorted by ID. Records are compared
+// by content, ignoring their last_modified, as that may legitimately differ between collections.
+func DiffRecords(upstream, downstream []json.RawMessage) (*RecordDiff, error) {
+	up, err := byID(upstream)
+	if err != nil {
+		return nil, err
+	}
+	down, err := byID(downstream)
+	if err != nil {
+		return nil, err
+	}
+	diff := &RecordDiff{Added: make([]json.RawMessage, 0), Removed: make([]json.RawMessage, 0), Changed: make([]*RecordChange, 0)}
+	for _, id := range sortedIDs(up) {
+		u := up[id]
+		d, ok := down[id]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, u.raw)
+		case !bytes.Equal(u.content, d.content):
+			diff.Changed = append(diff.Changed, &RecordChange{ID: id, Upstream: u.raw, Downstream: d.raw})
+		}
+	}
+	for _, id := range sortedIDs(down) {
+		if _, ok := up[id]; !ok {
+			diff.Removed = append(diff.Removed, down[id].raw)
+		}
+	}
+	return diff, nil
+}
+
+type indexed struct {
+	raw json.RawMessage
+	// The record without its last_modified, re-encoded with sorted keys.
+	content []byte
+}
+
+func byID(records []json.RawMessage) (map[string]*indexed, error) {
+	index := make(map[string]*indexed, len(records))
+	for _, raw := range records {
+		record := make(map[string]interface{})
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return nil, err
+		}
+		if deleted, _ := record["deleted"].(bool); deleted {
+			continue
+		}
+		id, _ := record["id"].(string)
+		delete(record, "last_modified")
+		content, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		index[id] = &indexed{raw: raw, content: content}
+	}
+	return index, nil
+}
+
+func sortedIDs(index map[string]*indexed) []string {
+	ids := make([]string, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SignerDiff is how the collections of a SignerTriplet differ from one another.
+type SignerDiff struct {
+	Triplet *SignerTriplet
+	// What has been changed in the source since the last review was requested. That is, changes that
+	// nobody has been asked to review yet. Nil if reviews are not enabled for the collection.
+	Unrequested *RecordDiff
+	// What will be published should the pending review be approved. That is, the changes under review.
+	// If reviews are not enabled for the collection, then this is how the source differs from the destination.
+	InReview *RecordDiff
+	// What has been changed in the source but is not yet published, whether or not it is in review.
+	Unpublished *RecordDiff
+}
+
+// Published returns whether the destination holds exactly what is in the source. That is, whether every change has landed.
+func (s *SignerDiff) Published() bool {
+	return s.Unpublished.Empty()
+}
+
+// DiffSigner resolves the signer triplet of the given collection (see SignerTriplet) and reports how
+// the records of the source, preview, and destination differ. Reviewers may use this to see what they are
+// approving, and editors to confirm that their changes were published.
+func (c *Client) DiffSigner(collection *collections.Collection) (*SignerDiff, error) {
+	return c.DiffSignerContext(context.Background(), collection)
+}
+
+// DiffSignerContext is the same as DiffSigner, however the requests are bound to the given context.
+func (c *Client) DiffSignerContext(ctx context.Context, collection *collections.Collection) (*SignerDiff, error) {
+	triplet, err := c.SignerTripletContext(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	source, err := c.rawRecords(ctx, triplet.Source)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := c.rawRecords(ctx, triplet.Destination)
+	if err != nil {
+		return nil, err
+	}
+	diff := &SignerDiff{Triplet: triplet}
+	if diff.Unpublished, err = DiffRecords(source, destination); err != nil {
+		return nil, err
+	}
+	if triplet.Preview == nil {
+		diff.InReview = diff.Unpublished
+		return diff, nil
+	}
+	preview, err := c.rawRecords(ctx, triplet.Preview)
+	if err != nil {
+		return nil, err
+	}
+	if diff.Unrequested, err = DiffRecords(source, preview); err != nil {
+		return nil, err
+	}
+	if diff.InReview, err = DiffRecords(preview, destination); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+func (c *Client) rawRecords(ctx context.Context, collection *collections.Collection) ([]json.RawMessage, error) {
+	records := make([]json.RawMessage, 0)
+	err := c.StreamRecordsContext(ctx, collection, func(record json.RawMessage) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
@@ -0,0 +1,163 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/kinto/api/buckets"
+	"github.com/mozilla/OneCRL-Tools/kinto/api/collections"
+	"github.com/mozilla/OneCRL-Tools/kinto/plugins/kintosigner"
+)
+
+// signerServer serves the signer metadata of a single collection, applying any PATCH to it.
+func signerServer(t *testing.T, status *kintosigner.KintoStatus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			patch := new(kintosigner.Status)
+			if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+				t.Error(err)
+				return
+			}
+			status.Status = patch.Data.Status
+			status.LastEditorComment = patch.Data.LastEditorComment
+			status.LastReviewerComment = patch.Data.LastReviewerComment
+		}
+		_ = json.NewEncoder(w).Encode(kintosigner.Status{Data: *status})
+	})
+}
+
+func TestReviewWithComments(t *testing.T) {
+	status := &kintosigner.KintoStatus{Status: kintosigner.StatusWorkInProgress}
+	c := testClient(t, signerServer(t, status))
+	if err := c.DeclineReview(NewOneCRL(), "nothing to review"); err == nil {
+		t.Error("expected declining a collection that is not in review to fail")
+	}
+	if err := c.ToReviewWithComment(NewOneCRL(), "Bug 1234"); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != kintosigner.StatusToReview || status.LastEditorComment != "Bug 1234" {
+		t.Errorf("unexpected status %v", status)
+	}
+	if err := c.DeclineReview(NewOneCRL(), "Wrong serial"); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != kintosigner.StatusWorkInProgress || status.LastReviewerComment != "Wrong serial" {
+		t.Errorf("unexpected status %v", status)
+	}
+}
+
+const signerCapability = `{"capabilities": {"signer": {
+	"to_review_enabled": true,
+	"resources": [
+		{
+			"source": {"bucket": "main-workspace", "collection": null},
+			"preview": {"bucket": "main-preview", "collection": null},
+			"destination": {"bucket": "main", "collection": null}
+		},
+		{
+			"source": {"bucket": "security-state-staging", "collection": "onecrl"},
+			"preview": {"bucket": "security-state-preview", "collection": "onecrl"},
+			"destination": {"bucket": "security-state", "collection": "onecrl"}
+		},
+		{
+			"source": {"bucket": "security-state-staging", "collection": "intermediates"},
+			"destination": {"bucket": "security-state", "collection": "intermediates"}
+		}
+	]
+}}}`
+
+// tripletServer serves the signer capability above, along with the given records of each collection (keyed by bucket).
+func tripletServer(t *testing.T, records map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/" {
+			_, _ = w.Write([]byte(signerCapability))
+			return
+		}
+		for bucket, data := range records {
+			if r.URL.Path == "/v1/buckets/"+bucket+"/collections/onecrl/records" {
+				_, _ = w.Write([]byte(`{"data": ` + data + `}`))
+				return
+			}
+		}
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	})
+}
+
+func TestSignerTriplet(t *testing.T) {
+	c := testClient(t, tripletServer(t, nil))
+	for _, test := range []struct {
+		collection                   *collections.Collection
+		source, preview, destination string
+	}{
+		{NewOneCRL().Collection, "/buckets/security-state-staging/collections/onecrl", "/buckets/security-state-preview/collections/onecrl", "/buckets/security-state/collections/onecrl"},
+		{collections.NewCollection(buckets.NewBucket("security-state-preview"), "onecrl"), "/buckets/security-state-staging/collections/onecrl", "/buckets/security-state-preview/collections/onecrl", "/buckets/security-state/collections/onecrl"},
+		{collections.NewCollection(buckets.NewBucket("main"), "cfr"), "/buckets/main-workspace/collections/cfr", "/buckets/main-preview/collections/cfr", "/buckets/main/collections/cfr"},
+		{collections.NewCollection(buckets.NewBucket("security-state"), "intermediates"), "/buckets/security-state-staging/collections/intermediates", "", "/buckets/security-state/collections/intermediates"},
+	} {
+		triplet, err := c.SignerTriplet(test.collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		preview := ""
+		if triplet.Preview != nil {
+			preview = triplet.Preview.Patch()
+		}
+		if triplet.Source.Patch() != test.source || preview != test.preview || triplet.Destination.Patch() != test.destination {
+			t.Errorf("%s: unexpected triplet %s, %s, %s", test.collection.Patch(), triplet.Source.Patch(), preview, triplet.Destination.Patch())
+		}
+	}
+	if _, err := c.SignerTriplet(collections.NewCollection(buckets.NewBucket("blocklists"), "addons")); err == nil {
+		t.Error("expected an unsigned collection to be rejected")
+	}
+}
+
+func TestDiffSigner(t *testing.T) {
+	c := testClient(t, tripletServer(t, map[string]string{
+		// "c" was changed in the source after the review was requested, and "d" was added.
+		"security-state-staging": `[
+			{"id": "a", "last_modified": 30, "enabled": true},
+			{"id": "c", "last_modified": 31, "enabled": true},
+			{"id": "d", "last_modified": 32, "enabled": false}
+		]`,
+		// Review requested for adding "c" and removing "b".
+		"security-state-preview": `[
+			{"id": "a", "last_modified": 20, "enabled": true},
+			{"id": "c", "last_modified": 20, "enabled": false}
+		]`,
+		"security-state": `[
+			{"id": "a", "last_modified": 10, "enabled": true},
+			{"id": "b", "last_modified": 10, "enabled": true}
+		]`,
+	}))
+	diff, err := c.DiffSigner(NewOneCRL().Collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := func(records []json.RawMessage) string {
+		list := make([]string, len(records))
+		for i, record := range records {
+			r := new(OneCRLRecord)
+			if err := json.Unmarshal(record, r); err != nil {
+				t.Fatal(err)
+			}
+			list[i] = r.Id
+		}
+		return strings.Join(list, ",")
+	}
+	if ids(diff.Unrequested.Added) != "d" || len(diff.Unrequested.Removed) != 0 || len(diff.Unrequested.Changed) != 1 || diff.Unrequested.Changed[0].ID != "c" {
+		t.Errorf("unexpected unrequested changes %v", diff.Unrequested)
+	}
+	if ids(diff.InReview.Added) != "c" || ids(diff.InReview.Removed) != "b" || len(diff.InReview.Changed) != 0 {
+		t.Errorf("unexpected changes in review %v", diff.InReview)
+	}
+	if ids(diff.Unpublished.Added) != "c,d" || ids(diff.Unpublished.Removed) != "b" || diff.Published() {
+		t.Errorf("unexpected unpublished changes %v", diff.Unpublished)
+	}
+}
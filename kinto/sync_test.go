@@ -0,0 +1,133 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package kinto
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestSyncRecordsEverything(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Query()) != 0 {
+			t.Errorf("expected no query for a first sync, got %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("If-None-Match") != "" {
+			t.Errorf("expected no If-None-Match for a first sync, got %s", r.Header.Get("If-None-Match"))
+		}
+		w.Header().Set("ETag", `"30"`)
+		_, _ = w.Write([]byte(`{"data": [
+			{"id": "b", "last_modified": 30, "serialNumber": "2"},
+			{"id": "a", "last_modified": 20, "serialNumber": "1"}
+		]}`))
+	}))
+	changes, err := c.SyncRecords(NewOneCRL(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.NotModified {
+		t.Error("a first sync cannot be unmodified")
+	}
+	if changes.Timestamp != 30 {
+		t.Errorf("expected a timestamp of 30, got %d", changes.Timestamp)
+	}
+	if len(changes.Changed) != 2 || len(changes.Deleted) != 0 {
+		t.Errorf("expected 2 changes and no deletions, got %d and %d", len(changes.Changed), len(changes.Deleted))
+	}
+}
+
+func TestSyncRecordsTombstones(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("_since"); got != `"30"` {
+			t.Errorf(`expected _since="30", got %s`, got)
+		}
+		if got := r.Header.Get("If-None-Match"); got != `"30"` {
+			t.Errorf(`expected If-None-Match "30", got %s`, got)
+		}
+		w.Header().Set("ETag", `"50"`)
+		_, _ = w.Write([]byte(`{"data": [
+			{"id": "a", "last_modified": 50, "deleted": true},
+			{"id": "c", "last_modified": 40, "serialNumber": "3"}
+		]}`))
+	}))
+	changes, err := c.SyncRecords(NewOneCRL(), 30, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Timestamp != 50 {
+		t.Errorf("expected a timestamp of 50, got %d", changes.Timestamp)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0] != "a" {
+		t.Errorf("expected record a to be deleted, got %v", changes.Deleted)
+	}
+	if len(changes.Changed) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes.Changed))
+	}
+	record := new(OneCRLRecord)
+	if err := json.Unmarshal(changes.Changed[0], record); err != nil {
+		t.Fatal(err)
+	}
+	if record.SerialNumber != "3" {
+		t.Errorf("expected record c, got serial %s", record.SerialNumber)
+	}
+}
+
+func TestSyncRecordsNotModified(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"30"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		t.Error("expected a conditional request")
+	}))
+	changes, err := c.SyncRecords(NewOneCRL(), 30, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changes.NotModified {
+		t.Error("expected the collection to be reported as unmodified")
+	}
+	if changes.Timestamp != 30 {
+		t.Errorf("expected the requested timestamp to be kept, got %d", changes.Timestamp)
+	}
+}
+
+func TestSyncRecordsExpected(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("_expected"); got != `"60"` {
+			t.Errorf(`expected _expected="60", got %s`, got)
+		}
+		w.Header().Set("ETag", `"60"`)
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}))
+	if _, err := c.SyncRecords(NewOneCRL(), 0, 60); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncRecordsPaginated(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("_token") == "" {
+			w.Header().Set("ETag", `"50"`)
+			w.Header().Set("Next-Page", "http://"+r.Host+r.URL.Path+`?_since="30"&_token=next`)
+			_, _ = w.Write([]byte(`{"data": [{"id": "c", "last_modified": 50}]}`))
+			return
+		}
+		// Later pages are free to carry any ETag, only the first speaks for the collection.
+		w.Header().Set("ETag", `"40"`)
+		_, _ = w.Write([]byte(`{"data": [{"id": "a", "last_modified": 40, "deleted": true}]}`))
+	}))
+	changes, err := c.SyncRecords(NewOneCRL(), 30, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Timestamp != 50 {
+		t.Errorf("expected a timestamp of 50, got %d", changes.Timestamp)
+	}
+	if len(changes.Changed) != 1 || len(changes.Deleted) != 1 {
+		t.Errorf("expected 1 change and 1 deletion, got %d and %d", len(changes.Changed), len(changes.Deleted))
+	}
+}
@@ -0,0 +1,364 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package cassette records the HTTP exchanges that a client makes with a real service, and replays them
+// later, so that tests of the client may run offline, deterministically, and without credentials.
+//
+// A cassette plugs into either the Kinto or the Bugzilla client as a middleware:
+//
+//	func TestProductionOneCRL(t *testing.T) {
+//		tape := cassette.Open(t, "testdata/TestProductionOneCRL.json")
+//		c := kinto.NewClient("https", "firefox.settings.services.mozilla.com", "/v1").WithMiddleware(tape.Middleware())
+//		...
+//	}
+//
+// By default, cassettes are replayed and no request ever reaches the network. A request that does not
+// match any recorded interaction fails with an error naming the request and the cassette. Running the
+// tests with CASSETTE_RECORD=1 instead sends every request to the real service and (re)writes the cassette
+// once the test completes. Credentials (E.G. Authorization and API key headers) are redacted before the
+// cassette is written, so cassettes are safe to commit.
+package cassette // import "github.com/mozilla/OneCRL-Tools/middleware/cassette"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/mozilla/OneCRL-Tools/middleware"
+)
+
+// RecordEnv is the environment variable which, if set, puts every cassette opened via Open into recording mode.
+const RecordEnv = "CASSETTE_RECORD"
+
+// Redacted replaces the value of every redacted header and query parameter.
+const Redacted = "REDACTED"
+
+// The headers whose values are redacted before a cassette is written.
+var redactedHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Bugzilla-Api-Key",
+	"X-Bugzilla-Login",
+	"X-Bugzilla-Password",
+	"X-Bugzilla-Token",
+}
+
+// The query parameters whose values are redacted before a cassette is written.
+var redactedParams = []string{"api_key", "Bugzilla_api_key", "Bugzilla_password", "Bugzilla_token", "token", "password"}
+
+// An Interaction is a single recorded exchange.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	// The URL of the request. Only the path and query are considered when matching requests, so that a
+	// cassette may be replayed against any host (E.G. that of an httptest.Server).
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	// If empty, then a request with any body matches. Otherwise, JSON bodies are compared
+	// semantically (that is, regardless of formatting and key order) and others exactly.
+	Body     string `json:"body,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type Response struct {
+	Status   int         `json:"status"`
+	Headers  http.Header `json:"headers,omitempty"`
+	Body     string      `json:"body"`
+	Encoding string      `json:"encoding,omitempty"`
+}
+
+// A Cassette is a list of interactions, which are either being recorded or replayed.
+type Cassette struct {
+	path         string
+	recording    bool
+	Interactions []*Interaction `json:"interactions"`
+	replayed     []bool
+	lock         sync.Mutex
+}
+
+// Load reads the cassette at the given path for replaying. A cassette that does not
+// exist is loaded as an empty cassette, which matches no request whatsoever.
+func Load(path string) (*Cassette, error) {
+	c := &Cassette{path: path, Interactions: make([]*Interaction, 0)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("cassette: %s is malformed: %v", path, err)
+	}
+	c.replayed = make([]bool, len(c.Interactions))
+	return c, nil
+}
+
+// New constructs an empty cassette for recording to the given path (see Save).
+func New(path string) *Cassette {
+	return &Cassette{path: path, recording: true, Interactions: make([]*Interaction, 0)}
+}
+
+// T is the subset of testing.TB that Open requires.
+type T interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Open opens the cassette at the given path for the duration of the given test. If the
+// RecordEnv environment variable is set, then the cassette is recorded (and written once
+// the test completes). Otherwise, it is replayed, and the test fails if any of the recorded
+// interactions were not replayed.
+func Open(t T, path string) *Cassette {
+	t.Helper()
+	if os.Getenv(RecordEnv) != "" {
+		c := New(path)
+		t.Cleanup(func() {
+			if err := c.Save(); err != nil {
+				t.Errorf("%v", err)
+			}
+		})
+		return c
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	t.Cleanup(func() {
+		if unplayed := c.Unplayed(); len(unplayed) > 0 {
+			t.Errorf("cassette: %d interaction(s) of %s were never replayed, the first being %s %s",
+				len(unplayed), path, unplayed[0].Request.Method, unplayed[0].Request.URL)
+		}
+	})
+	return c
+}
+
+// Recording returns whether the cassette is being recorded, rather than replayed.
+func (c *Cassette) Recording() bool {
+	return c.recording
+}
+
+// Middleware returns the middleware which records to, or replays from, this cassette.
+func (c *Cassette) Middleware() middleware.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return middleware.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if c.recording {
+				return c.record(next, r)
+			}
+			return c.replay(r)
+		})
+	}
+}
+
+// Unplayed returns every interaction that has not (yet) been replayed.
+func (c *Cassette) Unplayed() []*Interaction {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	unplayed := make([]*Interaction, 0)
+	for i, interaction := range c.Interactions {
+		if !c.replayed[i] {
+			unplayed = append(unplayed, interaction)
+		}
+	}
+	return unplayed
+}
+
+// Save writes the recorded interactions, with credentials redacted, to the cassette's path.
+func (c *Cassette) Save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, append(b, '\n'), 0644)
+}
+
+func (c *Cassette) record(next http.RoundTripper, r *http.Request) (*http.Response, error) {
+	body, err := readBody(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if r.Body != nil {
+		r = r.Clone(r.Context())
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	interaction := &Interaction{
+		Request: Request{
+			Method:  r.Method,
+			URL:     redactURL(r.URL),
+			Headers: redactHeaders(r.Header),
+		},
+		Response: Response{
+			Status:  resp.StatusCode,
+			Headers: redactHeaders(resp.Header),
+		},
+	}
+	interaction.Request.Body, interaction.Request.Encoding = encode(body)
+	interaction.Response.Body, interaction.Response.Encoding = encode(respBody)
+	c.lock.Lock()
+	c.Interactions = append(c.Interactions, interaction)
+	c.lock.Unlock()
+	return resp, nil
+}
+
+func (c *Cassette) replay(r *http.Request) (*http.Response, error) {
+	body, err := readBody(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, interaction := range c.Interactions {
+		if c.replayed[i] || !interaction.Request.matches(r, body) {
+			continue
+		}
+		c.replayed[i] = true
+		respBody, err := decode(interaction.Response.Body, interaction.Response.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("cassette: the response to %s %s in %s is malformed: %v", r.Method, r.URL, c.path, err)
+		}
+		headers := interaction.Response.Headers
+		if headers == nil {
+			headers = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        headers.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       r,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette: no unplayed interaction in %s matches %s %s (record it by running with %s=1)",
+		c.path, r.Method, r.URL.RequestURI(), RecordEnv)
+}
+
+func (r *Request) matches(req *http.Request, body []byte) bool {
+	if r.Method != req.Method {
+		return false
+	}
+	recorded, err := url.Parse(r.URL)
+	if err != nil || recorded.Path != req.URL.Path || !sameQuery(recorded.Query(), req.URL.Query()) {
+		return false
+	}
+	if r.Body == "" {
+		return true
+	}
+	want, err := decode(r.Body, r.Encoding)
+	if err != nil {
+		return false
+	}
+	return sameBody(want, body)
+}
+
+// sameQuery compares queries, considering redacted parameters to match any value.
+func sameQuery(recorded, actual url.Values) bool {
+	for _, param := range redactedParams {
+		if recorded.Get(param) == Redacted {
+			recorded.Del(param)
+			actual.Del(param)
+		}
+	}
+	if len(recorded) == 0 && len(actual) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(recorded, actual)
+}
+
+func sameBody(want, got []byte) bool {
+	var w, g interface{}
+	if json.Unmarshal(want, &w) == nil && json.Unmarshal(got, &g) == nil {
+		return reflect.DeepEqual(w, g)
+	}
+	return bytes.Equal(want, got)
+}
+
+func redactHeaders(headers http.Header) http.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	redacted := headers.Clone()
+	for _, header := range redactedHeaders {
+		if redacted.Get(header) != "" {
+			redacted.Set(header, Redacted)
+		}
+	}
+	return redacted
+}
+
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	query := redacted.Query()
+	for _, param := range redactedParams {
+		if query.Get(param) != "" {
+			query.Set(param, Redacted)
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil || body == http.NoBody {
+		return nil, nil
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// encode stores bodies as plain strings where possible, so that cassettes
+// are easy to read (and to write by hand), and as base64 otherwise.
+func encode(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decode(body, encoding string) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "":
+		return []byte(body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(body)
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
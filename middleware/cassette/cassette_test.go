@@ -0,0 +1,119 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/OneCRL-Tools/middleware"
+)
+
+func client(c *Cassette) *http.Client {
+	return &http.Client{Transport: middleware.Chain(nil, c.Middleware())}
+}
+
+func post(t *testing.T, c *http.Client, url, body string) (int, string) {
+	t.Helper()
+	r, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("X-BUGZILLA-API-KEY", "secret")
+	resp, err := c.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"call": %d, "got": %s}`, calls, b)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "testdata", "cassette.json")
+	recorder := New(path)
+	for _, body := range []string{`{"a": 1}`, `{"a": 2}`} {
+		post(t, client(recorder), server.URL+"/bug?api_key=secret&id=1", body)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(saved, []byte("secret")) {
+		t.Fatalf("credentials were not redacted from the cassette\n%s", saved)
+	}
+
+	player, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	// Bodies are matched semantically, and interactions may be replayed against any host.
+	status, body := post(t, client(player), "http://replayed.example.org/bug?id=1&api_key=other", `{"a":2}`)
+	if status != http.StatusCreated || body != `{"call": 2, "got": {"a": 2}}` {
+		t.Errorf("unexpected replay %d %s", status, body)
+	}
+	if unplayed := player.Unplayed(); len(unplayed) != 1 || unplayed[0].Request.Body != `{"a": 1}` {
+		t.Errorf("expected the first interaction to remain unplayed, got %v", unplayed)
+	}
+	// Each interaction is replayed at most once.
+	r, _ := http.NewRequest(http.MethodPost, "http://replayed.example.org/bug?id=1", strings.NewReader(`{"a": 2}`))
+	if _, err := client(player).Do(r); err == nil || !strings.Contains(err.Error(), "no unplayed interaction") {
+		t.Errorf("expected an unmatched request error, got %v", err)
+	}
+}
+
+func TestReplayUnmatched(t *testing.T) {
+	player, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client(player).Get("http://example.org/rest/version")
+	if err == nil || !strings.Contains(err.Error(), "GET /rest/version") || !strings.Contains(err.Error(), RecordEnv) {
+		t.Errorf("expected an error naming the request and how to record it, got %v", err)
+	}
+}
+
+func TestReplayBinary(t *testing.T) {
+	player := &Cassette{
+		path: "binary.json",
+		Interactions: []*Interaction{{
+			Request:  Request{Method: http.MethodGet, URL: "https://example.org/attachment"},
+			Response: Response{Status: http.StatusOK, Body: "AP8=", Encoding: "base64"},
+		}},
+		replayed: []bool{false},
+	}
+	resp, err := client(player).Get("http://localhost/attachment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if !bytes.Equal(b, []byte{0, 255}) {
+		t.Errorf("unexpected body %v", b)
+	}
+}
@@ -0,0 +1,126 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package middleware provides composable HTTP client middleware, which may be given to both the
+// Kinto and the Bugzilla clients (via their WithMiddleware methods) in order to log, measure,
+// record, or otherwise modify every exchange they make.
+//
+//	client := kinto.NewClient("https", "remote-settings.mozilla.org", "/v1").
+//		WithTransport(transport).
+//		WithMiddleware(middleware.Logging(log.Printf), middleware.Header("X-Request-Source", "cron"))
+package middleware // import "github.com/mozilla/OneCRL-Tools/middleware"
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// A Middleware wraps the RoundTripper that actually makes (or continues) an exchange. A middleware
+// may modify the request before passing it on, inspect or replace the response, or not pass the
+// request on at all (E.G. in order to replay a recorded response).
+//
+// As with any RoundTripper, a middleware must not modify the request given to it, but rather a clone of it.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function into an http.RoundTripper.
+type RoundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Chain wraps the given transport (or http.DefaultTransport if nil) with the given middleware. The
+// first middleware is the outermost, which is to say that it is first to see every request and
+// last to see every response.
+func Chain(transport http.RoundTripper, middleware ...Middleware) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	return transport
+}
+
+// Header sets the given header upon every request.
+func Header(key, value string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			r = r.Clone(r.Context())
+			r.Header.Set(key, value)
+			return next.RoundTrip(r)
+		})
+	}
+}
+
+// Logging logs the method, URL, status, and duration of every exchange with the given logger (E.G. log.Printf).
+// Headers and bodies are never logged, as they may well carry credentials.
+func Logging(logf func(format string, args ...interface{})) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(r)
+			if err != nil {
+				logf("%s %s failed after %s: %v", r.Method, redact(r), time.Since(start), err)
+				return resp, err
+			}
+			logf("%s %s %d in %s", r.Method, redact(r), resp.StatusCode, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// Observe calls the given function upon the completion of every exchange, which is a
+// convenient hook for metrics. The response is nil if the exchange failed outright.
+func Observe(observer func(r *http.Request, resp *http.Response, err error, duration time.Duration)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(r)
+			observer(r, resp, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// redact returns the URL of the request without any user info (E.G. basic auth credentials).
+func redact(r *http.Request) string {
+	u := *r.URL
+	u.User = nil
+	return u.String()
+}
+
+// Transport returns a clone of http.DefaultTransport (and therefore one that honors the HTTP_PROXY,
+// HTTPS_PROXY, and NO_PROXY environment variables) which additionally trusts the given roots and
+// presents the given client certificates (for mutual TLS). The system roots are still trusted.
+func Transport(roots *x509.CertPool, certificates ...tls.Certificate) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.RootCAs = roots
+	transport.TLSClientConfig.Certificates = certificates
+	return transport
+}
+
+// SystemRootsWith returns the system's roots with the addition of every certificate
+// within the given PEM file (E.G. the private root of an egress proxy).
+func SystemRootsWith(pemFile string) (*x509.CertPool, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	b, err := ioutil.ReadFile(pemFile)
+	if err != nil {
+		return nil, err
+	}
+	if !roots.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates were found within %s", pemFile)
+	}
+	return roots, nil
+}
@@ -0,0 +1,108 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package middleware
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tag records the given name upon seeing the request and again upon seeing the response.
+func tag(name string, trace *[]string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			*trace = append(*trace, name+" request")
+			resp, err := next.RoundTrip(r)
+			*trace = append(*trace, name+" response")
+			return resp, err
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Source")))
+	}))
+	defer server.Close()
+	trace := make([]string, 0)
+	client := &http.Client{Transport: Chain(nil, tag("outer", &trace), Header("X-Source", "cron"), tag("inner", &trace))}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "cron" {
+		t.Errorf("expected the header to be set, got %q", body)
+	}
+	if req.Header.Get("X-Source") != "" {
+		t.Error("expected the original request to be left untouched")
+	}
+	want := []string{"outer request", "inner request", "inner response", "outer response"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("expected %v, got %v", want, trace)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+	lines := make([]string, 0)
+	var observed time.Duration
+	client := &http.Client{Transport: Chain(nil,
+		Logging(func(format string, args ...interface{}) { lines = append(lines, fmt.Sprintf(format, args...)) }),
+		Observe(func(r *http.Request, resp *http.Response, err error, duration time.Duration) { observed = duration }))}
+	u := strings.Replace(server.URL, "http://", "http://alice:secret@", 1)
+	resp, err := client.Get(u + "/v1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "GET "+server.URL+"/v1/ 418 in ") {
+		t.Errorf("unexpected log %v", lines)
+	}
+	if strings.Contains(lines[0], "secret") {
+		t.Error("expected credentials to be redacted")
+	}
+	if observed <= 0 {
+		t.Error("expected the exchange to be observed")
+	}
+}
+
+func TestTransportWithPrivateRoot(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	if _, err := (&http.Client{Transport: Transport(nil)}).Get(server.URL); err == nil {
+		t.Fatal("expected the test server's root to be untrusted by default")
+	}
+	bundle := filepath.Join(t.TempDir(), "bundle.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(bundle, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	roots, err := SystemRootsWith(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: Transport(roots)}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}